@@ -0,0 +1,153 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/andrewkroh/go-sawmill/pkg/esingest"
+	"github.com/andrewkroh/go-sawmill/pkg/pipeline"
+)
+
+// convertCommand converts a pipeline between sawmill and another format.
+func convertCommand(args []string) error {
+	var from, to, id, output string
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	fs.StringVar(&from, "from", "", "convert from this format to a sawmill pipeline (es-ingest)")
+	fs.StringVar(&to, "to", "", "convert a sawmill pipeline to this format (es-ingest)")
+	fs.StringVar(&id, "id", "", "ID of the pipeline converted with -from (defaults to the ID in the input or the file name)")
+	fs.StringVar(&output, "o", "", "output file (defaults to stdout)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %[1]s convert -from es-ingest [flags] <file>\n       %[1]s convert -to es-ingest [flags] <file>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("exactly one pipeline file must be specified")
+	}
+
+	var convert func(out io.Writer) error
+	switch {
+	case from != "" && to != "":
+		fs.Usage()
+		return errors.New("only one of -from and -to can be specified")
+	case from == "" && to == "":
+		fs.Usage()
+		return errors.New("either -from or -to must be specified")
+	case from == "es-ingest":
+		convert = func(out io.Writer) error {
+			return convertIngestPipeline(out, os.Stderr, fs.Arg(0), id)
+		}
+	case to == "es-ingest":
+		convert = func(out io.Writer) error {
+			return exportIngestPipeline(out, os.Stderr, fs.Arg(0))
+		}
+	default:
+		fs.Usage()
+		return fmt.Errorf("unsupported format %q", from+to)
+	}
+
+	out := io.Writer(os.Stdout)
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	return convert(out)
+}
+
+// convertIngestPipeline converts the Elasticsearch ingest pipeline in file
+// and writes it as YAML to out. Problems are written to problemsOut and
+// cause an error to be returned after the output is written.
+func convertIngestPipeline(out, problemsOut io.Writer, file, id string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	config, problems, err := esingest.Import(id, data)
+	if errors.Is(err, esingest.ErrMissingID) {
+		id = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		config, problems, err = esingest.Import(id, data)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to convert %s: %w", file, err)
+	}
+
+	buf := new(bytes.Buffer)
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(2)
+	if err = enc.Encode(config); err != nil {
+		return err
+	}
+	if _, err = out.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	return reportProblems(problemsOut, file, problems)
+}
+
+// reportProblems writes the conversion problems to out and returns an error
+// if there are any.
+func reportProblems(out io.Writer, file string, problems []esingest.Problem) error {
+	for _, p := range problems {
+		fmt.Fprintf(out, "%s: %s\n", file, p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("found %d problems converting %s", len(problems), file)
+	}
+	return nil
+}
+
+// exportIngestPipeline converts the sawmill pipeline in file to an
+// Elasticsearch ingest pipeline and writes it as JSON to out. Problems are
+// written to problemsOut and cause an error to be returned after the output
+// is written.
+func exportIngestPipeline(out, problemsOut io.Writer, file string) error {
+	// References are not substituted so that secrets are not exported.
+	config, err := pipeline.LoadConfigFile(file, pipeline.LoadOptions{KeepReferences: true})
+	if err != nil {
+		return fmt.Errorf("failed to load pipeline from %s: %w", file, err)
+	}
+
+	data, problems, err := esingest.Export(config)
+	if err != nil {
+		return fmt.Errorf("failed to convert %s: %w", file, err)
+	}
+	if _, err = out.Write(data); err != nil {
+		return err
+	}
+
+	return reportProblems(problemsOut, file, problems)
+}
@@ -0,0 +1,108 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertIngestPipeline(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+		return path
+	}
+
+	// The ID defaults to the file name.
+	file := write("my-app.json", `{"processors": [{"lowercase": {"field": "message", "if": "ctx.message != null"}}]}`)
+	var out, problems bytes.Buffer
+	require.NoError(t, convertIngestPipeline(&out, &problems, file, ""))
+	assert.Equal(t, `id: my-app
+processors:
+  - lowercase:
+      if: message != null
+      field: message
+`, out.String())
+	assert.Empty(t, problems.String())
+
+	// The ID from a GET _ingest/pipeline response is used.
+	file = write("response.json", `{"app": {"processors": [{"drop": {}}]}}`)
+	out.Reset()
+	require.NoError(t, convertIngestPipeline(&out, &problems, file, ""))
+	assert.Equal(t, "id: app\nprocessors:\n  - drop: {}\n", out.String())
+
+	// Problems are reported after writing the output.
+	file = write("grok.json", `{"processors": [{"grok": {"field": "message"}}]}`)
+	out.Reset()
+	err := convertIngestPipeline(&out, &problems, file, "custom")
+	require.Error(t, err)
+	assert.Equal(t, "found 1 problems converting "+file, err.Error())
+	assert.Equal(t, "id: custom\nprocessors:\n  - grok:\n      field: message\n", out.String())
+	assert.Equal(t, file+`: processors[0].grok: processor type "grok" cannot be converted`+"\n", problems.String())
+}
+
+func TestExportIngestPipeline(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "secret")
+	require.NoError(t, os.WriteFile(secretFile, []byte("TOPSECRET"), 0o600))
+
+	file := filepath.Join(dir, "app.yml")
+	require.NoError(t, os.WriteFile(file, []byte(`id: app
+timeout: 1s
+processors:
+  - lowercase:
+      field: message
+      if: event.kind != "alert"
+  - set:
+      target_field: token
+      value: ${file:`+secretFile+`}
+`), 0o644))
+
+	var out, problems bytes.Buffer
+	err := exportIngestPipeline(&out, &problems, file)
+	require.Error(t, err)
+	assert.Equal(t, "found 2 problems converting "+file, err.Error())
+	assert.Equal(t, `{
+  "processors": [
+    {
+      "lowercase": {
+        "field": "message",
+        "if": "ctx.event?.kind != 'alert'"
+      }
+    },
+    {
+      "set": {
+        "field": "token",
+        "value": "${file:`+secretFile+`}"
+      }
+    }
+  ]
+}
+`, out.String())
+	assert.NotContains(t, out.String(), "TOPSECRET")
+	assert.Equal(t, file+": timeout: pipeline timeouts are not supported\n"+
+		file+`: processors[1].set.value: references are not supported by Elasticsearch, "${file:`+secretFile+`}" must be substituted by hand`+"\n",
+		problems.String())
+}
@@ -0,0 +1,117 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+	"github.com/andrewkroh/go-sawmill/pkg/pipeline"
+)
+
+// dlqRecord is an event that failed processing. The dead-letter queue is an
+// ndjson file containing a record per failed event.
+type dlqRecord struct {
+	Timestamp time.Time    `json:"@timestamp"` // When the event failed.
+	Event     *event.Event `json:"event"`      // Event as it was before processing.
+	Error     failure      `json:"error"`
+}
+
+// failure describes why an event failed. The processor fields are empty if
+// the failure was not caused by a processor (e.g. a timeout).
+type failure struct {
+	Message       string `json:"message"`
+	PipelineID    string `json:"pipeline_id,omitempty"`
+	ProcessorID   string `json:"processor_id,omitempty"`
+	ProcessorType string `json:"processor_type,omitempty"`
+	ProcessorTag  string `json:"processor_tag,omitempty"`
+}
+
+// dlqWriter appends failed events to a dead-letter queue file.
+type dlqWriter struct {
+	f   *os.File
+	enc *json.Encoder
+}
+
+// openDLQ opens the dead-letter queue file at path for appending. It returns
+// nil if path is empty.
+func openDLQ(path string) (*dlqWriter, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetEscapeHTML(false)
+	return &dlqWriter{f: f, enc: enc}, nil
+}
+
+// write appends a record for the original event that failed with err.
+func (d *dlqWriter) write(original *event.Event, err error) error {
+	r := dlqRecord{
+		Timestamp: time.Now().UTC(),
+		Event:     original,
+		Error:     newFailure(err),
+	}
+	return d.enc.Encode(r)
+}
+
+// newFailure returns a description of err that includes the details of the
+// processor that failed.
+func newFailure(err error) failure {
+	var procErr *pipeline.ProcessorError
+	if !errors.As(err, &procErr) {
+		return failure{Message: err.Error()}
+	}
+	return failure{
+		Message:       procErr.Err.Error(),
+		PipelineID:    procErr.PipelineID,
+		ProcessorID:   procErr.ProcessorID,
+		ProcessorType: procErr.ProcessorType,
+		ProcessorTag:  procErr.ProcessorTag,
+	}
+}
+
+func (d *dlqWriter) Close() error {
+	return d.f.Close()
+}
+
+// handleFailure logs an event that failed processing and writes it to the
+// dead-letter queue, if there is one. Input that could not be decoded is
+// written as an event containing the raw input as event.original so that it
+// can be replayed. original is nil if the raw input is unknown, in which case
+// it is only logged. The returned error is non-nil if the event could not be
+// written to the dead-letter queue.
+func handleFailure(dlq *dlqWriter, lineNumber uint64, original *event.Event, err error) error {
+	logProcessingError(lineNumber, err)
+	if dlq == nil || original == nil {
+		return nil
+	}
+	if err := dlq.write(original, err); err != nil {
+		log.Printf("Error writing the event from line %d to the dead-letter queue: %v", lineNumber, err)
+		return err
+	}
+	return nil
+}
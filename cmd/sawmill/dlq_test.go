@@ -0,0 +1,119 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+	"github.com/andrewkroh/go-sawmill/pkg/pipeline"
+)
+
+// newUppercasePipeline returns a pipeline that uppercases the given field
+// into message. It fails events that do not contain the field.
+func newUppercasePipeline(t *testing.T, field string) processFunc {
+	t.Helper()
+
+	pipe, err := pipeline.New(&pipeline.Config{
+		ID: "uppercase",
+		Processors: []pipeline.ProcessorConfig{
+			{
+				"uppercase": &pipeline.ProcessorOptionConfig{
+					Config: map[string]interface{}{
+						"field":        field,
+						"target_field": "message",
+					},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { pipe.Close() })
+
+	return func(evt *event.Event) (*event.Event, error) {
+		return processEvent(pipe, evt)
+	}
+}
+
+// readDLQ returns the records in a dead-letter queue file.
+func readDLQ(t *testing.T, path string) []dlqRecord {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var records []dlqRecord
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for dec.More() {
+		var r dlqRecord
+		require.NoError(t, dec.Decode(&r))
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestProcessInputDLQ(t *testing.T) {
+	defer func(c inputConfig, path string) { input, dlqPath = c, path }(input, dlqPath)
+	input = testInputConfig(inputFormatNDJSON)
+	dlqPath = filepath.Join(t.TempDir(), "dlq.ndjson")
+
+	process := newUppercasePipeline(t, "user.name")
+
+	var out bytes.Buffer
+	in := `{"user":{"name":"a"}}` + "\n" + `{"user":{"id":"b"}}` + "\n" + `not json` + "\n"
+	require.NoError(t, processInput(context.Background(), strings.NewReader(in), &out, process))
+	assert.Contains(t, out.String(), `"message":"A"`)
+	assert.Equal(t, 1, strings.Count(out.String(), "\n"))
+
+	records := readDLQ(t, dlqPath)
+	require.Len(t, records, 2)
+	r := records[0]
+	assert.False(t, r.Timestamp.IsZero())
+	assert.Equal(t, failure{
+		Message:       "key <user.name> is missing from event",
+		PipelineID:    "uppercase",
+		ProcessorID:   "uppercase.processors[0].uppercase",
+		ProcessorType: "uppercase",
+	}, r.Error)
+
+	data, err := r.Event.MarshalJSON()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"@metadata":{"line_number":2},"user":{"id":"b"}}`, string(data))
+
+	// Input that could not be decoded is written as event.original so that
+	// it can be replayed.
+	r = records[1]
+	assert.Contains(t, r.Error.Message, "failed to decode input")
+	assert.Empty(t, r.Error.ProcessorID)
+	data, err = r.Event.MarshalJSON()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"@metadata":{"line_number":3},"event":{"original":"not json"}}`, string(data))
+
+	// Records are appended.
+	require.NoError(t, processInput(context.Background(), strings.NewReader(`{}`+"\n"), &out, process))
+	assert.Len(t, readDLQ(t, dlqPath), 3)
+}
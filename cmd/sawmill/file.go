@@ -0,0 +1,282 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+)
+
+// followPollInterval is how often a followed file is checked for new data,
+// rotation, and truncation after reaching its end.
+var followPollInterval = 250 * time.Millisecond
+
+// inputContext returns the context used to read the input. When following
+// files it is canceled by an interrupt so that the events that were read are
+// processed before exiting.
+func inputContext(c inputConfig) (context.Context, context.CancelFunc) {
+	if !c.follow {
+		return context.WithCancel(context.Background())
+	}
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// readSources reads events from the input files, or from in if there are no
+// input files.
+func readSources(ctx context.Context, in io.Reader, c inputConfig, events chan<- inputEvent) error {
+	if len(c.paths) == 0 {
+		return readInput(in, c, events)
+	}
+	return readFiles(ctx, c, events)
+}
+
+// readFiles reads events from the files matching the glob patterns in
+// c.paths. Files are read one after the other in the order given, with each
+// pattern's matches in lexical order. When following, the files are read
+// concurrently until ctx is done.
+func readFiles(ctx context.Context, c inputConfig, events chan<- inputEvent) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	files, err := expandGlobs(c.paths)
+	if err != nil {
+		return err
+	}
+
+	if !c.follow {
+		for _, f := range files {
+			if err = readFile(ctx, f, c, events); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	errs := make([]error, len(files))
+	var wg sync.WaitGroup
+	wg.Add(len(files))
+	for i, f := range files {
+		go func(i int, f string) {
+			defer wg.Done()
+			errs[i] = readFile(ctx, f, c, events)
+		}(i, f)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expandGlobs returns the files matching each pattern. It is an error if a
+// pattern does not match any files.
+func expandGlobs(patterns []string) ([]string, error) {
+	var files []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %q", pattern)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// readFile reads the events from a file. Compressed files are decompressed.
+// When following, an uncompressed file is read from the start again after it
+// is rotated or truncated. If there is a registry then reading resumes after
+// the events that were processed by an earlier run.
+func readFile(ctx context.Context, path string, c inputConfig, events chan<- inputEvent) error {
+	for {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed reading %s: %w", path, err)
+		}
+
+		follow, err := readOpenFile(ctx, f, c, events)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed reading %s: %w", path, err)
+		}
+
+		if !follow || ctx.Err() != nil {
+			return nil
+		}
+		// The file was rotated or truncated.
+	}
+}
+
+// readOpenFile reads the events from f and adds the file's path and the
+// offset of each event to them. It returns true if f was followed until it
+// was rotated or truncated.
+func readOpenFile(ctx context.Context, f *os.File, c inputConfig, events chan<- inputEvent) (followed bool, err error) {
+	// Raw lines and ndjson can be read starting at any line. For other
+	// formats and compressed files the processed events are read and skipped.
+	compressed := isCompressed(f.Name())
+	seekable := !compressed && (c.format == inputFormatRaw || c.format == inputFormatNDJSON)
+
+	var cursor *fileCursor
+	var skip int64
+	if c.registry != nil {
+		var pos inputPosition
+		cursor, pos, err = c.registry.open(f, !compressed)
+		if err != nil {
+			return false, err
+		}
+		if seekable {
+			if _, err = f.Seek(pos.offset, io.SeekStart); err != nil {
+				return false, err
+			}
+			c.start = pos
+		} else {
+			skip = pos.offset
+		}
+	}
+
+	r, followed, err := fileReader(ctx, f, c.follow)
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+
+	fileEvents := make(chan inputEvent)
+	var readErr error
+	go func() {
+		defer close(fileEvents)
+		readErr = readInput(r, c, fileEvents)
+	}()
+
+	for e := range fileEvents {
+		if e.end.offset <= skip {
+			// Processed by an earlier run.
+			continue
+		}
+		e.cursor = cursor
+		if e.err != nil {
+			e.err = fmt.Errorf("%s: %w", f.Name(), e.err)
+		} else {
+			e.event.Put("log.file.path", event.String(f.Name()))
+			e.event.Put("log.offset", event.Integer(e.offset))
+		}
+		events <- e
+	}
+	return followed, readErr
+}
+
+// isCompressed returns true if the file is decompressed by fileReader.
+func isCompressed(path string) bool {
+	switch filepath.Ext(path) {
+	case ".gz", ".zst":
+		return true
+	}
+	return false
+}
+
+// fileReader returns a reader for the contents of f. Files ending in .gz and
+// .zst are decompressed. If follow is true then the returned reader follows
+// an uncompressed file. Compressed files are never followed.
+func fileReader(ctx context.Context, f *os.File, follow bool) (r io.ReadCloser, followed bool, err error) {
+	switch filepath.Ext(f.Name()) {
+	case ".gz":
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, false, err
+		}
+		return gz, false, nil
+	case ".zst":
+		zr, err := zstd.NewReader(f, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, false, err
+		}
+		return zr.IOReadCloser(), false, nil
+	}
+
+	if follow {
+		return &followReader{ctx: ctx, f: f}, true, nil
+	}
+	return io.NopCloser(f), false, nil
+}
+
+// followReader reads a file that is being written. At the end of the file it
+// waits for more data instead of returning io.EOF. io.EOF is returned once
+// the file has been rotated (the path refers to a different file) or
+// truncated, or when ctx is done.
+type followReader struct {
+	ctx context.Context
+	f   *os.File
+}
+
+func (r *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.f.Read(p)
+		if n > 0 || !errors.Is(err, io.EOF) {
+			return n, err
+		}
+		if r.replaced() {
+			return 0, io.EOF
+		}
+
+		select {
+		case <-r.ctx.Done():
+			return 0, io.EOF
+		case <-time.After(followPollInterval):
+		}
+	}
+}
+
+func (r *followReader) Close() error {
+	return nil
+}
+
+// replaced returns true if the file was rotated or truncated.
+func (r *followReader) replaced() bool {
+	info, err := os.Stat(r.f.Name())
+	if err != nil {
+		// Wait for a rotated file to be recreated.
+		return false
+	}
+	current, err := r.f.Stat()
+	if err != nil {
+		return false
+	}
+	if !os.SameFile(info, current) {
+		return true
+	}
+
+	offset, err := r.f.Seek(0, io.SeekCurrent)
+	return err == nil && info.Size() < offset
+}
@@ -0,0 +1,235 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeGzip(t *testing.T, path, content string) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o600))
+}
+
+func writeZstd(t *testing.T, path, content string) {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := zstd.NewWriter(&buf)
+	require.NoError(t, err)
+	_, err = w.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o600))
+}
+
+// readAllSources reads all events from the input files.
+func readAllSources(t *testing.T, ctx context.Context, c inputConfig) ([]decodedInput, error) {
+	t.Helper()
+
+	events := make(chan inputEvent)
+	var readErr error
+	go func() {
+		defer close(events)
+		readErr = readSources(ctx, nil, c, events)
+	}()
+
+	var decoded []decodedInput
+	for e := range events {
+		d := decodedInput{Line: e.lineNumber}
+		if e.err != nil {
+			d.Error = e.err.Error()
+		} else {
+			data, err := e.event.MarshalJSON()
+			require.NoError(t, err)
+			d.Event = string(data)
+		}
+		decoded = append(decoded, d)
+	}
+	return decoded, readErr
+}
+
+func TestReadFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app.log"), []byte("one\ntwo\n"), 0o600))
+	writeGzip(t, filepath.Join(dir, "app.log.1.gz"), "three\n\nfour\n")
+	writeZstd(t, filepath.Join(dir, "app.log.2.zst"), "five\n")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.log"), []byte("six"), 0o600))
+
+	c := testInputConfig(inputFormatRaw)
+	c.paths = []string{filepath.Join(dir, "app.log*"), filepath.Join(dir, "other.log")}
+	events, err := readAllSources(t, context.Background(), c)
+	require.NoError(t, err)
+
+	event := func(line int, original, file string, offset int) decodedInput {
+		path, err := json.Marshal(filepath.Join(dir, file))
+		require.NoError(t, err)
+		return decodedInput{
+			Line: uint64(line),
+			Event: `{"@metadata":{"line_number":` + strconv.Itoa(line) + `},"event":{"original":"` + original + `"},` +
+				`"log":{"file":{"path":` + string(path) + `},"offset":` + strconv.Itoa(offset) + `}}`,
+		}
+	}
+	assert.Equal(t, []decodedInput{
+		event(1, "one", "app.log", 0),
+		event(2, "two", "app.log", 4),
+		event(1, "three", "app.log.1.gz", 0),
+		event(3, "four", "app.log.1.gz", 7),
+		event(1, "five", "app.log.2.zst", 0),
+		event(1, "six", "other.log", 0),
+	}, events)
+}
+
+func TestReadFilesOffsets(t *testing.T) {
+	dir := t.TempDir()
+	csvFile := filepath.Join(dir, "events.csv")
+	require.NoError(t, os.WriteFile(csvFile, []byte("a,b\n1,\"x\ny\"\n2\n3,z\n"), 0o600))
+	jsonFile := filepath.Join(dir, "events.json")
+	require.NoError(t, os.WriteFile(jsonFile, []byte("[\n  {\"a\": 1},\n  {\"a\": 2}\n]\n"), 0o600))
+
+	offsets := func(format, path string) []string {
+		c := testInputConfig(format)
+		c.paths = []string{path}
+		events, err := readAllSources(t, context.Background(), c)
+		require.NoError(t, err)
+
+		var offsets []string
+		for _, e := range events {
+			if e.Error != "" {
+				offsets = append(offsets, e.Error)
+				continue
+			}
+			var v struct {
+				Log struct {
+					Offset int64 `json:"offset"`
+				} `json:"log"`
+			}
+			require.NoError(t, json.Unmarshal([]byte(e.Event), &v))
+			offsets = append(offsets, strconv.FormatInt(v.Log.Offset, 10))
+		}
+		return offsets
+	}
+
+	assert.Equal(t, []string{"4", csvFile + ": failed to decode input: wrong number of fields", "14"}, offsets(inputFormatCSV, csvFile))
+	assert.Equal(t, []string{"4", "16"}, offsets(inputFormatJSONArray, jsonFile))
+}
+
+func TestReadFilesErrors(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.gz"), []byte("not gzip"), 0o600))
+
+	c := testInputConfig(inputFormatRaw)
+	c.paths = []string{filepath.Join(dir, "*.log")}
+	_, err := readAllSources(t, context.Background(), c)
+	assert.EqualError(t, err, `no files match "`+filepath.Join(dir, "*.log")+`"`)
+
+	c.paths = []string{filepath.Join(dir, "bad.gz")}
+	_, err = readAllSources(t, context.Background(), c)
+	assert.ErrorContains(t, err, "failed reading "+filepath.Join(dir, "bad.gz"))
+
+	c.paths = nil
+	c.follow = true
+	assert.EqualError(t, c.check(), "-follow requires input files")
+}
+
+func TestReadFilesFollow(t *testing.T) {
+	defer func(d time.Duration) { followPollInterval = d }(followPollInterval)
+	followPollInterval = 10 * time.Millisecond
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	require.NoError(t, os.WriteFile(path, []byte("one\n"), 0o600))
+
+	c := testInputConfig(inputFormatRaw)
+	c.paths = []string{path}
+	c.follow = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan inputEvent)
+	done := make(chan error, 1)
+	go func() {
+		defer close(events)
+		done <- readSources(ctx, nil, c, events)
+	}()
+
+	next := func() (string, int64) {
+		t.Helper()
+		select {
+		case e := <-events:
+			require.NoError(t, e.err)
+			return e.event.Get("event.original").String, e.event.Get("log.offset").Integer
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for event")
+			return "", 0
+		}
+	}
+	appendLine := func(path, line string) {
+		t.Helper()
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o600)
+		require.NoError(t, err)
+		_, err = f.WriteString(line)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+
+	line, offset := next()
+	assert.Equal(t, "one", line)
+	assert.EqualValues(t, 0, offset)
+
+	// Appended lines are read.
+	appendLine(path, "two\n")
+	line, offset = next()
+	assert.Equal(t, "two", line)
+	assert.EqualValues(t, 4, offset)
+
+	// A truncated file is read from the start.
+	require.NoError(t, os.WriteFile(path, []byte("x\n"), 0o600))
+	line, offset = next()
+	assert.Equal(t, "x", line)
+	assert.EqualValues(t, 0, offset)
+
+	// A rotated file is replaced by the new file.
+	require.NoError(t, os.Rename(path, path+".1"))
+	appendLine(path, "new\n")
+	line, offset = next()
+	assert.Equal(t, "new", line)
+	assert.EqualValues(t, 0, offset)
+
+	cancel()
+	for e := range events {
+		t.Fatalf("unexpected event %v", e)
+	}
+	require.NoError(t, <-done)
+}
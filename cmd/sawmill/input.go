@@ -0,0 +1,599 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+	"github.com/andrewkroh/go-sawmill/pkg/eventutil"
+)
+
+// Input formats accepted by -input-format.
+const (
+	inputFormatRaw       = "raw"        // Each line is event.original.
+	inputFormatNDJSON    = "ndjson"     // Each line is a JSON object.
+	inputFormatCSV       = "csv"        // CSV with a header row naming the fields.
+	inputFormatJSONArray = "json-array" // A JSON array of objects.
+)
+
+var inputFormats = []string{inputFormatRaw, inputFormatNDJSON, inputFormatCSV, inputFormatJSONArray}
+
+// Values of -multiline-match.
+const (
+	multilineMatchAfter  = "after"  // Continuation lines are appended to the preceding line.
+	multilineMatchBefore = "before" // Continuation lines are prepended to the following line.
+)
+
+// inputConfig contains the options for reading input.
+type inputConfig struct {
+	paths     []string // Input files (glob patterns). Read from stdin if empty.
+	follow    bool
+	format    string
+	maxBytes  int
+	multiline multilineConfig
+	registry  *registry     // Records the progress of input files. May be nil.
+	start     inputPosition // Position in the input where the reader begins.
+}
+
+// inputPosition is a position in the input.
+type inputPosition struct {
+	offset int64  // Byte offset.
+	line   uint64 // Number of lines before the position.
+}
+
+// multilineConfig contains the options for joining lines of raw input into
+// one event. Multiline is enabled when pattern is set.
+type multilineConfig struct {
+	pattern  string
+	negate   bool
+	match    string
+	maxLines int
+	timeout  time.Duration
+}
+
+// addFlags registers the input flags with fs.
+func (c *inputConfig) addFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&c.follow, "follow", false, "wait for more data at the end of the input files and reread them when they are rotated or truncated")
+	fs.StringVar(&c.format, "input-format", inputFormatRaw, "format of the input ("+strings.Join(inputFormats, ", ")+")")
+	fs.IntVar(&c.maxBytes, "max-bytes", 10*1024*1024, "maximum size of a line or multiline event in bytes (longer input is truncated)")
+	fs.StringVar(&c.multiline.pattern, "multiline-pattern", "", "regular expression that identifies the continuation lines of a multiline event (raw input only)")
+	fs.BoolVar(&c.multiline.negate, "multiline-negate", false, "treat the lines that do not match -multiline-pattern as continuation lines")
+	fs.StringVar(&c.multiline.match, "multiline-match", multilineMatchAfter, "whether continuation lines belong to the line before them (after) or the line after them (before)")
+	fs.IntVar(&c.multiline.maxLines, "multiline-max-lines", 500, "maximum number of lines in a multiline event (further lines are discarded)")
+	fs.DurationVar(&c.multiline.timeout, "multiline-timeout", 5*time.Second, "time after the last line is read that a pending multiline event is processed (0 to wait for the next event)")
+}
+
+// check returns an error if the config is invalid.
+func (c *inputConfig) check() error {
+	found := false
+	for _, f := range inputFormats {
+		if f == c.format {
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("invalid -input-format %q (must be one of %s)", c.format, strings.Join(inputFormats, ", "))
+	}
+	if c.maxBytes < 1 {
+		return errors.New("-max-bytes must be at least 1")
+	}
+	if c.follow && len(c.paths) == 0 {
+		return errors.New("-follow requires input files")
+	}
+	if c.registry != nil && len(c.paths) == 0 {
+		return errors.New("-registry requires input files")
+	}
+
+	if c.multiline.pattern == "" {
+		return nil
+	}
+	if c.format != inputFormatRaw {
+		return fmt.Errorf("-multiline-pattern can only be used with -input-format %s", inputFormatRaw)
+	}
+	if _, err := regexp.Compile(c.multiline.pattern); err != nil {
+		return fmt.Errorf("invalid -multiline-pattern: %w", err)
+	}
+	if c.multiline.match != multilineMatchAfter && c.multiline.match != multilineMatchBefore {
+		return fmt.Errorf("invalid -multiline-match %q (must be %s or %s)", c.multiline.match, multilineMatchAfter, multilineMatchBefore)
+	}
+	if c.multiline.maxLines < 1 {
+		return errors.New("-multiline-max-lines must be at least 1")
+	}
+	return nil
+}
+
+// readInput decodes events from the input according to the config and sends
+// them to events. Input that cannot be decoded into an event is sent as an
+// inputEvent with an error so that it is reported without stopping the input.
+// An error is returned if the input cannot be read.
+func readInput(in io.Reader, c inputConfig, events chan<- inputEvent) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+
+	switch c.format {
+	case inputFormatNDJSON:
+		return readLines(in, c, events, ndjsonEvent)
+	case inputFormatCSV:
+		return readCSV(in, events)
+	case inputFormatJSONArray:
+		return readJSONArray(in, events)
+	default:
+		if c.multiline.pattern != "" {
+			return readMultiline(in, c, events)
+		}
+		return readLines(in, c, events, rawEvent)
+	}
+}
+
+// readLines creates an event from each non-empty line of input using decode
+// and sends it to events. Lines longer than -max-bytes are truncated.
+func readLines(in io.Reader, c inputConfig, events chan<- inputEvent, decode func(line string, truncated bool) (*event.Event, error)) error {
+	r := newLineReader(in, c.maxBytes, c.start.offset)
+	lineNumber := c.start.line
+
+	for {
+		line, truncated, err := r.next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("failed reading from input: %w", err)
+		}
+		lineNumber++
+		offset := r.lineOffset
+		end := inputPosition{offset: r.offset, line: lineNumber}
+
+		// Skip empty lines.
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		evt, err := decode(line, truncated)
+		if err == nil {
+			_, err = evt.Put("@metadata.line_number", event.UnsignedInteger(lineNumber))
+		}
+		if err != nil {
+			events <- inputEvent{lineNumber: lineNumber, offset: offset, end: end, err: fmt.Errorf("failed to decode input: %w", err), raw: line}
+			continue
+		}
+
+		events <- inputEvent{lineNumber: lineNumber, offset: offset, end: end, event: evt}
+	}
+}
+
+// rawEvent creates an event containing the line as event.original.
+func rawEvent(line string, truncated bool) (*event.Event, error) {
+	evt := event.New()
+	evt.Put("event.original", event.String(line))
+	if truncated {
+		eventutil.Append(evt, "log.flags", event.String("truncated"))
+	}
+	return evt, nil
+}
+
+// ndjsonEvent decodes a line containing a JSON object into an event.
+func ndjsonEvent(line string, truncated bool) (*event.Event, error) {
+	if truncated {
+		return nil, errors.New("line was truncated because it exceeds -max-bytes")
+	}
+	return decodeEvent([]byte(line))
+}
+
+// decodeEvent decodes a JSON object into an event.
+func decodeEvent(data []byte) (*event.Event, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return nil, errors.New("input is not a JSON object")
+	}
+
+	evt := event.New()
+	if err := json.Unmarshal(data, evt); err != nil {
+		return nil, err
+	}
+	return evt, nil
+}
+
+// lineReader reads lines of input. Lines longer than maxBytes are truncated
+// and the rest of the line is discarded, so the size of a line is not
+// limited by the buffer size.
+type lineReader struct {
+	r          *bufio.Reader
+	maxBytes   int
+	line       []byte
+	lineOffset int64 // Offset of the last line returned by next.
+	offset     int64 // Number of bytes read.
+}
+
+// newLineReader returns a lineReader for in, which begins at offset in the
+// input.
+func newLineReader(in io.Reader, maxBytes int, offset int64) *lineReader {
+	return &lineReader{r: bufio.NewReader(in), maxBytes: maxBytes, offset: offset}
+}
+
+// next returns the next line without its line ending. truncated is true if
+// the line was longer than maxBytes. It returns io.EOF when there are no
+// more lines.
+func (r *lineReader) next() (line string, truncated bool, err error) {
+	r.line = r.line[:0]
+	r.lineOffset = r.offset
+	var read bool
+	for {
+		data, err := r.r.ReadSlice('\n')
+		read = read || len(data) > 0
+		r.offset += int64(len(data))
+		if err == nil {
+			data = data[:len(data)-1] // Remove the newline.
+		}
+		if room := r.maxBytes - len(r.line); len(data) > room {
+			data = data[:room]
+			truncated = true
+		}
+		r.line = append(r.line, data...)
+
+		switch {
+		case err == nil:
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case errors.Is(err, io.EOF) && read:
+			// The last line does not end with a newline.
+		default:
+			return "", false, err
+		}
+		break
+	}
+
+	line = strings.TrimSuffix(string(r.line), "\r")
+	if truncated {
+		line = truncateUTF8(line)
+	}
+	return line, truncated, nil
+}
+
+// truncateUTF8 removes an incomplete UTF-8 sequence from the end of s that
+// was caused by truncation.
+func truncateUTF8(s string) string {
+	for i := len(s) - 1; i >= 0 && i >= len(s)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(s[i]) {
+			if !utf8.FullRuneInString(s[i:]) {
+				return s[:i]
+			}
+			break
+		}
+	}
+	return s
+}
+
+// readMultiline joins the continuation lines of raw input to the line they
+// belong to and sends an event for each multiline message. A pending message
+// is sent when the next message starts, the input ends, or no line is read
+// for the multiline timeout.
+func readMultiline(in io.Reader, c inputConfig, events chan<- inputEvent) error {
+	type rawLine struct {
+		number    uint64
+		offset    int64
+		end       int64
+		text      string
+		truncated bool
+	}
+
+	// Read lines in the background so that the timeout can be enforced.
+	lines := make(chan rawLine)
+	var readErr error
+	go func() {
+		defer close(lines)
+		r := newLineReader(in, c.maxBytes, c.start.offset)
+		for number := c.start.line + 1; ; number++ {
+			text, truncated, err := r.next()
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					readErr = fmt.Errorf("failed reading from input: %w", err)
+				}
+				return
+			}
+			lines <- rawLine{number: number, offset: r.lineOffset, end: r.offset, text: text, truncated: truncated}
+		}
+	}()
+
+	m := &multilineMessage{config: c}
+	pattern := regexp.MustCompile(c.multiline.pattern)
+
+	flush := func() {
+		if evt := m.event(); evt != nil {
+			events <- inputEvent{lineNumber: m.lineNumber, offset: m.offset, end: m.end, event: evt}
+		}
+		m.reset()
+	}
+
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	var timeout <-chan time.Time
+	for {
+		select {
+		case l, ok := <-lines:
+			if !ok {
+				flush()
+				return readErr
+			}
+			continuation := pattern.MatchString(l.text) != c.multiline.negate
+
+			switch c.multiline.match {
+			case multilineMatchBefore:
+				m.add(l.number, l.offset, l.end, l.text, l.truncated)
+				if !continuation {
+					flush()
+				}
+			default:
+				if !continuation || m.empty() {
+					flush()
+				}
+				m.add(l.number, l.offset, l.end, l.text, l.truncated)
+			}
+		case <-timeout:
+			flush()
+		}
+
+		// Restart the timeout for the pending message.
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timeout = nil
+		if !m.empty() && c.multiline.timeout > 0 {
+			timer.Reset(c.multiline.timeout)
+			timeout = timer.C
+		}
+	}
+}
+
+// multilineMessage accumulates the lines of a multiline message.
+type multilineMessage struct {
+	config     inputConfig
+	lineNumber uint64        // Line number of the first line.
+	offset     int64         // Offset of the first line.
+	end        inputPosition // Position after the last line.
+	lines      []string
+	size       int // Size of the message in bytes.
+	truncated  bool
+}
+
+func (m *multilineMessage) empty() bool {
+	return len(m.lines) == 0
+}
+
+// add adds a line to the message while enforcing the maximum number of lines
+// and bytes.
+func (m *multilineMessage) add(lineNumber uint64, offset, end int64, text string, truncated bool) {
+	m.end = inputPosition{offset: end, line: lineNumber}
+	if m.empty() {
+		m.lineNumber = lineNumber
+		m.offset = offset
+	} else {
+		text = "\n" + text
+	}
+	m.truncated = m.truncated || truncated
+
+	if len(m.lines) >= m.config.multiline.maxLines {
+		m.truncated = true
+		return
+	}
+	if room := m.config.maxBytes - m.size; len(text) > room {
+		text = truncateUTF8(text[:room])
+		m.truncated = true
+	}
+	m.lines = append(m.lines, text)
+	m.size += len(text)
+}
+
+// event returns the event for the message or nil if the message is empty or
+// contains only whitespace.
+func (m *multilineMessage) event() *event.Event {
+	message := strings.Join(m.lines, "")
+	if strings.TrimSpace(message) == "" {
+		return nil
+	}
+
+	evt := event.New()
+	evt.Put("@metadata.line_number", event.UnsignedInteger(m.lineNumber))
+	evt.Put("event.original", event.String(message))
+	if m.truncated {
+		eventutil.Append(evt, "log.flags", event.String("truncated"))
+	}
+	return evt
+}
+
+func (m *multilineMessage) reset() {
+	m.lines = m.lines[:0]
+	m.size = 0
+	m.truncated = false
+}
+
+// readCSV creates an event from each record of CSV input. The first record
+// contains the names of the fields.
+func readCSV(in io.Reader, events chan<- inputEvent) error {
+	lines := &lineCounter{}
+	r := csv.NewReader(io.TeeReader(in, lines))
+
+	header, err := r.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return fmt.Errorf("failed reading CSV header: %w", err)
+	}
+	for i, name := range header {
+		if name == "" {
+			return fmt.Errorf("CSV header column %d has no name", i+1)
+		}
+	}
+	// Copy the header because it may share memory with the next record.
+	header = append([]string(nil), header...)
+
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return fmt.Errorf("failed reading from input: %w", err)
+			}
+			// The reader continues with the next record after a parse error.
+			lineNumber := uint64(parseErr.StartLine)
+			offset := lines.lineStart(lineNumber)
+			end := inputPosition{offset: lines.lineStart(uint64(parseErr.Line) + 1), line: uint64(parseErr.Line)}
+			events <- inputEvent{lineNumber: lineNumber, offset: offset, end: end, err: fmt.Errorf("failed to decode input: %w", parseErr.Err)}
+			continue
+		}
+
+		line, _ := r.FieldPos(0)
+		lineNumber := uint64(line)
+		offset := lines.lineStart(lineNumber)
+
+		// The record ends on the line of its last field plus the number of
+		// newlines in the field.
+		last := len(record) - 1
+		line, _ = r.FieldPos(last)
+		endLine := uint64(line) + uint64(strings.Count(record[last], "\n"))
+		end := inputPosition{offset: lines.lineStart(endLine + 1), line: endLine}
+
+		evt := event.New()
+		evt.Put("@metadata.line_number", event.UnsignedInteger(lineNumber))
+		for i, value := range record {
+			if _, err = evt.Put(header[i], event.String(value)); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			events <- inputEvent{lineNumber: lineNumber, offset: offset, end: end, err: fmt.Errorf("failed to decode input: %w", err)}
+			continue
+		}
+
+		events <- inputEvent{lineNumber: lineNumber, offset: offset, end: end, event: evt}
+	}
+}
+
+// readJSONArray creates an event from each object in a JSON array. The
+// input is decoded incrementally so that the array does not need to fit in
+// memory. Elements that are not objects are reported, but malformed JSON
+// stops the input because decoding cannot continue past it.
+func readJSONArray(in io.Reader, events chan<- inputEvent) error {
+	lines := &lineCounter{}
+	dec := json.NewDecoder(io.TeeReader(in, lines))
+
+	tok, err := dec.Token()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return fmt.Errorf("failed reading from input: %w", err)
+	}
+	if tok != json.Delim('[') {
+		return errors.New("failed reading from input: input is not a JSON array")
+	}
+
+	for dec.More() {
+		var raw json.RawMessage
+		if err = dec.Decode(&raw); err != nil {
+			return fmt.Errorf("failed reading from input: %w", err)
+		}
+		offset := dec.InputOffset() - int64(len(raw))
+		lineNumber := lines.lineAt(offset)
+		end := inputPosition{offset: dec.InputOffset(), line: lines.lineAt(dec.InputOffset()) - 1}
+
+		evt, err := decodeEvent(raw)
+		if err == nil {
+			_, err = evt.Put("@metadata.line_number", event.UnsignedInteger(lineNumber))
+		}
+		if err != nil {
+			events <- inputEvent{lineNumber: lineNumber, offset: offset, end: end, err: fmt.Errorf("failed to decode input: %w", err), raw: string(raw)}
+			continue
+		}
+
+		events <- inputEvent{lineNumber: lineNumber, offset: offset, end: end, event: evt}
+	}
+
+	if _, err = dec.Token(); err != nil {
+		return fmt.Errorf("failed reading from input: %w", err)
+	}
+	if _, err = dec.Token(); !errors.Is(err, io.EOF) {
+		return errors.New("failed reading from input: unexpected data after the JSON array")
+	}
+	return nil
+}
+
+// lineCounter records the offsets of the newlines written to it so that the
+// line containing an offset, or the offset of a line, can be determined.
+// Queries must be made in increasing order.
+type lineCounter struct {
+	written  int64   // Number of bytes written.
+	newlines []int64 // Offsets of the newlines after the last queried line.
+	line     uint64  // Number of newlines before the last queried line.
+	start    int64   // Offset of the last queried line.
+}
+
+func (c *lineCounter) Write(p []byte) (int, error) {
+	for i, b := range p {
+		if b == '\n' {
+			c.newlines = append(c.newlines, c.written+int64(i))
+		}
+	}
+	c.written += int64(len(p))
+	return len(p), nil
+}
+
+// lineAt returns the line number (1-based) containing offset.
+func (c *lineCounter) lineAt(offset int64) uint64 {
+	for len(c.newlines) > 0 && c.newlines[0] < offset {
+		c.next()
+	}
+	return c.line + 1
+}
+
+// lineStart returns the offset of the start of a line (1-based). If the line
+// has not been written it returns the number of bytes written.
+func (c *lineCounter) lineStart(line uint64) int64 {
+	for len(c.newlines) > 0 && c.line+1 < line {
+		c.next()
+	}
+	if c.line+1 < line {
+		return c.written
+	}
+	return c.start
+}
+
+func (c *lineCounter) next() {
+	c.line++
+	c.start = c.newlines[0] + 1
+	c.newlines = c.newlines[1:]
+}
@@ -0,0 +1,386 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+)
+
+// decodedInput is an inputEvent in a form that is easy to compare.
+type decodedInput struct {
+	Line  uint64
+	Event string // JSON
+	Error string
+}
+
+// testInputConfig returns an input config with the default flag values.
+func testInputConfig(format string) inputConfig {
+	var c inputConfig
+	c.addFlags(flag.NewFlagSet("test", flag.ContinueOnError))
+	c.format = format
+	return c
+}
+
+func readAllInput(t *testing.T, c inputConfig, input string) ([]decodedInput, error) {
+	t.Helper()
+
+	events := make(chan inputEvent)
+	var readErr error
+	go func() {
+		defer close(events)
+		readErr = readInput(strings.NewReader(input), c, events)
+	}()
+
+	var decoded []decodedInput
+	for e := range events {
+		d := decodedInput{Line: e.lineNumber}
+		if e.err != nil {
+			d.Error = e.err.Error()
+		} else {
+			data, err := json.Marshal(e.event)
+			require.NoError(t, err)
+			d.Event = string(data)
+		}
+		decoded = append(decoded, d)
+	}
+	return decoded, readErr
+}
+
+func TestReadInput(t *testing.T) {
+	testCases := []struct {
+		name   string
+		format string
+		input  string
+		events []decodedInput
+	}{
+		{
+			name:   "raw",
+			format: inputFormatRaw,
+			input:  "hello\n\n  {\"a\":1}  \n",
+			events: []decodedInput{
+				{Line: 1, Event: `{"@metadata":{"line_number":1},"event":{"original":"hello"}}`},
+				{Line: 3, Event: `{"@metadata":{"line_number":3},"event":{"original":"{\"a\":1}"}}`},
+			},
+		},
+		{
+			name:   "ndjson",
+			format: inputFormatNDJSON,
+			input: `{"message":"hello","event":{"severity":3}}
+
+{"message":
+[1, 2]
+null
+{"@metadata":"not an object"}
+{"message":"world"}
+`,
+			events: []decodedInput{
+				{Line: 1, Event: `{"@metadata":{"line_number":1},"event":{"severity":3},"message":"hello"}`},
+				{Line: 3, Error: "failed to decode input: unexpected end of JSON input"},
+				{Line: 4, Error: "failed to decode input: input is not a JSON object"},
+				{Line: 5, Error: "failed to decode input: input is not a JSON object"},
+				{Line: 6, Error: "failed to decode input: event put failed for path </@metadata/line_number>: " + event.ErrTargetKeyNotObject.Error()},
+				{Line: 7, Event: `{"@metadata":{"line_number":7},"message":"world"}`},
+			},
+		},
+		{
+			name:   "csv",
+			format: inputFormatCSV,
+			input: `source.ip,source.port,message
+10.0.0.1,53,"multi
+line"
+10.0.0.2,80
+10.0.0.3,443,"bad "quote"
+10.0.0.4,22,ssh
+`,
+			events: []decodedInput{
+				{Line: 2, Event: `{"@metadata":{"line_number":2},"message":"multi\nline","source":{"ip":"10.0.0.1","port":"53"}}`},
+				{Line: 4, Error: "failed to decode input: wrong number of fields"},
+				{Line: 5, Error: `failed to decode input: extraneous or missing " in quoted-field`},
+				{Line: 6, Event: `{"@metadata":{"line_number":6},"message":"ssh","source":{"ip":"10.0.0.4","port":"22"}}`},
+			},
+		},
+		{
+			name:   "csv empty",
+			format: inputFormatCSV,
+		},
+		{
+			name:   "json-array",
+			format: inputFormatJSONArray,
+			input: `[
+  {"message": "hello"},
+  "not an object",
+  {
+    "message": "world",
+    "tags": ["a", "b"]
+  }
+]
+`,
+			events: []decodedInput{
+				{Line: 2, Event: `{"@metadata":{"line_number":2},"message":"hello"}`},
+				{Line: 3, Error: "failed to decode input: input is not a JSON object"},
+				{Line: 4, Event: `{"@metadata":{"line_number":4},"message":"world","tags":["a","b"]}`},
+			},
+		},
+		{
+			name:   "json-array empty",
+			format: inputFormatJSONArray,
+			input:  " ",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			events, err := readAllInput(t, testInputConfig(tc.format), tc.input)
+			require.NoError(t, err)
+			assert.Equal(t, tc.events, events)
+		})
+	}
+}
+
+func TestReadInputErrors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		format string
+		input  string
+		err    string
+	}{
+		{"unknown format", "xml", "<a/>", `invalid -input-format "xml"`},
+		{"csv empty header", inputFormatCSV, "a,,c\n1,2,3\n", "CSV header column 2 has no name"},
+		{"json-array not an array", inputFormatJSONArray, `{"a": 1}`, "input is not a JSON array"},
+		{"json-array malformed", inputFormatJSONArray, `[{"a": 1}, {"a": }]`, "invalid character"},
+		{"json-array trailing data", inputFormatJSONArray, `[{"a": 1}] [{"a": 2}]`, "unexpected data after the JSON array"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := readAllInput(t, testInputConfig(tc.format), tc.input)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
+
+func TestProcessInputDecodeErrors(t *testing.T) {
+	defer func(c inputConfig) { input = c }(input)
+	input = testInputConfig(inputFormatNDJSON)
+
+	process := func(evt *event.Event) (*event.Event, error) { return evt, nil }
+
+	var out bytes.Buffer
+	require.NoError(t, processInput(context.Background(), strings.NewReader("{\"n\":1}\nnot json\n{\"n\":3}\n"), &out, process))
+
+	assert.Equal(t,
+		`{"@metadata":{"line_number":1},"n":1}`+"\n"+`{"@metadata":{"line_number":3},"n":3}`+"\n",
+		out.String())
+}
+
+func TestReadInputLongLines(t *testing.T) {
+	long := strings.Repeat("x", 100*1024)
+
+	// Lines longer than the bufio.Scanner limit are read.
+	events, err := readAllInput(t, testInputConfig(inputFormatRaw), long+"\nshort\n")
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, `{"@metadata":{"line_number":1},"event":{"original":"`+long+`"}}`, events[0].Event)
+
+	// Lines longer than -max-bytes are truncated.
+	c := testInputConfig(inputFormatRaw)
+	c.maxBytes = 5
+	events, err = readAllInput(t, c, "hello\nhello world\r\nhéllo\n"+long)
+	require.NoError(t, err)
+	assert.Equal(t, []decodedInput{
+		{Line: 1, Event: `{"@metadata":{"line_number":1},"event":{"original":"hello"}}`},
+		{Line: 2, Event: `{"@metadata":{"line_number":2},"event":{"original":"hello"},"log":{"flags":["truncated"]}}`},
+		// The truncation does not split the two byte é.
+		{Line: 3, Event: `{"@metadata":{"line_number":3},"event":{"original":"héll"},"log":{"flags":["truncated"]}}`},
+		{Line: 4, Event: `{"@metadata":{"line_number":4},"event":{"original":"xxxxx"},"log":{"flags":["truncated"]}}`},
+	}, events)
+
+	// Truncated ndjson lines are errors.
+	c.format = inputFormatNDJSON
+	c.maxBytes = 10
+	events, err = readAllInput(t, c, `{"a":1}`+"\n"+`{"message":"hello"}`+"\n")
+	require.NoError(t, err)
+	assert.Equal(t, []decodedInput{
+		{Line: 1, Event: `{"@metadata":{"line_number":1},"a":1}`},
+		{Line: 2, Error: "failed to decode input: line was truncated because it exceeds -max-bytes"},
+	}, events)
+}
+
+const javaStackTrace = `2022-11-05 10:30:00 ERROR Request failed
+java.lang.IllegalStateException: boom
+    at com.example.App.handle(App.java:42)
+    at com.example.App.main(App.java:10)
+
+2022-11-05 10:30:01 INFO Request completed
+`
+
+func TestReadMultiline(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config func(c *inputConfig)
+		input  string
+		events []decodedInput
+	}{
+		{
+			name: "negate after",
+			config: func(c *inputConfig) {
+				c.multiline.pattern = `^\d{4}-\d{2}-\d{2}`
+				c.multiline.negate = true
+			},
+			input: javaStackTrace,
+			events: []decodedInput{
+				{Line: 1, Event: `{"@metadata":{"line_number":1},"event":{"original":"2022-11-05 10:30:00 ERROR Request failed\njava.lang.IllegalStateException: boom\n    at com.example.App.handle(App.java:42)\n    at com.example.App.main(App.java:10)\n"}}`},
+				{Line: 6, Event: `{"@metadata":{"line_number":6},"event":{"original":"2022-11-05 10:30:01 INFO Request completed"}}`},
+			},
+		},
+		{
+			name: "after",
+			config: func(c *inputConfig) {
+				c.multiline.pattern = `^\s`
+			},
+			input: "first\n  second\n  third\nfourth\n",
+			events: []decodedInput{
+				{Line: 1, Event: `{"@metadata":{"line_number":1},"event":{"original":"first\n  second\n  third"}}`},
+				{Line: 4, Event: `{"@metadata":{"line_number":4},"event":{"original":"fourth"}}`},
+			},
+		},
+		{
+			name: "before",
+			config: func(c *inputConfig) {
+				c.multiline.pattern = `\\$`
+				c.multiline.match = multilineMatchBefore
+			},
+			input: "one \\\ntwo \\\nthree\nfour\n",
+			events: []decodedInput{
+				{Line: 1, Event: `{"@metadata":{"line_number":1},"event":{"original":"one \\\ntwo \\\nthree"}}`},
+				{Line: 4, Event: `{"@metadata":{"line_number":4},"event":{"original":"four"}}`},
+			},
+		},
+		{
+			name: "max lines",
+			config: func(c *inputConfig) {
+				c.multiline.pattern = `^\s`
+				c.multiline.maxLines = 2
+			},
+			input: "first\n  second\n  third\nfourth\n",
+			events: []decodedInput{
+				{Line: 1, Event: `{"@metadata":{"line_number":1},"event":{"original":"first\n  second"},"log":{"flags":["truncated"]}}`},
+				{Line: 4, Event: `{"@metadata":{"line_number":4},"event":{"original":"fourth"}}`},
+			},
+		},
+		{
+			name: "max bytes",
+			config: func(c *inputConfig) {
+				c.multiline.pattern = `^\s`
+				c.maxBytes = 10
+			},
+			input: "first\n  second\nthird\n",
+			events: []decodedInput{
+				{Line: 1, Event: `{"@metadata":{"line_number":1},"event":{"original":"first\n  se"},"log":{"flags":["truncated"]}}`},
+				{Line: 3, Event: `{"@metadata":{"line_number":3},"event":{"original":"third"}}`},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			c := testInputConfig(inputFormatRaw)
+			tc.config(&c)
+
+			events, err := readAllInput(t, c, tc.input)
+			require.NoError(t, err)
+			assert.Equal(t, tc.events, events)
+		})
+	}
+}
+
+func TestReadMultilineTimeout(t *testing.T) {
+	c := testInputConfig(inputFormatRaw)
+	c.multiline.pattern = `^\s`
+	c.multiline.timeout = 10 * time.Millisecond
+
+	r, w := io.Pipe()
+	events := make(chan inputEvent)
+	done := make(chan error, 1)
+	go func() {
+		defer close(events)
+		done <- readInput(r, c, events)
+	}()
+
+	// The pending event is sent after the timeout even though the input has
+	// not ended.
+	_, err := io.WriteString(w, "first\n  second\n")
+	require.NoError(t, err)
+	select {
+	case e := <-events:
+		v := e.event.Get("event.original")
+		require.NotNil(t, v)
+		assert.Equal(t, "first\n  second", v.String)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the multiline event")
+	}
+
+	require.NoError(t, w.Close())
+	for range events {
+		t.Fatal("unexpected event")
+	}
+	require.NoError(t, <-done)
+}
+
+func TestInputConfigCheck(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config func(c *inputConfig)
+		err    string
+	}{
+		{"max bytes", func(c *inputConfig) { c.maxBytes = 0 }, "-max-bytes must be at least 1"},
+		{"multiline format", func(c *inputConfig) { c.multiline.pattern = "^ "; c.format = inputFormatNDJSON }, "-multiline-pattern can only be used with -input-format raw"},
+		{"multiline pattern", func(c *inputConfig) { c.multiline.pattern = "(" }, "invalid -multiline-pattern"},
+		{"multiline match", func(c *inputConfig) { c.multiline.pattern = "^ "; c.multiline.match = "around" }, `invalid -multiline-match "around"`},
+		{"multiline max lines", func(c *inputConfig) { c.multiline.pattern = "^ "; c.multiline.maxLines = 0 }, "-multiline-max-lines must be at least 1"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			c := testInputConfig(inputFormatRaw)
+			tc.config(&c)
+			err := c.check()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.err)
+		})
+	}
+	c := testInputConfig(inputFormatRaw)
+	assert.NoError(t, c.check())
+}
@@ -0,0 +1,110 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/andrewkroh/go-sawmill/pkg/metrics"
+	"github.com/andrewkroh/go-sawmill/pkg/serialization/encoder"
+)
+
+// listenCommand receives events from the network, processes them with the
+// pipeline, and writes the output like the main command. syslog is the only
+// mode.
+func listenCommand(args []string) error {
+	if len(args) == 0 || args[0] != "syslog" {
+		fmt.Fprintf(os.Stderr, "Usage: %s listen syslog [flags]\n", os.Args[0])
+		return errors.New("listen requires the syslog mode")
+	}
+
+	var (
+		paths stringsFlag
+		c     syslogConfig
+	)
+	fs := flag.NewFlagSet("listen syslog", flag.ExitOnError)
+	fs.Var(&paths, "p", "pipeline definition file or directory of files (can be repeated)")
+	id := fs.String("pipeline", "", "ID of the pipeline used to process the messages (defaults to the first pipeline loaded)")
+	fs.StringVar(&c.udpAddr, "udp", "", "UDP listen address (e.g. localhost:514)")
+	fs.StringVar(&c.tcpAddr, "tcp", "", "TCP listen address (e.g. localhost:514)")
+	fs.StringVar(&c.unixPath, "unix", "", "path of a unixgram socket to listen on (e.g. /dev/log)")
+	fs.IntVar(&c.maxBytes, "max-bytes", 64*1024, "maximum size of a message in bytes (longer messages are truncated)")
+	fs.StringVar(&metricsListenAddr, "metrics-addr", "localhost:9003", "Metrics listen address.")
+	fs.DurationVar(&eventTimeout, "timeout", 0, "maximum time to process each event (0 for no limit)")
+	fs.IntVar(&workers, "workers", 1, "number of events to process concurrently (output order is preserved)")
+	fs.StringVar(&outputFormat, "output-format", encoder.FormatNDJSON, "format of the output ("+strings.Join(encoder.Formats(), ", ")+")")
+	fs.StringVar(&outputFields, "fields", "", "comma-separated list of fields written as columns by -output-format csv")
+	fs.StringVar(&dlqPath, "dlq", "", "append events that fail processing to this ndjson file (see the replay command)")
+	reload := fs.Bool("reload", false, "reload the pipelines when the pipeline files change")
+	fs.BoolVar(&strictEnv, "strict-env", false, "fail when a pipeline references an unset environment variable that has no default")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s listen syslog [flags]\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if c.udpAddr == "" && c.tcpAddr == "" && c.unixPath == "" {
+		return errors.New("at least one of -udp, -tcp, or -unix is required")
+	}
+	if c.maxBytes < 1 {
+		return errors.New("-max-bytes must be at least 1")
+	}
+	if workers < 1 {
+		return errors.New("-workers must be at least 1")
+	}
+	if _, err := newEncoder(io.Discard); err != nil {
+		return fmt.Errorf("-output-format: %w", err)
+	}
+
+	r, err := newReloader(paths, *id)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+	metrics.Listen(metricsListenAddr)
+
+	if *reload {
+		stop := r.watch()
+		defer stop()
+	}
+
+	s, err := newSyslogServer(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	for _, addr := range s.addrs() {
+		log.Printf("Listening for syslog messages on %s.", addr)
+	}
+	return processEventsFrom(os.Stdout, r.process, func(events chan<- inputEvent) error {
+		return s.serve(ctx, events)
+	})
+}
@@ -0,0 +1,268 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// registrySaveInterval is how often the registry is saved while processing.
+var registrySaveInterval = time.Second
+
+// fingerprintSize is the number of bytes at the start of a file that are
+// used to detect when a file has been replaced.
+const fingerprintSize = 1024
+
+// registry records how far each input file has been processed so that a
+// later run can resume where the previous run stopped. A file is identified by
+// its device and inode (its path on Windows) plus a fingerprint of its first
+// bytes, so that a file is recognized after it is renamed and a replaced file
+// is not.
+type registry struct {
+	path string
+
+	mu      sync.Mutex
+	entries []*registryEntry
+	changed bool
+}
+
+// registryEntry is the progress of a file. It is stored as JSON.
+type registryEntry struct {
+	Path            string `json:"path"`
+	Device          uint64 `json:"device,omitempty"`
+	Inode           uint64 `json:"inode,omitempty"`
+	Fingerprint     string `json:"fingerprint"`
+	FingerprintSize int64  `json:"fingerprint_size"`
+	Offset          int64  `json:"offset"` // Offset after the last event whose output was written.
+	Line            uint64 `json:"line"`   // Number of lines before Offset.
+}
+
+type registryFile struct {
+	Files []*registryEntry `json:"files"`
+}
+
+// loadRegistry reads the registry stored at path. The registry is empty if
+// the file does not exist.
+func loadRegistry(path string) (*registry, error) {
+	r := &registry{path: path}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return r, nil
+		}
+		return nil, err
+	}
+
+	var f registryFile
+	if err = json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid registry %s: %w", path, err)
+	}
+	r.entries = f.Files
+	return r, nil
+}
+
+// open returns a cursor that records the progress of f and the position
+// where reading f should resume. The position is zero if f has not been
+// processed before or if f has changed such that the recorded position is not
+// valid. If seekable is true then the recorded offset must be within the
+// file.
+func (r *registry) open(f *os.File, seekable bool) (*fileCursor, inputPosition, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, inputPosition{}, err
+	}
+	path, err := filepath.Abs(f.Name())
+	if err != nil {
+		return nil, inputPosition{}, err
+	}
+	fp, fpSize, err := fingerprint(f, min64(info.Size(), fingerprintSize))
+	if err != nil {
+		return nil, inputPosition{}, err
+	}
+	entry := &registryEntry{Path: path, Fingerprint: fp, FingerprintSize: fpSize}
+	entry.Device, entry.Inode, _ = fileID(info)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Replace the entry for the file. A new entry is used so that late
+	// commits for an earlier reading of the file are ignored. The entry of a
+	// different file that was at the same path is kept because the file may
+	// have been renamed.
+	var pos inputPosition
+	entries := r.entries[:0]
+	for _, e := range r.entries {
+		if !e.sameFile(entry) {
+			entries = append(entries, e)
+			continue
+		}
+		if pos == (inputPosition{}) && (!seekable || e.Offset <= info.Size()) {
+			if ok, err := e.matches(f, info.Size()); err != nil {
+				return nil, inputPosition{}, err
+			} else if ok {
+				pos = inputPosition{offset: e.Offset, line: e.Line}
+			}
+		}
+	}
+	entry.Offset, entry.Line = pos.offset, pos.line
+	r.entries = append(entries, entry)
+	r.changed = true
+
+	return &fileCursor{registry: r, entry: entry}, pos, nil
+}
+
+// sameFile returns true if the entries identify the same file.
+func (e *registryEntry) sameFile(o *registryEntry) bool {
+	if e.Inode != 0 || o.Inode != 0 {
+		return e.Device == o.Device && e.Inode == o.Inode
+	}
+	return e.Path == o.Path
+}
+
+// matches returns true if the fingerprint of f matches the entry.
+func (e *registryEntry) matches(f *os.File, size int64) (bool, error) {
+	if e.FingerprintSize > size {
+		return false, nil
+	}
+	fp, _, err := fingerprint(f, e.FingerprintSize)
+	if err != nil {
+		return false, err
+	}
+	return fp == e.Fingerprint, nil
+}
+
+// fingerprint returns the SHA-256 hash of the first size bytes of f.
+func fingerprint(f *os.File, size int64) (string, int64, error) {
+	h := sha256.New()
+	n, err := io.Copy(h, io.NewSectionReader(f, 0, size))
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// prune removes the entries of files that no longer exist at their path.
+func (r *registry) prune() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries := r.entries[:0]
+	for _, e := range r.entries {
+		info, err := os.Stat(e.Path)
+		if err != nil {
+			continue
+		}
+		if device, inode, ok := fileID(info); ok && (device != e.Device || inode != e.Inode) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) != len(r.entries) {
+		r.changed = true
+	}
+	r.entries = entries
+}
+
+// save writes the registry to its file if it has changed.
+func (r *registry) save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.changed {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(registryFile{Files: r.entries}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Replace the file atomically so that it is not corrupted by a crash.
+	tmp := r.path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, r.path); err != nil {
+		return err
+	}
+	r.changed = false
+	return nil
+}
+
+// run saves the registry periodically until the returned stop function is
+// called. stop prunes the registry and saves it a final time. Pruning is
+// deferred until then because a renamed file may be read after the file that
+// replaced it.
+func (r *registry) run(interval time.Duration) (stop func() error) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := r.save(); err != nil {
+					log.Println("Error saving registry:", err)
+				}
+			}
+		}
+	}()
+
+	return func() error {
+		close(done)
+		wg.Wait()
+		r.prune()
+		return r.save()
+	}
+}
+
+// fileCursor records the progress of an input file in the registry.
+type fileCursor struct {
+	registry *registry
+	entry    *registryEntry
+}
+
+// commit records that the output for the input before pos has been written.
+func (c *fileCursor) commit(pos inputPosition) {
+	c.registry.mu.Lock()
+	defer c.registry.mu.Unlock()
+	c.entry.Offset, c.entry.Line = pos.offset, pos.line
+	c.registry.changed = true
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,176 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+	"github.com/andrewkroh/go-sawmill/pkg/serialization/encoder"
+)
+
+// processWithRegistry processes the files using the registry stored at
+// registryPath and returns the line number and message of each output event.
+func processWithRegistry(t *testing.T, registryPath, format string, paths ...string) string {
+	t.Helper()
+
+	defer func(c inputConfig, format, fields string) {
+		input, outputFormat, outputFields = c, format, fields
+	}(input, outputFormat, outputFields)
+	outputFormat, outputFields = encoder.FormatCSV, "@metadata.line_number,message"
+
+	reg, err := loadRegistry(registryPath)
+	require.NoError(t, err)
+	input = testInputConfig(format)
+	input.paths = paths
+	input.registry = reg
+
+	process := func(evt *event.Event) (*event.Event, error) {
+		if v := evt.Get("event.original"); v != nil {
+			evt.Put("message", v)
+		}
+		return evt, nil
+	}
+
+	var out bytes.Buffer
+	stop := reg.run(time.Hour)
+	require.NoError(t, processInput(context.Background(), nil, &out, process))
+	require.NoError(t, stop())
+
+	return strings.TrimPrefix(out.String(), "@metadata.line_number,message\n")
+}
+
+func TestRegistryResume(t *testing.T) {
+	testCases := []struct {
+		name     string
+		file     string
+		format   string
+		content  string
+		appended string
+		first    string
+		second   string
+	}{
+		{
+			name:     "raw",
+			file:     "app.log",
+			format:   inputFormatRaw,
+			content:  "one\n\ntwo\n",
+			appended: "three\nfour\n",
+			first:    "1,one\n3,two\n",
+			second:   "4,three\n5,four\n",
+		},
+		{
+			name:     "ndjson",
+			file:     "app.ndjson",
+			format:   inputFormatNDJSON,
+			content:  `{"message":"one"}` + "\n",
+			appended: `{"message":"two"}` + "\n",
+			first:    "1,one\n",
+			second:   "2,two\n",
+		},
+		{
+			name:     "csv",
+			file:     "app.csv",
+			format:   inputFormatCSV,
+			content:  "message\none\n\"two\nlines\"\n",
+			appended: "three\n",
+			first:    "2,one\n3,\"two\nlines\"\n",
+			second:   "5,three\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			registryPath := filepath.Join(dir, "registry.json")
+			file := filepath.Join(dir, tc.file)
+			require.NoError(t, os.WriteFile(file, []byte(tc.content), 0o600))
+
+			assert.Equal(t, tc.first, processWithRegistry(t, registryPath, tc.format, file))
+			assert.Empty(t, processWithRegistry(t, registryPath, tc.format, file))
+
+			f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0)
+			require.NoError(t, err)
+			_, err = f.WriteString(tc.appended)
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+
+			assert.Equal(t, tc.second, processWithRegistry(t, registryPath, tc.format, file))
+		})
+	}
+}
+
+func TestRegistryCompressed(t *testing.T) {
+	dir := t.TempDir()
+	registryPath := filepath.Join(dir, "registry.json")
+	writeGzip(t, filepath.Join(dir, "app.log.1.gz"), "one\ntwo\n")
+	writeZstd(t, filepath.Join(dir, "app.log.2.zst"), "three\n")
+	pattern := filepath.Join(dir, "app.log.*")
+
+	assert.Equal(t, "1,one\n2,two\n1,three\n", processWithRegistry(t, registryPath, inputFormatRaw, pattern))
+	assert.Empty(t, processWithRegistry(t, registryPath, inputFormatRaw, pattern))
+}
+
+func TestRegistryChangedFile(t *testing.T) {
+	dir := t.TempDir()
+	registryPath := filepath.Join(dir, "registry.json")
+	file := filepath.Join(dir, "app.log")
+	pattern := filepath.Join(dir, "app.log*")
+	require.NoError(t, os.WriteFile(file, []byte("one\ntwo\n"), 0o600))
+	assert.Equal(t, "1,one\n2,two\n", processWithRegistry(t, registryPath, inputFormatRaw, pattern))
+
+	// A renamed file is recognized.
+	require.NoError(t, os.Rename(file, file+".1"))
+	require.NoError(t, os.WriteFile(file, []byte("three\n"), 0o600))
+	assert.Equal(t, "1,three\n", processWithRegistry(t, registryPath, inputFormatRaw, pattern))
+
+	// A truncated file is read from the start.
+	require.NoError(t, os.WriteFile(file, []byte("4\n"), 0o600))
+	assert.Equal(t, "1,4\n", processWithRegistry(t, registryPath, inputFormatRaw, file))
+
+	// A file that was overwritten with different content is read from the start.
+	require.NoError(t, os.WriteFile(file, []byte("5\nsix\n"), 0o600))
+	assert.Equal(t, "1,5\n2,six\n", processWithRegistry(t, registryPath, inputFormatRaw, file))
+
+	// Entries for files that no longer exist are removed.
+	require.NoError(t, os.Remove(file+".1"))
+	assert.Empty(t, processWithRegistry(t, registryPath, inputFormatRaw, file))
+	reg, err := loadRegistry(registryPath)
+	require.NoError(t, err)
+	if assert.Len(t, reg.entries, 1) {
+		assert.Equal(t, file, reg.entries[0].Path)
+		assert.EqualValues(t, 6, reg.entries[0].Offset)
+		assert.EqualValues(t, 2, reg.entries[0].Line)
+	}
+}
+
+func TestRegistryRequiresFiles(t *testing.T) {
+	c := testInputConfig(inputFormatRaw)
+	c.registry = &registry{}
+	assert.EqualError(t, c.check(), "-registry requires input files")
+}
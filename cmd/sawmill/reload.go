@@ -0,0 +1,346 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+	"github.com/andrewkroh/go-sawmill/pkg/metrics"
+	"github.com/andrewkroh/go-sawmill/pkg/pipeline"
+)
+
+const (
+	// reloadDelay is how long to wait for more changes to the pipeline files
+	// before reloading. Editors often write a file with several operations.
+	reloadDelay = 100 * time.Millisecond
+
+	// reloadPollInterval is how often the pipeline files are checked for
+	// changes when file system notifications are not available.
+	reloadPollInterval = time.Second
+)
+
+// reloader holds the pipelines used to process events and replaces them when
+// the pipeline files, or the files they include or reference, change. Events
+// are processed with the old pipelines until the new ones are loaded and
+// validated so no events are lost.
+type reloader struct {
+	paths   []string
+	id      string            // ID of the pipeline that processes events.
+	watcher *fsnotify.Watcher // Nil when polling.
+
+	mu    sync.RWMutex // Held for reading while an event is processed.
+	set   *pipeline.Set
+	pipe  *pipeline.Pipeline
+	files []string // Files read to load the pipelines.
+}
+
+// newReloader loads the pipelines from paths and registers their metrics.
+// The pipeline selected by id processes the events. If id is empty then the
+// first pipeline loaded is selected.
+func newReloader(paths []string, id string) (*reloader, error) {
+	configs, err := loadPipelines(paths)
+	if err != nil {
+		return nil, err
+	}
+	set, pipe, err := newPipelineSet(configs, id)
+	if err != nil {
+		return nil, err
+	}
+	metrics.Register(set.Metrics()...)
+
+	return &reloader{paths: paths, id: pipe.ID(), set: set, pipe: pipe, files: configFiles(configs)}, nil
+}
+
+// configFiles returns the files that were read to load the configs.
+func configFiles(configs []*pipeline.Config) []string {
+	var files []string
+	for _, c := range configs {
+		files = append(files, c.Files()...)
+	}
+	return files
+}
+
+// process processes the event with the current pipeline.
+func (r *reloader) process(evt *event.Event) (*event.Event, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return processEvent(r.pipe, evt)
+}
+
+// processWith processes the event with the pipeline with the given ID, or
+// with the current pipeline if id is empty. It returns false if there is no
+// pipeline with the ID.
+func (r *reloader) processWith(ctx context.Context, id string, evt *event.Event) (*event.Event, bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	pipe := r.pipe
+	if id != "" {
+		pipe = r.set.Get(id)
+	}
+	if pipe == nil {
+		return nil, false, nil
+	}
+	evt, err := processEventContext(ctx, pipe, evt)
+	return evt, true, err
+}
+
+// reload loads and validates the pipelines and swaps them with the current
+// pipelines. The current pipelines remain in use if there is an error.
+func (r *reloader) reload() error {
+	configs, err := loadPipelines(r.paths)
+	if err != nil {
+		return err
+	}
+	for _, c := range configs {
+		if errs := pipeline.Validate(c); len(errs) > 0 {
+			return fmt.Errorf("invalid pipeline %q: %w", c.ID, errs)
+		}
+	}
+
+	set, pipe, err := newPipelineSet(configs, r.id)
+	if err != nil {
+		return err
+	}
+
+	// Wait for in-flight events to finish before swapping.
+	r.mu.Lock()
+	old := r.set
+	r.set, r.pipe = set, pipe
+	r.files = configFiles(configs)
+	r.mu.Unlock()
+
+	if r.watcher != nil {
+		// Includes or references may have been added.
+		if err := r.watchDirs(); err != nil {
+			log.Println("Error watching pipeline files:", err)
+		}
+	}
+
+	metrics.Unregister(old.Metrics()...)
+	metrics.Register(set.Metrics()...)
+	if err := old.Close(); err != nil {
+		log.Println("Error closing old pipelines:", err)
+	}
+	return nil
+}
+
+// close unregisters the metrics and closes the pipelines.
+func (r *reloader) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	metrics.Unregister(r.set.Metrics()...)
+	return r.set.Close()
+}
+
+// watch reloads the pipelines when the pipeline files, or the files they
+// include or reference, change until the returned function is called. Changes are detected using file system
+// notifications or, if they are unavailable, by polling.
+func (r *reloader) watch() (stop func()) {
+	done := make(chan struct{})
+	changes, err := r.notifications(done)
+	if err != nil {
+		log.Printf("File system notifications are unavailable (%v), polling for pipeline changes every %v.", err, reloadPollInterval)
+		changes = r.poll(done)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		var timer <-chan time.Time
+		for {
+			select {
+			case <-done:
+				return
+			case <-changes:
+				timer = time.After(reloadDelay)
+			case <-timer:
+				timer = nil
+				if err := r.reload(); err != nil {
+					log.Println("Pipeline reload failed, continuing with the previous pipelines:", err)
+					continue
+				}
+				log.Printf("Reloaded pipelines from %v.", r.paths)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// notifications returns a channel that receives a value when a pipeline file
+// changes. The directories of the pipeline files are watched because editors
+// often replace files rather than writing them in place.
+func (r *reloader) notifications(done <-chan struct{}) (<-chan struct{}, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	r.watcher = w
+	if err = r.watchDirs(); err != nil {
+		r.watcher = nil
+		w.Close()
+		return nil, err
+	}
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer w.Close()
+		for {
+			select {
+			case <-done:
+				return
+			case e := <-w.Events:
+				if !r.isPipelineFile(e.Name) {
+					continue
+				}
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			case err := <-w.Errors:
+				log.Println("Error watching pipeline files:", err)
+			}
+		}
+	}()
+	return changes, nil
+}
+
+// watchDirs adds the directories of the pipeline files and of the files they
+// include or reference to the watcher.
+func (r *reloader) watchDirs() error {
+	r.mu.RLock()
+	files := r.files
+	r.mu.RUnlock()
+
+	dirs := map[string]bool{}
+	for _, path := range r.paths {
+		dir := path
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			dir = filepath.Dir(path)
+		}
+		dirs[filepath.Clean(dir)] = true
+	}
+	for _, f := range files {
+		dirs[filepath.Dir(f)] = true
+	}
+	for dir := range dirs {
+		if err := r.watcher.Add(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isPipelineFile returns true if the file is one of the pipeline files, is in
+// one of the pipeline directories, or was read to load the pipelines.
+func (r *reloader) isPipelineFile(name string) bool {
+	name = filepath.Clean(name)
+	if abs, err := filepath.Abs(name); err == nil {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		for _, f := range r.files {
+			if abs == f {
+				return true
+			}
+		}
+	}
+	for _, path := range r.paths {
+		path = filepath.Clean(path)
+		if name == path {
+			return true
+		}
+		if filepath.Dir(name) == path {
+			switch filepath.Ext(name) {
+			case ".yml", ".yaml", ".json":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// modification times of the files returned by fingerprint change.
+// modification times of the pipeline files change.
+func (r *reloader) poll(done <-chan struct{}) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+	last := r.fingerprint()
+	go func() {
+		ticker := time.NewTicker(reloadPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if current := r.fingerprint(); current != last {
+					last = current
+					select {
+					case changes <- struct{}{}:
+					default:
+					}
+				}
+			}
+		}
+	}()
+	return changes
+}
+
+// fingerprint returns a string that changes when the pipeline files, or the
+// files they include or reference, change.
+func (r *reloader) fingerprint() string {
+	r.mu.RLock()
+	files := append([]string(nil), r.files...)
+	r.mu.RUnlock()
+	for _, path := range r.paths {
+		f, err := pipelineFilesInPath(path)
+		if err != nil {
+			files = append(files, path+":"+err.Error())
+			continue
+		}
+		files = append(files, f...)
+	}
+	sort.Strings(files)
+
+	var fp string
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil {
+			fp += fmt.Sprintf("%s:%d:%d\n", f, info.Size(), info.ModTime().UnixNano())
+		} else {
+			fp += f + "\n"
+		}
+	}
+	return fp
+}
@@ -0,0 +1,196 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+)
+
+func writeCasePipeline(t *testing.T, path, processor string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(`id: case
+processors:
+  - `+processor+`:
+      field: event.original
+      target_field: message
+`), 0o644))
+}
+
+func processMessage(t *testing.T, r *reloader, msg string) string {
+	t.Helper()
+
+	evt := event.New()
+	evt.Put("event.original", event.String(msg))
+	evt, err := r.process(evt)
+	require.NoError(t, err)
+
+	v := evt.Get("message")
+	require.NotNil(t, v)
+	return v.String
+}
+
+func TestReloaderReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "case.yml")
+	writeCasePipeline(t, path, "uppercase")
+
+	r, err := newReloader([]string{path}, "")
+	require.NoError(t, err)
+	defer r.close()
+	assert.Equal(t, "HELLO", processMessage(t, r, "Hello"))
+
+	writeCasePipeline(t, path, "lowercase")
+	require.NoError(t, r.reload())
+	assert.Equal(t, "hello", processMessage(t, r, "Hello"))
+
+	// Invalid pipelines are not loaded.
+	writeCasePipeline(t, path, "lowercse")
+	err = r.reload()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown processor type "lowercse"`)
+	assert.Equal(t, "hello", processMessage(t, r, "Hello"))
+
+	// The selected pipeline must still exist.
+	require.NoError(t, os.WriteFile(path, []byte("id: other\nprocessors: []\n"), 0o644))
+	err = r.reload()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pipeline <case> was not loaded")
+	assert.Equal(t, "hello", processMessage(t, r, "Hello"))
+}
+
+func TestReloaderConcurrentReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "case.yml")
+	writeCasePipeline(t, path, "uppercase")
+
+	r, err := newReloader([]string{path}, "case")
+	require.NoError(t, err)
+	defer r.close()
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				evt := event.New()
+				evt.Put("event.original", event.String("Hello"))
+				if _, err := r.process(evt); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, r.reload())
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestReloaderWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "case.yml")
+	writeCasePipeline(t, path, "uppercase")
+
+	r, err := newReloader([]string{dir}, "")
+	require.NoError(t, err)
+	defer r.close()
+
+	stop := r.watch()
+	defer stop()
+
+	writeCasePipeline(t, path, "lowercase")
+	assert.Eventually(t, func() bool {
+		return processMessage(t, r, "Hello") == "hello"
+	}, 10*time.Second, 50*time.Millisecond)
+}
+
+func TestReloaderWatchIncludes(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "pipelines"), 0o755))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "common"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pipelines", "case.yml"), []byte(`id: case
+processors:
+  - include: ../common/case.yml
+`), 0o644))
+	included := filepath.Join(dir, "common", "case.yml")
+	writeCaseProcessors := func(processor string) {
+		require.NoError(t, os.WriteFile(included, []byte(`- `+processor+`:
+    field: event.original
+    target_field: message
+`), 0o644))
+	}
+	writeCaseProcessors("uppercase")
+
+	r, err := newReloader([]string{filepath.Join(dir, "pipelines")}, "")
+	require.NoError(t, err)
+	defer r.close()
+	assert.True(t, r.isPipelineFile(included))
+
+	stop := r.watch()
+	defer stop()
+
+	writeCaseProcessors("lowercase")
+	assert.Eventually(t, func() bool {
+		return processMessage(t, r, "Hello") == "hello"
+	}, 10*time.Second, 50*time.Millisecond)
+}
+
+func TestReloaderPoll(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "case.yml")
+	writeCasePipeline(t, path, "uppercase")
+
+	r := &reloader{paths: []string{path}}
+	done := make(chan struct{})
+	defer close(done)
+	changes := r.poll(done)
+
+	writeCasePipeline(t, path, "lowercase")
+	select {
+	case <-changes:
+	case <-time.After(10 * reloadPollInterval):
+		t.Fatal("change was not detected")
+	}
+}
+
+func TestReloaderIsPipelineFile(t *testing.T) {
+	r := &reloader{paths: []string{"pipelines", "other/app.yml"}}
+
+	assert.True(t, r.isPipelineFile("pipelines/a.yml"))
+	assert.True(t, r.isPipelineFile("pipelines/b.json"))
+	assert.True(t, r.isPipelineFile("other/app.yml"))
+	assert.False(t, r.isPipelineFile("pipelines/a.yml.swp"))
+	assert.False(t, r.isPipelineFile("pipelines/nested/a.yml"))
+	assert.False(t, r.isPipelineFile("other/unrelated.yml"))
+}
@@ -0,0 +1,391 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/peterh/liner"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+	"github.com/andrewkroh/go-sawmill/pkg/pipeline"
+)
+
+// replHelp describes the REPL commands.
+const replHelp = `Enter a line to process it as event.original, or a JSON object to process it
+as an event. A JSON object may span multiple lines.
+
+Commands:
+  :help                 show this help
+  :processors           list the processors of the pipeline with their configs
+  :pipeline [id]        list the pipelines or select the pipeline that processes events
+  :reload               reload the pipeline files
+  :set [field [value]]  list the fields added to each event or add a field (the
+                        value is JSON, or a string if it is not valid JSON)
+  :unset field          stop adding a field to each event
+  :quit                 exit (or Ctrl-D)
+`
+
+// replCommand runs an interactive session that processes each event or line
+// entered with the pipeline and shows the output with a trace of the
+// processors.
+func replCommand(args []string) error {
+	var paths stringsFlag
+	fs := flag.NewFlagSet("repl", flag.ExitOnError)
+	fs.Var(&paths, "p", "pipeline definition file or directory of files (can be repeated)")
+	id := fs.String("pipeline", "", "ID of the pipeline used to process the input (defaults to the first pipeline loaded)")
+	history := fs.String("history", defaultHistoryPath(), "file that stores the input history (empty to disable)")
+	fs.BoolVar(&strictEnv, "strict-env", false, "fail when a pipeline references an unset environment variable that has no default")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s repl [flags]\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	r, err := newREPL(paths, *id, os.Stdout)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+
+	line := liner.NewLiner()
+	defer line.Close()
+	line.SetCtrlCAborts(true)
+
+	if *history != "" {
+		if f, err := os.Open(*history); err == nil {
+			line.ReadHistory(f)
+			f.Close()
+		}
+		defer func() {
+			if err := writeHistory(line, *history); err != nil {
+				fmt.Fprintln(os.Stderr, "Error saving history:", err)
+			}
+		}()
+	}
+
+	fmt.Fprintln(r.out, "Type :help for help.")
+	for {
+		input, err := readREPLInput(line, r.prompt())
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				fmt.Fprintln(r.out)
+				return nil
+			}
+			return err
+		}
+		if input == "" {
+			continue
+		}
+		line.AppendHistory(input)
+		if quit := r.eval(input); quit {
+			return nil
+		}
+	}
+}
+
+// defaultHistoryPath returns the path of the history file in the user's home
+// directory, or an empty string if there is no home directory.
+func defaultHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".sawmill_history")
+}
+
+// writeHistory writes the history of the line editor to path.
+func writeHistory(line *liner.State, path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err = line.WriteHistory(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readREPLInput reads the next input. The lines of a JSON object are read
+// until it is complete and returned compacted to a single line. Ctrl-C
+// discards the input being entered.
+func readREPLInput(line *liner.State, prompt string) (string, error) {
+	var input string
+	next := prompt
+	for {
+		text, err := line.Prompt(next)
+		if err != nil {
+			if errors.Is(err, liner.ErrPromptAborted) {
+				input, next = "", prompt
+				continue
+			}
+			return "", err
+		}
+		if input != "" {
+			input += "\n"
+		}
+		input += text
+
+		if !incompleteJSON(input) {
+			break
+		}
+		next = strings.Repeat(".", len(prompt)-1) + " "
+	}
+
+	input = strings.TrimSpace(input)
+	var buf bytes.Buffer
+	if strings.HasPrefix(input, "{") && json.Compact(&buf, []byte(input)) == nil {
+		input = buf.String()
+	}
+	return input, nil
+}
+
+// incompleteJSON returns true if s begins a JSON object that is not complete.
+func incompleteJSON(s string) bool {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "{") {
+		return false
+	}
+	var v json.RawMessage
+	err := json.NewDecoder(strings.NewReader(s)).Decode(&v)
+	return errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// repl evaluates the input of an interactive session.
+type repl struct {
+	pipelines *reloader
+	fields    map[string]*event.Value // Fields added to each event by :set.
+	out       io.Writer
+}
+
+// newREPL loads the pipelines from paths for a session that writes to out.
+// The pipeline selected by id processes the events. If id is empty then the
+// first pipeline loaded is selected.
+func newREPL(paths []string, id string, out io.Writer) (*repl, error) {
+	r, err := newReloader(paths, id)
+	if err != nil {
+		return nil, err
+	}
+	return &repl{pipelines: r, fields: map[string]*event.Value{}, out: out}, nil
+}
+
+// close closes the pipelines.
+func (r *repl) close() error {
+	return r.pipelines.close()
+}
+
+// prompt returns the prompt, which shows the ID of the current pipeline.
+func (r *repl) prompt() string {
+	return r.pipelines.id + "> "
+}
+
+// eval evaluates a command or processes an event. It returns true if the
+// session should end.
+func (r *repl) eval(input string) (quit bool) {
+	if !strings.HasPrefix(input, ":") {
+		r.process(input)
+		return false
+	}
+
+	name, args := input, ""
+	if i := strings.IndexAny(input, " \t"); i >= 0 {
+		name, args = input[:i], strings.TrimSpace(input[i+1:])
+	}
+
+	switch name {
+	case ":help":
+		fmt.Fprint(r.out, replHelp)
+	case ":processors":
+		r.listProcessors()
+	case ":pipeline":
+		r.selectPipeline(args)
+	case ":reload":
+		if err := r.pipelines.reload(); err != nil {
+			fmt.Fprintln(r.out, "Error:", err)
+			return false
+		}
+		fmt.Fprintf(r.out, "Reloaded %d pipelines.\n", len(r.pipelines.set.IDs()))
+	case ":set":
+		r.setField(args)
+	case ":unset":
+		if _, found := r.fields[args]; !found {
+			fmt.Fprintf(r.out, "Error: field %q is not set\n", args)
+			return false
+		}
+		delete(r.fields, args)
+	case ":quit", ":exit":
+		return true
+	default:
+		fmt.Fprintf(r.out, "Error: unknown command %q (type :help for help)\n", name)
+	}
+	return false
+}
+
+// process decodes the input as an event, processes it with the current
+// pipeline, and writes a trace of the processors followed by the output.
+func (r *repl) process(input string) {
+	var (
+		evt *event.Event
+		err error
+	)
+	if strings.HasPrefix(input, "{") {
+		evt, err = decodeEvent([]byte(input))
+	} else {
+		evt, err = rawEvent(input, false)
+	}
+	if err != nil {
+		fmt.Fprintln(r.out, "Error: failed to decode input:", err)
+		return
+	}
+	for _, field := range r.sortedFields() {
+		if _, err = evt.Put(field, r.fields[field].Clone()); err != nil {
+			fmt.Fprintf(r.out, "Error: failed to set %s: %v\n", field, err)
+			return
+		}
+	}
+
+	writeSimulateResult(r.out, r.pipelines.pipe.Simulate(evt))
+}
+
+// writeSimulateResult writes the status and changes of each processor
+// followed by the output event.
+func writeSimulateResult(out io.Writer, result *pipeline.SimulateResult) {
+	for _, p := range result.ProcessorResults {
+		fmt.Fprintf(out, "  %-13s %s", p.Status, p.ProcessorID)
+		if p.Status != pipeline.StatusSkipped {
+			fmt.Fprintf(out, " (%v)", p.Elapsed.Round(time.Microsecond))
+		}
+		if p.Err != nil {
+			fmt.Fprintf(out, ": %v", p.Err)
+		}
+		fmt.Fprintln(out)
+		for _, c := range p.Changes {
+			switch c.Op {
+			case event.ChangeAdd:
+				fmt.Fprintf(out, "      + %s: %s\n", c.Key, jsonValue(c.New))
+			case event.ChangeRemove:
+				fmt.Fprintf(out, "      - %s: %s\n", c.Key, jsonValue(c.Old))
+			default:
+				fmt.Fprintf(out, "      ~ %s: %s -> %s\n", c.Key, jsonValue(c.Old), jsonValue(c.New))
+			}
+		}
+	}
+
+	switch {
+	case result.Err != nil:
+		fmt.Fprintln(out, "Error:", result.Err)
+	case result.Dropped:
+		fmt.Fprintln(out, "Dropped.")
+	default:
+		enc := json.NewEncoder(out)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		enc.Encode(result.Event)
+	}
+}
+
+// jsonValue returns v as JSON.
+func jsonValue(v interface{}) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// listProcessors writes the ID and config of each processor of the current
+// pipeline.
+func (r *repl) listProcessors() {
+	for _, p := range r.pipelines.pipe.Processors() {
+		fmt.Fprintf(r.out, "%s\n    %s\n", p.ID, p.Config)
+	}
+}
+
+// selectPipeline selects the pipeline with the given ID to process events. If
+// id is empty then the IDs of the pipelines are listed.
+func (r *repl) selectPipeline(id string) {
+	if id == "" {
+		for _, pipelineID := range r.pipelines.set.IDs() {
+			marker := " "
+			if pipelineID == r.pipelines.id {
+				marker = "*"
+			}
+			fmt.Fprintf(r.out, "%s %s\n", marker, pipelineID)
+		}
+		return
+	}
+
+	pipe := r.pipelines.set.Get(id)
+	if pipe == nil {
+		fmt.Fprintf(r.out, "Error: pipeline <%s> was not loaded\n", id)
+		return
+	}
+	r.pipelines.id, r.pipelines.pipe = id, pipe
+}
+
+// setField adds a field to each event. The args are the field and a JSON
+// value. A value that is not valid JSON is a string. If args is empty then
+// the fields are listed.
+func (r *repl) setField(args string) {
+	if args == "" {
+		for _, field := range r.sortedFields() {
+			fmt.Fprintf(r.out, "%s: %s\n", field, jsonValue(r.fields[field]))
+		}
+		return
+	}
+
+	field, value := args, ""
+	if i := strings.IndexAny(args, " \t"); i >= 0 {
+		field, value = args[:i], strings.TrimSpace(args[i+1:])
+	}
+	if value == "" {
+		fmt.Fprintln(r.out, "Error: usage is :set field value")
+		return
+	}
+
+	v := &event.Value{}
+	if err := json.Unmarshal([]byte(value), v); err != nil {
+		v = event.String(value)
+	}
+	r.fields[field] = v
+}
+
+// sortedFields returns the fields added by :set in lexical order.
+func (r *repl) sortedFields() []string {
+	fields := make([]string, 0, len(r.fields))
+	for field := range r.fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
@@ -0,0 +1,139 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestREPL returns a REPL session for the pipeline definitions and the
+// buffer that receives its output.
+func newTestREPL(t *testing.T, definitions ...string) (*repl, *bytes.Buffer, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	for i, d := range definitions {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, string(rune('a'+i))+".yml"), []byte(d), 0o600))
+	}
+	var out bytes.Buffer
+	r, err := newREPL([]string{dir}, "", &out)
+	require.NoError(t, err)
+	t.Cleanup(func() { r.close() })
+	return r, &out, dir
+}
+
+// evalOutput evaluates the input and returns the output.
+func evalOutput(t *testing.T, r *repl, out *bytes.Buffer, input string) string {
+	t.Helper()
+	out.Reset()
+	assert.False(t, r.eval(input))
+	return out.String()
+}
+
+func TestREPLProcess(t *testing.T) {
+	r, out, _ := newTestREPL(t, uppercasePipeline)
+
+	output := evalOutput(t, r, out, `{"message":"hello"}`)
+	assert.Contains(t, output, "  success       uppercase.processors[1].uppercase (")
+	assert.Contains(t, output, `      ~ message: "hello" -> "HELLO"`)
+	assert.Contains(t, output, "{\n  \"message\": \"HELLO\"\n}\n")
+
+	output = evalOutput(t, r, out, `{"message":"drop"}`)
+	assert.Contains(t, output, "  dropped       uppercase.processors[0].drop (")
+	assert.Contains(t, output, "Dropped.\n")
+
+	// Lines that are not JSON objects are event.original.
+	output = evalOutput(t, r, out, "hello")
+	assert.Contains(t, output, "  error         uppercase.processors[1].uppercase (")
+	assert.Contains(t, output, "Error: processor <uppercase.processors[1].uppercase>")
+
+	output = evalOutput(t, r, out, `{"message":`)
+	assert.Contains(t, output, "Error: failed to decode input:")
+}
+
+func TestREPLSet(t *testing.T) {
+	r, out, _ := newTestREPL(t, uppercasePipeline)
+
+	assert.Empty(t, evalOutput(t, r, out, ":set labels.env prod"))
+	assert.Empty(t, evalOutput(t, r, out, ":set event.severity 3"))
+	assert.Equal(t, "event.severity: 3\nlabels.env: \"prod\"\n", evalOutput(t, r, out, ":set"))
+	assert.Contains(t, evalOutput(t, r, out, `{"message":"a"}`), `"labels": {`+"\n    \"env\": \"prod\"")
+
+	assert.Equal(t, "Error: usage is :set field value\n", evalOutput(t, r, out, ":set labels.env"))
+	assert.Empty(t, evalOutput(t, r, out, ":unset labels.env"))
+	assert.Equal(t, "Error: field \"labels.env\" is not set\n", evalOutput(t, r, out, ":unset labels.env"))
+	assert.Equal(t, "event.severity: 3\n", evalOutput(t, r, out, ":set"))
+}
+
+func TestREPLSetIsNotModified(t *testing.T) {
+	r, out, _ := newTestREPL(t, "id: tags\nprocessors:\n  - append:\n      field: tags\n      value: b\n")
+
+	assert.Empty(t, evalOutput(t, r, out, `:set tags ["a"]`))
+	for i := 0; i < 2; i++ {
+		assert.Contains(t, evalOutput(t, r, out, `{}`), "\"tags\": [\n    \"a\",\n    \"b\"\n  ]\n")
+	}
+	assert.Equal(t, "tags: [\"a\"]\n", evalOutput(t, r, out, ":set"))
+}
+
+func TestREPLCommands(t *testing.T) {
+	r, out, dir := newTestREPL(t, uppercasePipeline, "id: lowercase\nprocessors:\n  - lowercase:\n      field: message\n")
+
+	assert.Equal(t, "  lowercase\n* uppercase\n", evalOutput(t, r, out, ":pipeline"))
+	assert.Empty(t, evalOutput(t, r, out, ":pipeline lowercase"))
+	assert.Equal(t, "lowercase> ", r.prompt())
+	assert.Equal(t, "Error: pipeline <missing> was not loaded\n", evalOutput(t, r, out, ":pipeline missing"))
+
+	assert.Equal(t, "lowercase.processors[0].lowercase\n"+
+		`    lowercase={"Field":"message","IgnoreMissing":false,"TargetField":""}`+"\n",
+		evalOutput(t, r, out, ":processors"))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.yml"), []byte("id: lowercase\nprocessors:\n  - uppercase:\n      field: message\n"), 0o600))
+	assert.Equal(t, "Reloaded 2 pipelines.\n", evalOutput(t, r, out, ":reload"))
+	assert.Contains(t, evalOutput(t, r, out, `{"message":"a"}`), `"message": "A"`)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.yml"), []byte("id: lowercase\nprocessors:\n  - unknown: {}\n"), 0o600))
+	assert.Contains(t, evalOutput(t, r, out, ":reload"), "Error: invalid pipeline \"lowercase\"")
+
+	assert.Contains(t, evalOutput(t, r, out, ":help"), ":processors")
+	assert.Equal(t, "Error: unknown command \":bogus\" (type :help for help)\n", evalOutput(t, r, out, ":bogus"))
+	assert.True(t, r.eval(":quit"))
+}
+
+func TestIncompleteJSON(t *testing.T) {
+	testCases := []struct {
+		input      string
+		incomplete bool
+	}{
+		{input: `{"message":`, incomplete: true},
+		{input: "{\n  \"a\": {\"b\": 1}", incomplete: true},
+		{input: `{"message":"a"}`},
+		{input: `{"message":}`},
+		{input: "hello {"},
+		{input: ""},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.incomplete, incompleteJSON(tc.input), tc.input)
+	}
+}
@@ -0,0 +1,154 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+	"github.com/andrewkroh/go-sawmill/pkg/serialization/encoder"
+)
+
+// replayCommand processes the events from dead-letter queue files with a
+// pipeline, typically after the pipeline has been fixed. The output is
+// written like the output of the main command.
+func replayCommand(args []string) error {
+	var paths stringsFlag
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	fs.Var(&paths, "p", "pipeline definition file or directory of files (can be repeated)")
+	id := fs.String("pipeline", "", "ID of the pipeline used to process the events (defaults to the first pipeline loaded)")
+	fs.DurationVar(&eventTimeout, "timeout", 0, "maximum time to process each event (0 for no limit)")
+	fs.StringVar(&outputFormat, "output-format", encoder.FormatNDJSON, "format of the output ("+strings.Join(encoder.Formats(), ", ")+")")
+	fs.StringVar(&outputFields, "fields", "", "comma-separated list of fields written as columns by -output-format csv")
+	fs.StringVar(&dlqPath, "dlq", "", "append events that fail again to this ndjson file")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s replay [flags] dlq-file ...\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("at least one dead-letter queue file must be specified")
+	}
+	if err := checkReplayDLQ(dlqPath, fs.Args()); err != nil {
+		return err
+	}
+
+	set, pipe, err := loadPipelineSet(paths, *id)
+	if err != nil {
+		return err
+	}
+	defer set.Close()
+
+	return replay(fs.Args(), os.Stdout, func(evt *event.Event) (*event.Event, error) {
+		return processEvent(pipe, evt)
+	})
+}
+
+// checkReplayDLQ returns an error if the dead-letter queue for events that
+// fail again is one of the files being replayed. Appending to a file while it
+// is replayed would replay the appended events.
+func checkReplayDLQ(dlq string, files []string) error {
+	if dlq == "" {
+		return nil
+	}
+	dlqInfo, err := os.Stat(dlq)
+	if err != nil {
+		// The file will be created.
+		return nil
+	}
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil && os.SameFile(dlqInfo, info) {
+			return fmt.Errorf("-dlq %s must not be one of the files being replayed", dlq)
+		}
+	}
+	return nil
+}
+
+// replay processes the events from the dead-letter queue files and writes the
+// results to out in the -output-format. Events that fail again are logged and
+// written to the -dlq.
+func replay(files []string, out io.Writer, process processFunc) error {
+	enc, err := newEncoder(out)
+	if err != nil {
+		return err
+	}
+	dlq, err := openDLQ(dlqPath)
+	if err != nil {
+		return err
+	}
+	if dlq != nil {
+		defer dlq.Close()
+	}
+
+	for _, path := range files {
+		if err = replayFile(path, enc, dlq, process); err != nil {
+			return fmt.Errorf("failed replaying %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func replayFile(path string, enc encoder.Encoder, dlq *dlqWriter, process processFunc) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	for lineNumber := uint64(1); ; lineNumber++ {
+		var r dlqRecord
+		if err = dec.Decode(&r); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		if r.Event == nil {
+			return fmt.Errorf("line %d: record does not contain an event", lineNumber)
+		}
+
+		var original *event.Event
+		if dlq != nil {
+			original = r.Event.Clone()
+		}
+		evt, err := process(r.Event)
+		if err != nil {
+			if err = handleFailure(dlq, lineNumber, original, err); err != nil {
+				return err
+			}
+			continue
+		}
+		if evt == nil {
+			// Dropped.
+			continue
+		}
+		if err = enc.Encode(evt); err != nil {
+			log.Printf("Unexpected error encoding event from line %d: %v", lineNumber, err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplay(t *testing.T) {
+	defer func(c inputConfig, path string) { input, dlqPath = c, path }(input, dlqPath)
+	dir := t.TempDir()
+	input = testInputConfig(inputFormatNDJSON)
+	dlqPath = filepath.Join(dir, "dlq.ndjson")
+
+	// Fail the events that have no user.name.
+	in := `{"user":{"name":"a"}}` + "\n" + `{"user":{"id":"b"}}` + "\n" + `{"user":{"id":"c"},"id":"c"}` + "\n"
+	var out bytes.Buffer
+	require.NoError(t, processInput(context.Background(), strings.NewReader(in), &out, newUppercasePipeline(t, "user.name")))
+	require.Len(t, readDLQ(t, dlqPath), 2)
+
+	// Replay with a pipeline that only fails the event without an id.
+	failed := dlqPath
+	dlqPath = filepath.Join(dir, "dlq-2.ndjson")
+	out.Reset()
+	require.NoError(t, replay([]string{failed}, &out, newUppercasePipeline(t, "id")))
+	assert.Equal(t, `{"@metadata":{"line_number":3},"id":"c","message":"C","user":{"id":"c"}}`+"\n", out.String())
+
+	records := readDLQ(t, dlqPath)
+	require.Len(t, records, 1)
+	data, err := records[0].Event.MarshalJSON()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"@metadata":{"line_number":2},"user":{"id":"b"}}`, string(data))
+}
+
+func TestReplayErrors(t *testing.T) {
+	defer func(path string) { dlqPath = path }(dlqPath)
+	dlqPath = ""
+	dir := t.TempDir()
+	process := newUppercasePipeline(t, "id")
+
+	invalid := filepath.Join(dir, "invalid.ndjson")
+	require.NoError(t, os.WriteFile(invalid, []byte(`{"event":{}}`+"\n"+`{"error":{}}`+"\n"), 0o600))
+	err := replay([]string{invalid}, &bytes.Buffer{}, process)
+	assert.EqualError(t, err, "failed replaying "+invalid+": line 2: record does not contain an event")
+
+	err = replay([]string{filepath.Join(dir, "missing.ndjson")}, &bytes.Buffer{}, process)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	assert.NoError(t, checkReplayDLQ(filepath.Join(dir, "new.ndjson"), []string{invalid}))
+	assert.EqualError(t, checkReplayDLQ(invalid, []string{invalid}),
+		"-dlq "+invalid+" must not be one of the files being replayed")
+}
@@ -19,25 +19,29 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"runtime"
 	"runtime/pprof"
+	"sort"
 	"strings"
-
-	"gopkg.in/yaml.v3"
+	"time"
 
 	"github.com/andrewkroh/go-sawmill/pkg/event"
 	"github.com/andrewkroh/go-sawmill/pkg/metrics"
 	"github.com/andrewkroh/go-sawmill/pkg/pipeline"
+	"github.com/andrewkroh/go-sawmill/pkg/serialization/encoder"
 
 	// Register processors:
 	_ "github.com/andrewkroh/go-sawmill/pkg/processor/append"
 	_ "github.com/andrewkroh/go-sawmill/pkg/processor/community_id"
+	_ "github.com/andrewkroh/go-sawmill/pkg/processor/drop"
 	_ "github.com/andrewkroh/go-sawmill/pkg/processor/lowercase"
 	_ "github.com/andrewkroh/go-sawmill/pkg/processor/remove"
 	_ "github.com/andrewkroh/go-sawmill/pkg/processor/set"
@@ -45,15 +49,57 @@ import (
 )
 
 var (
-	pipelineFile      string
+	pipelineFiles     stringsFlag
+	pipelineID        string
 	metricsListenAddr string
+	eventTimeout      time.Duration
+	workers           int
+	input             inputConfig
+	outputFormat      string
+	outputFields      string
+	reload            bool
+	strictEnv         bool
+	registryPath      string
+	dlqPath           string
 	cpuProfile        string
 	memProfile        string
 )
 
+// command is a sawmill subcommand.
+type command struct {
+	usage string                    // One line description.
+	run   func(args []string) error // Invoked with the arguments following the command name.
+}
+
+// commands contains the subcommands. When no subcommand is given the input
+// is processed by the pipeline.
+var commands = map[string]command{
+	"convert":    {"convert pipelines to and from other formats (es-ingest)", convertCommand},
+	"listen":     {"receive syslog messages over UDP, TCP, or Unix sockets and process them", listenCommand},
+	"repl":       {"interactively process events and show a trace of the processors", replCommand},
+	"replay":     {"process the events in dead-letter queue files again", replayCommand},
+	"schema":     {"print the JSON Schema for pipeline definitions", schemaCommand},
+	"serve":      {"run an HTTP server that processes events with pipelines", serveCommand},
+	"serve-grpc": {"run a gRPC server that processes protobuf events with pipelines", serveGRPCCommand},
+	"simulate":   {"show the execution and changes made by each processor", simulateCommand},
+	"test":       {"run pipeline test cases and compare to the expected output", testCommand},
+	"validate":   {"check pipeline files for problems without running them", validateCommand},
+}
+
 func init() {
-	flag.StringVar(&pipelineFile, "p", "", "pipeline definition file")
+	flag.Usage = usage
+	flag.Var(&pipelineFiles, "p", "pipeline definition file or directory of files (can be repeated)")
+	flag.StringVar(&pipelineID, "pipeline", "", "ID of the pipeline used to process the input (defaults to the first pipeline loaded)")
 	flag.StringVar(&metricsListenAddr, "metrics-addr", "localhost:9003", "Metrics listen address.")
+	flag.DurationVar(&eventTimeout, "timeout", 0, "maximum time to process each event (0 for no limit)")
+	flag.IntVar(&workers, "workers", 1, "number of events to process concurrently (output order is preserved)")
+	input.addFlags(flag.CommandLine)
+	flag.StringVar(&outputFormat, "output-format", encoder.FormatNDJSON, "format of the output ("+strings.Join(encoder.Formats(), ", ")+")")
+	flag.StringVar(&outputFields, "fields", "", "comma-separated list of fields written as columns by -output-format csv")
+	flag.StringVar(&dlqPath, "dlq", "", "append events that fail processing to this ndjson file (see the replay command)")
+	flag.StringVar(&registryPath, "registry", "", "file that records the progress of the input files so that a restart resumes where the last run stopped")
+	flag.BoolVar(&reload, "reload", false, "reload the pipelines when the pipeline files change")
+	flag.BoolVar(&strictEnv, "strict-env", false, "fail when a pipeline references an unset environment variable that has no default")
 
 	flag.StringVar(&cpuProfile, "cpuprofile", "", "CPU profile output")
 	flag.StringVar(&memProfile, "memprofile", "", "memory profile output")
@@ -61,7 +107,35 @@ func init() {
 
 func main() {
 	log.SetFlags(0)
+
+	if len(os.Args) > 1 {
+		if cmd, found := commands[os.Args[1]]; found {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				log.Fatal("Error: ", err)
+			}
+			return
+		}
+	}
+
 	flag.Parse()
+	input.paths = flag.Args()
+
+	if workers < 1 {
+		log.Fatal("Error: -workers must be at least 1")
+	}
+	if registryPath != "" {
+		reg, err := loadRegistry(registryPath)
+		if err != nil {
+			log.Fatal("Error: ", err)
+		}
+		input.registry = reg
+	}
+	if err := input.check(); err != nil {
+		log.Fatal("Error: ", err)
+	}
+	if _, err := newEncoder(io.Discard); err != nil {
+		log.Fatal("Error: -output-format: ", err)
+	}
 
 	if cpuProfile != "" {
 		bw, flush := bufferedFileWriter(cpuProfile)
@@ -81,78 +155,249 @@ func main() {
 		}()
 	}
 
-	c, err := loadPipeline(pipelineFile)
+	r, err := newReloader(pipelineFiles, pipelineID)
 	if err != nil {
 		log.Fatal("Error:", err)
 	}
+	metrics.Listen(metricsListenAddr)
+
+	if reload {
+		stop := r.watch()
+		defer stop()
+	}
+
+	ctx, cancel := inputContext(input)
+	defer cancel()
+
+	var stopRegistry func() error
+	if input.registry != nil {
+		stopRegistry = input.registry.run(registrySaveInterval)
+	}
 
-	p, err := pipeline.New(c)
+	err = processInput(ctx, os.Stdin, os.Stdout, r.process)
+	if stopRegistry != nil {
+		if saveErr := stopRegistry(); saveErr != nil {
+			log.Println("Error saving registry:", saveErr)
+		}
+	}
+	if closeErr := r.close(); closeErr != nil {
+		log.Println("Error closing pipelines:", closeErr)
+	}
 	if err != nil {
 		log.Fatal("Error:", err)
 	}
+}
 
-	metrics.Register(p.Metrics()...)
-	defer metrics.Unregister(p.Metrics()...)
-	metrics.Listen(metricsListenAddr)
+// loadPipelineSet loads the pipelines from the given paths and returns the
+// set along with the pipeline selected by id. If id is empty then the first
+// pipeline loaded is selected.
+func loadPipelineSet(paths []string, id string) (*pipeline.Set, *pipeline.Pipeline, error) {
+	configs, err := loadPipelines(paths)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newPipelineSet(configs, id)
+}
 
-	if err := processInput(os.Stdin, os.Stdout, p); err != nil {
-		log.Fatal("Error:", err)
+// newPipelineSet creates a set from the pipeline configs and returns it along
+// with the pipeline selected by id. If id is empty then the first pipeline is
+// selected.
+func newPipelineSet(configs []*pipeline.Config, id string) (*pipeline.Set, *pipeline.Pipeline, error) {
+	set, err := pipeline.NewSet(configs...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if id == "" {
+		id = configs[0].ID
+	}
+	p := set.Get(id)
+	if p == nil {
+		set.Close()
+		return nil, nil, fmt.Errorf("pipeline <%s> was not loaded", id)
 	}
+
+	return set, p, nil
 }
 
-func loadPipeline(path string) (*pipeline.Config, error) {
-	f, err := os.Open(path)
+// loadPipelines loads the pipelines from each path. If a path is a directory
+// then all .yml, .yaml, and .json files within it are loaded in lexical order.
+func loadPipelines(paths []string) ([]*pipeline.Config, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("at least one pipeline file must be specified with -p")
+	}
+
+	var configs []*pipeline.Config
+	for _, path := range paths {
+		files, err := pipelineFilesInPath(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			c, err := loadPipeline(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load pipeline from %s: %w", file, err)
+			}
+			configs = append(configs, c)
+		}
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("no pipeline files found in %v", paths)
+	}
+
+	return configs, nil
+}
+
+func pipelineFilesInPath(path string) ([]string, error) {
+	info, err := os.Stat(path)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
 
-	var c *pipeline.Config
-	if err := yaml.NewDecoder(f).Decode(&c); err != nil {
+	entries, err := os.ReadDir(path)
+	if err != nil {
 		return nil, err
 	}
 
-	return c, nil
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch filepath.Ext(entry.Name()) {
+		case ".yml", ".yaml", ".json":
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+	return files, nil
+}
+
+func loadPipeline(path string) (*pipeline.Config, error) {
+	return pipeline.LoadConfigFile(path, pipeline.LoadOptions{Strict: strictEnv})
+}
+
+// processInput reads events from the input files, or from in if there are
+// none, using the input flags, processes them with process, and writes the
+// results to out in the -output-format in the order they were read. Events
+// are processed concurrently when -workers is greater than 1. Input that
+// cannot be decoded is logged like a processing error. Events that fail
+// processing are also written to the -dlq. The progress of each input file is
+// recorded in the -registry once its output is written.
+func processInput(ctx context.Context, in io.Reader, out io.Writer, process processFunc) error {
+	return processEventsFrom(out, process, func(events chan<- inputEvent) error {
+		return readSources(ctx, in, input, events)
+	})
 }
 
-func processInput(in io.Reader, out io.Writer, pipe *pipeline.Pipeline) error {
-	s := bufio.NewScanner(in)
-	var lineNumber uint64
+// processEventsFrom processes the events that read sends and writes the
+// results to out like processInput. read must return after sending all of
+// its events. Its error is returned.
+func processEventsFrom(out io.Writer, process processFunc, read func(events chan<- inputEvent) error) error {
+	enc, err := newEncoder(out)
+	if err != nil {
+		return err
+	}
+	dlq, err := openDLQ(dlqPath)
+	if err != nil {
+		return err
+	}
+	if dlq != nil {
+		defer dlq.Close()
+	}
 
-	enc := json.NewEncoder(out)
-	enc.SetEscapeHTML(false)
+	inputs := make(chan inputEvent, workers)
+	outputs := make(chan outputEvent, workers)
 
-	for s.Scan() {
-		lineNumber++
+	var readErr error
+	go func() {
+		defer close(inputs)
+		readErr = read(inputs)
+	}()
+	go processEvents(process, workers, dlq != nil, inputs, outputs)
 
-		// Skip empty lines.
-		line := strings.TrimSpace(s.Text())
-		if line == "" {
+	for o := range outputs {
+		if o.err != nil {
+			if err := handleFailure(dlq, o.lineNumber, o.original, o.err); err != nil {
+				continue
+			}
+			o.commit()
 			continue
 		}
-
-		// Create new event.
-		evt := event.New()
-		evt.Put("@metadata.line_number", event.UnsignedInteger(lineNumber))
-		evt.Put("event.original", event.String(line))
-
-		// Process the event.
-		evt, err := pipe.Process(evt)
-		if err != nil {
-			log.Printf("Error processing line %d: %v", lineNumber, err)
+		if o.event == nil {
+			// Dropped.
+			o.commit()
 			continue
 		}
 
-		if err := enc.Encode(evt); err != nil {
-			log.Printf("Unexpected error marshaling event from line %d to JSON: %v", lineNumber, err)
+		if err := enc.Encode(o.event); err != nil {
+			log.Printf("Unexpected error encoding event from line %d: %v", o.lineNumber, err)
 			continue
 		}
+		o.commit()
 	}
-	if err := s.Err(); err != nil {
-		return fmt.Errorf("failed reading from input: %w", err)
+
+	return readErr
+}
+
+// newEncoder returns an encoder for the -output-format that writes to out.
+func newEncoder(out io.Writer) (encoder.Encoder, error) {
+	var opts encoder.Options
+	for _, f := range strings.Split(outputFields, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			opts.Fields = append(opts.Fields, f)
+		}
 	}
+	return encoder.New(outputFormat, out, opts)
+}
 
-	return nil
+// processEvent processes the event while enforcing the -timeout.
+func processEvent(pipe *pipeline.Pipeline, evt *event.Event) (*event.Event, error) {
+	return processEventContext(context.Background(), pipe, evt)
+}
+
+// processEventContext processes the event while enforcing the -timeout.
+// Processing stops early if ctx is done.
+func processEventContext(ctx context.Context, pipe *pipeline.Pipeline, evt *event.Event) (*event.Event, error) {
+	if eventTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, eventTimeout)
+		defer cancel()
+	}
+	return pipe.ProcessContext(ctx, evt)
+}
+
+// logProcessingError logs a pipeline processing error. Details about the
+// failed processor are included when available.
+func logProcessingError(lineNumber uint64, err error) {
+	var procErr *pipeline.ProcessorError
+	if !errors.As(err, &procErr) {
+		log.Printf("Error processing line %d: %v", lineNumber, err)
+		return
+	}
+
+	log.Printf("Processing failed: line=%d pipeline.id=%s processor.id=%s processor.type=%s processor.tag=%s error=%q",
+		lineNumber, procErr.PipelineID, procErr.ProcessorID, procErr.ProcessorType, procErr.ProcessorTag, procErr.Err)
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %[1]s [flags] [file ...]\n       %[1]s <command> [flags] [file ...]\n\nCommands:\n", filepath.Base(os.Args[0]))
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-10s %s\n", name, commands[name].usage)
+	}
+
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
 }
 
 func bufferedFileWriter(dest string) (w io.Writer, close func()) {
@@ -170,3 +415,16 @@ func bufferedFileWriter(dest string) (w io.Writer, close func()) {
 		}
 	}
 }
+
+// stringsFlag is a flag.Value that accumulates the values from each
+// occurrence of the flag.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
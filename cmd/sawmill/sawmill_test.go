@@ -0,0 +1,46 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+	"github.com/andrewkroh/go-sawmill/pkg/serialization/encoder"
+)
+
+func TestProcessInputOutputFormat(t *testing.T) {
+	defer func(format, fields string) { outputFormat, outputFields = format, fields }(outputFormat, outputFields)
+	outputFormat, outputFields = encoder.FormatCSV, "@metadata.line_number, event.original"
+
+	process := func(evt *event.Event) (*event.Event, error) { return evt, nil }
+
+	var out bytes.Buffer
+	require.NoError(t, processInput(context.Background(), strings.NewReader("hello\nsay \"hi\"\n"), &out, process))
+	assert.Equal(t, "@metadata.line_number,event.original\n1,hello\n2,\"say \"\"hi\"\"\"\n", out.String())
+
+	outputFields = ""
+	err := processInput(context.Background(), strings.NewReader("hello\n"), &out, process)
+	assert.EqualError(t, err, "the csv format requires a list of fields")
+}
@@ -0,0 +1,529 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+	"github.com/andrewkroh/go-sawmill/pkg/metrics"
+	"github.com/andrewkroh/go-sawmill/pkg/pipeline"
+)
+
+// shutdownTimeout is how long in-flight requests are given to complete when
+// the server is stopped.
+const shutdownTimeout = 10 * time.Second
+
+// serveCommand runs an HTTP server that processes events with pipelines that
+// are loaded at startup or added through the API.
+func serveCommand(args []string) error {
+	var paths stringsFlag
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.Var(&paths, "p", "pipeline definition file or directory of files loaded at startup (can be repeated)")
+	addr := fs.String("addr", "localhost:9003", "listen address")
+	maxRequestBytes := fs.Int64("max-request-bytes", 10<<20, "maximum size of a request body")
+	fs.BoolVar(&strictEnv, "strict-env", false, "fail when a pipeline references an unset environment variable that has no default")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s serve [flags]\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var configs []*pipeline.Config
+	if len(paths) > 0 {
+		var err error
+		if configs, err = loadPipelines(paths); err != nil {
+			return err
+		}
+	}
+	s, err := newServer(configs, *maxRequestBytes)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: s.handler()}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(ln) }()
+	log.Printf("Listening on %s.", ln.Addr())
+
+	select {
+	case err = <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(ctx)
+}
+
+// server is an HTTP API for processing events. Pipelines can be added or
+// replaced while the server is running. Requests that are processing events
+// finish with the pipelines they started with.
+type server struct {
+	maxRequestBytes int64
+
+	updateMu sync.Mutex   // Serializes pipeline updates.
+	mu       sync.RWMutex // Held for reading while events are processed.
+	configs  map[string]*pipeline.Config
+	set      *pipeline.Set
+}
+
+// newServer returns a server with the given pipelines loaded and their
+// metrics registered.
+func newServer(configs []*pipeline.Config, maxRequestBytes int64) (*server, error) {
+	set, err := pipeline.NewSet(configs...)
+	if err != nil {
+		return nil, err
+	}
+	metrics.Register(set.Metrics()...)
+
+	s := &server{
+		maxRequestBytes: maxRequestBytes,
+		configs:         make(map[string]*pipeline.Config, len(configs)),
+		set:             set,
+	}
+	for _, c := range configs {
+		s.configs[c.ID] = c
+	}
+	return s, nil
+}
+
+// close unregisters the metrics and closes the pipelines.
+func (s *server) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	metrics.Unregister(s.set.Metrics()...)
+	return s.set.Close()
+}
+
+// put adds the pipeline or replaces the pipeline with the same ID. The
+// current pipelines remain in use if there is an error.
+func (s *server) put(config *pipeline.Config) (created bool, err error) {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	configs := make(map[string]*pipeline.Config, len(s.configs)+1)
+	for id, c := range s.configs {
+		configs[id] = c
+	}
+	_, replaced := configs[config.ID]
+	configs[config.ID] = config
+
+	set, err := pipeline.NewSet(sortedConfigs(configs)...)
+	if err != nil {
+		return false, err
+	}
+
+	// Wait for in-flight requests to finish before swapping.
+	s.mu.Lock()
+	old := s.set
+	s.configs, s.set = configs, set
+	s.mu.Unlock()
+
+	metrics.Unregister(old.Metrics()...)
+	metrics.Register(set.Metrics()...)
+	if err := old.Close(); err != nil {
+		log.Println("Error closing old pipelines:", err)
+	}
+	return !replaced, nil
+}
+
+// sortedConfigs returns the configs ordered by ID.
+func sortedConfigs(configs map[string]*pipeline.Config) []*pipeline.Config {
+	list := make([]*pipeline.Config, 0, len(configs))
+	for _, c := range configs {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/pipelines", s.handleListPipelines)
+	mux.HandleFunc("/pipelines/", s.handlePipeline)
+	mux.HandleFunc("/_simulate", s.handleSimulate)
+	mux.HandleFunc("/_health", s.handleHealth)
+	mux.HandleFunc("/_ready", s.handleReady)
+	mux.Handle("/metrics", metrics.Handler())
+	return mux
+}
+
+// pipelineInfo describes a loaded pipeline.
+type pipelineInfo struct {
+	ID          string `json:"id"`
+	Description string `json:"description,omitempty"`
+}
+
+// handleListPipelines handles GET /pipelines.
+func (s *server) handleListPipelines(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	s.mu.RLock()
+	pipelines := make([]pipelineInfo, 0, len(s.configs))
+	for _, c := range sortedConfigs(s.configs) {
+		pipelines = append(pipelines, pipelineInfo{ID: c.ID, Description: c.Description})
+	}
+	s.mu.RUnlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"pipelines": pipelines})
+}
+
+// handlePipeline handles PUT /pipelines/{id} and POST /pipelines/{id}/_process.
+func (s *server) handlePipeline(w http.ResponseWriter, r *http.Request) {
+	id, action := splitPath(strings.TrimPrefix(r.URL.Path, "/pipelines/"))
+	switch {
+	case id != "" && action == "":
+		if allowMethod(w, r, http.MethodPut) {
+			s.handlePutPipeline(w, r, id)
+		}
+	case id != "" && action == "_process":
+		if allowMethod(w, r, http.MethodPost) {
+			s.handleProcess(w, r, id)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handlePutPipeline loads the YAML (or JSON) pipeline definition in the body
+// and adds or replaces the pipeline. The ID in the definition is optional,
+// but it must match the ID in the path when given. References and includes are
+// rejected because they would read the server's files and environment.
+func (s *server) handlePutPipeline(w http.ResponseWriter, r *http.Request, id string) {
+	data, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	config, err := pipeline.LoadConfig(data, pipeline.LoadOptions{Untrusted: true})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid pipeline definition: %w", err))
+		return
+	}
+	if config.ID == "" {
+		config.ID = id
+	} else if config.ID != id {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("pipeline ID <%s> does not match <%s> from the path", config.ID, id))
+		return
+	}
+	if errs := pipeline.Validate(config); len(errs) > 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid pipeline %q: %w", id, errs))
+		return
+	}
+
+	created, err := s.put(config)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, pipelineInfo{ID: config.ID, Description: config.Description})
+}
+
+// processResult is the outcome of processing an event.
+type processResult struct {
+	Event   *event.Event `json:"event,omitempty"` // Nil if the event was dropped or failed.
+	Dropped bool         `json:"dropped,omitempty"`
+	Error   *failure     `json:"error,omitempty"`
+}
+
+func newProcessResult(evt *event.Event, err error) processResult {
+	if err != nil {
+		f := newFailure(err)
+		return processResult{Error: &f}
+	}
+	return processResult{Event: evt, Dropped: evt == nil}
+}
+
+// handleProcess processes the event in the body with the pipeline. The body
+// is a JSON object, or a batch of events as ndjson when the Content-Type is
+// application/x-ndjson. The response for a batch contains a result for each
+// event as ndjson in the same order.
+func (s *server) handleProcess(w http.ResponseWriter, r *http.Request, id string) {
+	data, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	batch := contentType == "application/x-ndjson"
+
+	var events []*event.Event
+	if batch {
+		var err error
+		if events, err = decodeEvents(data); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	} else {
+		evt, err := decodeEvent(data)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("failed to decode event: %w", err))
+			return
+		}
+		events = []*event.Event{evt}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pipe := s.set.Get(id)
+	if pipe == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("pipeline <%s> was not loaded", id))
+		return
+	}
+
+	if !batch {
+		evt, err := pipe.ProcessContext(r.Context(), events[0])
+		status := http.StatusOK
+		if err != nil {
+			status = http.StatusUnprocessableEntity
+		}
+		writeJSON(w, status, newProcessResult(evt, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, result := range pipe.ProcessBatch(r.Context(), events) {
+		if err := enc.Encode(newProcessResult(result.Event, result.Err)); err != nil {
+			return
+		}
+	}
+}
+
+// decodeEvents decodes events from ndjson. Blank lines are ignored.
+func decodeEvents(data []byte) ([]*event.Event, error) {
+	var events []*event.Event
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		evt, err := decodeEvent([]byte(line))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode event on line %d: %w", i+1, err)
+		}
+		events = append(events, evt)
+	}
+	return events, nil
+}
+
+// simulateRequest is the body of a simulate request. The events are processed
+// by either the pipeline definition or the loaded pipeline with the ID.
+type simulateRequest struct {
+	PipelineID string            `json:"pipeline_id"`
+	Pipeline   json.RawMessage   `json:"pipeline"`
+	Events     []json.RawMessage `json:"events"`
+}
+
+// handleSimulate handles POST /_simulate. The response contains the
+// simulation result of each event. A pipeline definition in the request can
+// use the loaded pipelines with pipeline processors.
+func (s *server) handleSimulate(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	data, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	var req simulateRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid simulate request: %w", err))
+		return
+	}
+	if (req.PipelineID == "") == (len(req.Pipeline) == 0) {
+		writeError(w, http.StatusBadRequest, errors.New("simulate request must contain either pipeline_id or pipeline"))
+		return
+	}
+	events := make([]*event.Event, 0, len(req.Events))
+	for i, raw := range req.Events {
+		evt, err := decodeEvent(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("failed to decode events[%d]: %w", i, err))
+			return
+		}
+		events = append(events, evt)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pipe := s.set.Get(req.PipelineID)
+	if len(req.Pipeline) > 0 {
+		set, p, err := s.simulateSet(req.Pipeline)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		defer set.Close()
+		pipe = p
+	}
+	if pipe == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("pipeline <%s> was not loaded", req.PipelineID))
+		return
+	}
+
+	results := make([]*pipeline.SimulateResult, 0, len(events))
+	for _, evt := range events {
+		results = append(results, pipe.SimulateContext(r.Context(), evt))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"results": results})
+}
+
+// simulateID is the ID of a simulated pipeline definition that has no ID.
+const simulateID = "_simulate"
+
+// simulateSet returns a set containing the pipeline definition and the
+// loaded pipelines, which the definition can reference, along with the
+// pipeline created from the definition. References and includes are rejected
+// like in handlePutPipeline. s.mu must be held.
+func (s *server) simulateSet(data []byte) (*pipeline.Set, *pipeline.Pipeline, error) {
+	config, err := pipeline.LoadConfig(data, pipeline.LoadOptions{Untrusted: true})
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid pipeline definition: %w", err)
+	}
+	if config.ID == "" {
+		config.ID = simulateID
+	}
+	if errs := pipeline.Validate(config); len(errs) > 0 {
+		return nil, nil, fmt.Errorf("invalid pipeline %q: %w", config.ID, errs)
+	}
+
+	configs := map[string]*pipeline.Config{}
+	for id, c := range s.configs {
+		configs[id] = c
+	}
+	configs[config.ID] = config
+	set, err := pipeline.NewSet(sortedConfigs(configs)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return set, set.Get(config.ID), nil
+}
+
+// handleHealth reports that the server is running.
+func (s *server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if allowMethod(w, r, http.MethodGet) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+// handleReady reports whether the server is ready to process events, which
+// is once at least one pipeline is loaded.
+func (s *server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	s.mu.RLock()
+	n := len(s.configs)
+	s.mu.RUnlock()
+
+	if n == 0 {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "no pipelines are loaded"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+// readBody reads the request body. If the body cannot be read then an error
+// response is written and false is returned.
+func (s *server) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if r.ContentLength > s.maxRequestBytes {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("request body exceeds %d bytes", s.maxRequestBytes))
+		return nil, false
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxRequestBytes))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("failed to read request body: %w", err))
+		return nil, false
+	}
+	return data, true
+}
+
+// splitPath splits "id/action" into its parts. Action is empty if there is
+// no slash.
+func splitPath(path string) (id, action string) {
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		return path[:i], path[i+1:]
+	}
+	return path, ""
+}
+
+// allowMethod returns true if the request uses the method. Otherwise it
+// writes a 405 response.
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		log.Println("Error writing response:", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]failure{"error": {Message: err.Error()}})
+}
@@ -0,0 +1,315 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrewkroh/go-sawmill/pkg/pipeline"
+)
+
+const uppercasePipeline = `
+id: uppercase
+description: Uppercase the message.
+processors:
+  - drop:
+      if: message == "drop"
+  - uppercase:
+      field: message
+`
+
+func newTestServer(t *testing.T, definitions ...string) *httptest.Server {
+	t.Helper()
+
+	var configs []*pipeline.Config
+	for _, d := range definitions {
+		c, err := pipeline.LoadConfig([]byte(d), pipeline.LoadOptions{})
+		require.NoError(t, err)
+		configs = append(configs, c)
+	}
+	s, err := newServer(configs, 1024)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.close() })
+
+	ts := httptest.NewServer(s.handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// request sends a request and returns the response status and body.
+func request(t *testing.T, method, url, contentType, body string) (int, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(data)
+}
+
+func TestServeProcess(t *testing.T) {
+	ts := newTestServer(t, uppercasePipeline)
+	url := ts.URL + "/pipelines/uppercase/_process"
+
+	testCases := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		response    string
+	}{
+		{
+			name:     "event",
+			body:     `{"message":"hello"}`,
+			status:   http.StatusOK,
+			response: `{"event":{"message":"HELLO"}}` + "\n",
+		},
+		{
+			name:     "dropped",
+			body:     `{"message":"drop"}`,
+			status:   http.StatusOK,
+			response: `{"dropped":true}` + "\n",
+		},
+		{
+			name:   "failed",
+			body:   `{}`,
+			status: http.StatusUnprocessableEntity,
+			response: `{"error":{"message":"key <message> is missing from event","pipeline_id":"uppercase",` +
+				`"processor_id":"uppercase.processors[1].uppercase","processor_type":"uppercase"}}` + "\n",
+		},
+		{
+			name:        "batch",
+			contentType: "application/x-ndjson",
+			body:        `{"message":"a"}` + "\n\n" + `{"message":"drop"}` + "\n" + `{}` + "\n" + `{"message":"b"}`,
+			status:      http.StatusOK,
+			response: `{"event":{"message":"A"}}` + "\n" +
+				`{"dropped":true}` + "\n" +
+				`{"error":{"message":"key <message> is missing from event","pipeline_id":"uppercase",` +
+				`"processor_id":"uppercase.processors[1].uppercase","processor_type":"uppercase"}}` + "\n" +
+				`{"event":{"message":"B"}}` + "\n",
+		},
+		{
+			name:     "invalid event",
+			body:     `[]`,
+			status:   http.StatusBadRequest,
+			response: `{"error":{"message":"failed to decode event: input is not a JSON object"}}` + "\n",
+		},
+		{
+			name:        "invalid batch",
+			contentType: "application/x-ndjson; charset=utf-8",
+			body:        `{}` + "\n" + `1`,
+			status:      http.StatusBadRequest,
+			response:    `{"error":{"message":"failed to decode event on line 2: input is not a JSON object"}}` + "\n",
+		},
+		{
+			name:     "request too large",
+			body:     `{"message":"` + strings.Repeat("a", 1024) + `"}`,
+			status:   http.StatusRequestEntityTooLarge,
+			response: `{"error":{"message":"request body exceeds 1024 bytes"}}` + "\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			status, body := request(t, http.MethodPost, url, tc.contentType, tc.body)
+			assert.Equal(t, tc.status, status)
+			assert.Equal(t, tc.response, body)
+		})
+	}
+
+	status, body := request(t, http.MethodPost, ts.URL+"/pipelines/missing/_process", "", `{}`)
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, `{"error":{"message":"pipeline <missing> was not loaded"}}`+"\n", body)
+
+	status, _ = request(t, http.MethodGet, url, "", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, status)
+
+	status, _ = request(t, http.MethodPost, ts.URL+"/pipelines/uppercase/_unknown", "", `{}`)
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestServePutPipeline(t *testing.T) {
+	ts := newTestServer(t)
+
+	status, body := request(t, http.MethodGet, ts.URL+"/_ready", "", "")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, `{"status":"no pipelines are loaded"}`+"\n", body)
+
+	status, body = request(t, http.MethodPut, ts.URL+"/pipelines/uppercase", "", uppercasePipeline)
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, `{"id":"uppercase","description":"Uppercase the message."}`+"\n", body)
+
+	status, body = request(t, http.MethodPost, ts.URL+"/pipelines/uppercase/_process", "", `{"message":"hi"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"event":{"message":"HI"}}`+"\n", body)
+
+	// The ID can be omitted and pipelines can reference other pipelines.
+	status, _ = request(t, http.MethodPut, ts.URL+"/pipelines/main", "", "processors:\n  - pipeline:\n      name: uppercase\n")
+	assert.Equal(t, http.StatusCreated, status)
+
+	status, body = request(t, http.MethodPost, ts.URL+"/pipelines/main/_process", "", `{"message":"hi"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"event":{"message":"HI"}}`+"\n", body)
+
+	status, body = request(t, http.MethodPut, ts.URL+"/pipelines/uppercase", "", "processors:\n  - lowercase:\n      field: message\n")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"id":"uppercase"}`+"\n", body)
+
+	status, body = request(t, http.MethodPost, ts.URL+"/pipelines/main/_process", "", `{"message":"Hi"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"event":{"message":"hi"}}`+"\n", body)
+
+	status, body = request(t, http.MethodGet, ts.URL+"/pipelines", "", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"pipelines":[{"id":"main"},{"id":"uppercase"}]}`+"\n", body)
+
+	status, body = request(t, http.MethodGet, ts.URL+"/_ready", "", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"status":"ready"}`+"\n", body)
+
+	errorCases := []struct {
+		name     string
+		id       string
+		body     string
+		response string
+	}{
+		{
+			name:     "id mismatch",
+			id:       "other",
+			body:     uppercasePipeline,
+			response: `pipeline ID <uppercase> does not match <other> from the path`,
+		},
+		{
+			name:     "invalid processor",
+			id:       "bad",
+			body:     "processors:\n  - unknown: {}\n",
+			response: `invalid pipeline \"bad\": processors[0].unknown: unknown processor type \"unknown\"`,
+		},
+		{
+			name:     "missing pipeline",
+			id:       "bad",
+			body:     "processors:\n  - pipeline:\n      name: missing\n",
+			response: `processor with ID bad.processors[0].pipeline references pipeline <missing> that does not exist`,
+		},
+		{
+			name:     "invalid yaml",
+			id:       "bad",
+			body:     "processors: [",
+			response: `invalid pipeline definition: yaml: line 1: did not find expected node content`,
+		},
+		{
+			name:     "file reference",
+			id:       "bad",
+			body:     "processors:\n  - set:\n      target_field: x\n      value: ${file:/etc/passwd}\n",
+			response: `invalid pipeline definition: line 4, column 14: reference ${file:/etc/passwd} is not allowed`,
+		},
+		{
+			name:     "env reference",
+			id:       "bad",
+			body:     "processors:\n  - set:\n      target_field: x\n      value: ${HOME}\n",
+			response: `invalid pipeline definition: line 4, column 14: reference ${HOME} is not allowed`,
+		},
+		{
+			name:     "include",
+			id:       "bad",
+			body:     "processors:\n  - include: /etc/passwd\n",
+			response: `invalid pipeline definition: line 2, column 5: include /etc/passwd is not allowed`,
+		},
+	}
+	for _, tc := range errorCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			status, body := request(t, http.MethodPut, ts.URL+"/pipelines/"+tc.id, "", tc.body)
+			assert.Equal(t, http.StatusBadRequest, status)
+			assert.Equal(t, `{"error":{"message":"`+tc.response+`"}}`+"\n", body)
+		})
+	}
+
+	// The failed updates did not change the pipelines.
+	status, body = request(t, http.MethodGet, ts.URL+"/pipelines", "", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"pipelines":[{"id":"main"},{"id":"uppercase"}]}`+"\n", body)
+}
+
+func TestServeSimulate(t *testing.T) {
+	ts := newTestServer(t, uppercasePipeline)
+	url := ts.URL + "/_simulate"
+
+	status, body := request(t, http.MethodPost, url, "", `{"pipeline_id":"uppercase","events":[{"message":"a"}]}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `"event":{"message":"A"}`)
+	assert.Contains(t, body, `"processor_id":"uppercase.processors[1].uppercase"`)
+
+	// An inline pipeline can call the loaded pipelines.
+	inline := `{"pipeline":{"processors":[{"set":{"target_field":"x","value":1}},{"pipeline":{"name":"uppercase"}}]},"events":[{"message":"a"},{"message":"drop"}]}`
+	status, body = request(t, http.MethodPost, url, "", inline)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `"event":{"message":"A","x":1}`)
+	assert.Contains(t, body, `"processor_id":"_simulate.processors[0].set"`)
+	assert.Contains(t, body, `"dropped":true`)
+
+	errorCases := []struct {
+		name     string
+		body     string
+		status   int
+		response string
+	}{
+		{"no pipeline", `{"events":[]}`, http.StatusBadRequest, `simulate request must contain either pipeline_id or pipeline`},
+		{"missing pipeline", `{"pipeline_id":"missing","events":[]}`, http.StatusNotFound, `pipeline <missing> was not loaded`},
+		{"invalid event", `{"pipeline_id":"uppercase","events":[1]}`, http.StatusBadRequest, `failed to decode events[0]: input is not a JSON object`},
+		{"invalid pipeline", `{"pipeline":{"processors":[{"unknown":{}}]},"events":[]}`, http.StatusBadRequest, `invalid pipeline \"_simulate\": processors[0].unknown: unknown processor type \"unknown\"`},
+		{"file reference", `{"pipeline":{"processors":[{"set":{"target_field":"x","value":"${file:/etc/passwd}"}}]},"events":[]}`, http.StatusBadRequest, `invalid pipeline definition: line 1, column 51: reference ${file:/etc/passwd} is not allowed`},
+		{"include", `{"pipeline":{"processors":[{"include":"/etc/passwd"}]},"events":[]}`, http.StatusBadRequest, `invalid pipeline definition: line 1, column 16: include /etc/passwd is not allowed`},
+	}
+	for _, tc := range errorCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			status, body := request(t, http.MethodPost, url, "", tc.body)
+			assert.Equal(t, tc.status, status)
+			assert.Equal(t, `{"error":{"message":"`+tc.response+`"}}`+"\n", body)
+		})
+	}
+}
+
+func TestServeHealthAndMetrics(t *testing.T) {
+	ts := newTestServer(t, uppercasePipeline)
+
+	status, body := request(t, http.MethodGet, ts.URL+"/_health", "", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"status":"ok"}`+"\n", body)
+
+	request(t, http.MethodPost, ts.URL+"/pipelines/uppercase/_process", "", `{"message":"hi"}`)
+	status, body = request(t, http.MethodGet, ts.URL+"/metrics", "", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `component_id="uppercase.processors[1].uppercase"`)
+}
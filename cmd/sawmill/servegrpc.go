@@ -0,0 +1,192 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+	"github.com/andrewkroh/go-sawmill/pkg/metrics"
+	"github.com/andrewkroh/go-sawmill/pkg/serialization/protobuf"
+)
+
+// pipelineMetadataKey is the request metadata key that selects the pipeline
+// used by the PipelineService.
+const pipelineMetadataKey = "pipeline"
+
+// serveGRPCCommand runs a gRPC server for the PipelineService that processes
+// protobuf events with the pipelines.
+func serveGRPCCommand(args []string) error {
+	var paths stringsFlag
+	fs := flag.NewFlagSet("serve-grpc", flag.ExitOnError)
+	fs.Var(&paths, "p", "pipeline definition file or directory of files (can be repeated)")
+	id := fs.String("pipeline", "", "ID of the pipeline used when a request does not select one (defaults to the first pipeline loaded)")
+	addr := fs.String("addr", "localhost:9004", "listen address")
+	fs.StringVar(&metricsListenAddr, "metrics-addr", "localhost:9003", "Metrics listen address.")
+	fs.DurationVar(&eventTimeout, "timeout", 0, "maximum time to process each event (0 for no limit)")
+	reload := fs.Bool("reload", false, "reload the pipelines when the pipeline files change")
+	fs.BoolVar(&strictEnv, "strict-env", false, "fail when a pipeline references an unset environment variable that has no default")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s serve-grpc [flags]\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	r, err := newReloader(paths, *id)
+	if err != nil {
+		return err
+	}
+	defer r.close()
+	metrics.Listen(metricsListenAddr)
+
+	if *reload {
+		stop := r.watch()
+		defer stop()
+	}
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	srv := grpc.NewServer()
+	protobuf.RegisterPipelineServiceServer(srv, &pipelineService{pipelines: r})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		srv.GracefulStop()
+	}()
+
+	log.Printf("Listening on %s.", ln.Addr())
+	return srv.Serve(ln)
+}
+
+// pipelineService implements the gRPC PipelineService. Requests are
+// processed with the pipeline selected by the "pipeline" metadata or with the
+// reloader's current pipeline.
+type pipelineService struct {
+	protobuf.UnimplementedPipelineServiceServer
+	pipelines *reloader
+}
+
+func (s *pipelineService) Process(ctx context.Context, req *protobuf.MessageWrapper) (*protobuf.MessageWrapper, error) {
+	return s.process(ctx, req, false)
+}
+
+// ProcessStream processes a stream of events. An event that fails processing
+// is answered with the event as it was before processing and a description of
+// the failure in its error field, so the stream continues with the next
+// event.
+func (s *pipelineService) ProcessStream(stream protobuf.PipelineService_ProcessStreamServer) error {
+	for {
+		req, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		resp, err := s.process(stream.Context(), req, true)
+		if err != nil {
+			return err
+		}
+		if err = stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// process processes the log event in the request. The response contains no
+// message if the event was dropped. Errors are returned as gRPC statuses. If
+// reportFailures is true then a processing failure is returned as a response
+// containing the original event with the failure in its error field.
+func (s *pipelineService) process(ctx context.Context, req *protobuf.MessageWrapper, reportFailures bool) (*protobuf.MessageWrapper, error) {
+	l := req.GetLog()
+	if l == nil {
+		return nil, status.Error(codes.InvalidArgument, "request does not contain a log event")
+	}
+
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(pipelineMetadataKey); len(values) > 0 {
+			id = values[0]
+		}
+	}
+
+	evt := protobuf.ToLogEvent(l)
+	if evt == nil {
+		// The log has no fields.
+		evt = event.New()
+	}
+	var original *event.Event
+	if reportFailures {
+		original = evt.Clone()
+	}
+
+	evt, found, err := s.pipelines.processWith(ctx, id, evt)
+	if !found {
+		return nil, status.Errorf(codes.NotFound, "pipeline <%s> was not loaded", id)
+	}
+	if err != nil {
+		if reportFailures {
+			log.Println("Error processing event:", err)
+			putFailure(original, newFailure(err))
+			return protobuf.FromEvent(original), nil
+		}
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if evt == nil {
+		// Dropped.
+		return &protobuf.MessageWrapper{}, nil
+	}
+	return protobuf.FromEvent(evt), nil
+}
+
+// putFailure replaces the error field of the event with the failure.
+func putFailure(evt *event.Event, f failure) {
+	evt.Delete("error")
+	evt.Put("error.message", event.String(f.Message))
+	for _, field := range []struct{ key, value string }{
+		{"error.pipeline_id", f.PipelineID},
+		{"error.processor_id", f.ProcessorID},
+		{"error.processor_type", f.ProcessorType},
+		{"error.processor_tag", f.ProcessorTag},
+	} {
+		if field.value != "" {
+			evt.Put(field.key, event.String(field.value))
+		}
+	}
+}
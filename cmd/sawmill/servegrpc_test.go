@@ -0,0 +1,171 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+	"github.com/andrewkroh/go-sawmill/pkg/serialization/protobuf"
+)
+
+// newPipelineServiceClient starts an in-process PipelineService with the
+// pipelines in the definitions and returns a client connected to it.
+func newPipelineServiceClient(t *testing.T, definitions ...string) protobuf.PipelineServiceClient {
+	t.Helper()
+
+	dir := t.TempDir()
+	for i, d := range definitions {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, string(rune('a'+i))+".yml"), []byte(d), 0o600))
+	}
+	r, err := newReloader([]string{dir}, "")
+	require.NoError(t, err)
+	t.Cleanup(func() { r.close() })
+
+	ln := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	protobuf.RegisterPipelineServiceServer(srv, &pipelineService{pipelines: r})
+	go srv.Serve(ln)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return ln.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return protobuf.NewPipelineServiceClient(conn)
+}
+
+func logMessage(msg string) *protobuf.MessageWrapper {
+	evt := event.New()
+	evt.Put("message", event.String(msg))
+	return protobuf.FromEvent(evt)
+}
+
+// messageOf returns the message field of the event in the response.
+func messageOf(t *testing.T, resp *protobuf.MessageWrapper) string {
+	t.Helper()
+	require.NotNil(t, resp.GetLog())
+	v := protobuf.ToLogEvent(resp.GetLog()).Get("message")
+	require.NotNil(t, v)
+	return v.String
+}
+
+func TestPipelineServiceProcess(t *testing.T) {
+	client := newPipelineServiceClient(t, uppercasePipeline, "id: lowercase\nprocessors:\n  - lowercase:\n      field: message\n")
+	ctx := context.Background()
+
+	resp, err := client.Process(ctx, logMessage("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "HELLO", messageOf(t, resp))
+
+	resp, err = client.Process(ctx, logMessage("drop"))
+	require.NoError(t, err)
+	assert.Nil(t, resp.GetMessage())
+
+	// The pipeline is selected by the request metadata.
+	resp, err = client.Process(metadata.AppendToOutgoingContext(ctx, "pipeline", "lowercase"), logMessage("Hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", messageOf(t, resp))
+
+	_, err = client.Process(metadata.AppendToOutgoingContext(ctx, "pipeline", "missing"), logMessage("hello"))
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, "pipeline <missing> was not loaded", status.Convert(err).Message())
+
+	_, err = client.Process(ctx, protobuf.FromEvent(event.New()))
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "uppercase.processors[1].uppercase")
+
+	_, err = client.Process(ctx, &protobuf.MessageWrapper{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestPipelineServiceProcessStream(t *testing.T) {
+	client := newPipelineServiceClient(t, uppercasePipeline)
+
+	stream, err := client.ProcessStream(context.Background())
+	require.NoError(t, err)
+
+	for _, msg := range []string{"a", "drop", "b"} {
+		require.NoError(t, stream.Send(logMessage(msg)))
+	}
+	require.NoError(t, stream.CloseSend())
+
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "A", messageOf(t, resp))
+	resp, err = stream.Recv()
+	require.NoError(t, err)
+	assert.Nil(t, resp.GetMessage())
+	resp, err = stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "B", messageOf(t, resp))
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+
+	// A failed event is answered with the original event and the failure,
+	// and the stream continues.
+	stream, err = client.ProcessStream(context.Background())
+	require.NoError(t, err)
+	failing := event.New()
+	failing.Put("user.name", event.String("a"))
+	for _, msg := range []*protobuf.MessageWrapper{logMessage("a"), protobuf.FromEvent(failing), logMessage("b")} {
+		require.NoError(t, stream.Send(msg))
+	}
+	require.NoError(t, stream.CloseSend())
+
+	resp, err = stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "A", messageOf(t, resp))
+	resp, err = stream.Recv()
+	require.NoError(t, err)
+	require.NotNil(t, resp.GetLog())
+	data, err := protobuf.ToLogEvent(resp.GetLog()).MarshalJSON()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"user": {"name": "a"},
+		"error": {
+			"message": "key <message> is missing from event",
+			"pipeline_id": "uppercase",
+			"processor_id": "uppercase.processors[1].uppercase",
+			"processor_type": "uppercase"
+		}
+	}`, string(data))
+	resp, err = stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "B", messageOf(t, resp))
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,91 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/andrewkroh/go-sawmill/pkg/pipeline"
+)
+
+// simulateCommand processes the input and writes a JSON result for each event
+// that describes the execution of every processor and the changes it made.
+func simulateCommand(args []string) error {
+	var paths stringsFlag
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	fs.Var(&paths, "p", "pipeline definition file or directory of files (can be repeated)")
+	id := fs.String("pipeline", "", "ID of the pipeline used to process the input (defaults to the first pipeline loaded)")
+	var input inputConfig
+	input.addFlags(fs)
+	pretty := fs.Bool("pretty", false, "indent the JSON output")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s simulate [flags] [file ...]\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	input.paths = fs.Args()
+	if err := input.check(); err != nil {
+		return err
+	}
+
+	set, pipe, err := loadPipelineSet(paths, *id)
+	if err != nil {
+		return err
+	}
+	defer set.Close()
+
+	ctx, cancel := inputContext(input)
+	defer cancel()
+
+	return simulateInput(ctx, os.Stdin, os.Stdout, pipe, input, *pretty)
+}
+
+func simulateInput(ctx context.Context, in io.Reader, out io.Writer, pipe *pipeline.Pipeline, input inputConfig, pretty bool) error {
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	if pretty {
+		enc.SetIndent("", "  ")
+	}
+
+	inputs := make(chan inputEvent)
+	var readErr error
+	go func() {
+		defer close(inputs)
+		readErr = readSources(ctx, in, input, inputs)
+	}()
+
+	for e := range inputs {
+		if e.err != nil {
+			log.Printf("Error processing line %d: %v", e.lineNumber, e.err)
+			continue
+		}
+		if err := enc.Encode(pipe.Simulate(e.event)); err != nil {
+			log.Printf("Unexpected error marshaling simulation result from line %d to JSON: %v", e.lineNumber, err)
+		}
+	}
+
+	return readErr
+}
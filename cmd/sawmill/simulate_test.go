@@ -0,0 +1,79 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrewkroh/go-sawmill/pkg/pipeline"
+)
+
+func TestSimulateInput(t *testing.T) {
+	pipe, err := pipeline.New(&pipeline.Config{
+		ID: "simulate",
+		Processors: []pipeline.ProcessorConfig{
+			{
+				"lowercase": &pipeline.ProcessorOptionConfig{
+					ID: "lower",
+					Config: map[string]interface{}{
+						"field":        "event.original",
+						"target_field": "message",
+					},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer pipe.Close()
+
+	var out bytes.Buffer
+	require.NoError(t, simulateInput(context.Background(), strings.NewReader("HELLO\n\nWORLD\n"), &out, pipe, testInputConfig(inputFormatRaw), false))
+
+	dec := json.NewDecoder(&out)
+	for _, msg := range []string{"hello", "world"} {
+		var result struct {
+			ProcessorResults []struct {
+				ProcessorID string `json:"processor_id"`
+				Status      string `json:"status"`
+				Changes     []struct {
+					Op  string      `json:"op"`
+					Key string      `json:"key"`
+					New interface{} `json:"new"`
+				} `json:"changes"`
+			} `json:"processor_results"`
+		}
+		require.NoError(t, dec.Decode(&result))
+		require.Len(t, result.ProcessorResults, 1)
+
+		r := result.ProcessorResults[0]
+		assert.Equal(t, "lower", r.ProcessorID)
+		assert.Equal(t, "success", r.Status)
+		require.Len(t, r.Changes, 1)
+		assert.Equal(t, "add", r.Changes[0].Op)
+		assert.Equal(t, "message", r.Changes[0].Key)
+		assert.Equal(t, msg, r.Changes[0].New)
+	}
+	assert.False(t, dec.More())
+}
@@ -0,0 +1,351 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+	"github.com/andrewkroh/go-sawmill/pkg/eventutil"
+	"github.com/andrewkroh/go-sawmill/pkg/syslog"
+)
+
+// maxDatagramSize is the size of the buffer used to receive UDP and unixgram
+// messages.
+const maxDatagramSize = 64 * 1024
+
+// syslogConfig configures the syslog listeners. Empty addresses are not
+// listened on.
+type syslogConfig struct {
+	udpAddr  string
+	tcpAddr  string
+	unixPath string // Path of a unixgram socket.
+	maxBytes int    // Maximum size of a message. Longer messages are truncated.
+}
+
+// syslogServer receives syslog messages on UDP, TCP, and unixgram sockets
+// and converts them to events.
+type syslogServer struct {
+	maxBytes int
+	udp      net.PacketConn
+	tcp      net.Listener
+	unix     net.PacketConn
+	unixPath string
+	sequence uint64 // Number of messages received. Accessed atomically.
+}
+
+// newSyslogServer binds the listeners in c. The messages are not received
+// until serve is called.
+func newSyslogServer(c syslogConfig) (*syslogServer, error) {
+	s := &syslogServer{maxBytes: c.maxBytes}
+	var err error
+	if c.udpAddr != "" {
+		if s.udp, err = net.ListenPacket("udp", c.udpAddr); err != nil {
+			s.close()
+			return nil, err
+		}
+	}
+	if c.tcpAddr != "" {
+		if s.tcp, err = net.Listen("tcp", c.tcpAddr); err != nil {
+			s.close()
+			return nil, err
+		}
+	}
+	if c.unixPath != "" {
+		if s.unix, err = net.ListenPacket("unixgram", c.unixPath); err != nil {
+			s.close()
+			return nil, err
+		}
+		s.unixPath = c.unixPath
+	}
+	return s, nil
+}
+
+// addrs returns the addresses of the listeners.
+func (s *syslogServer) addrs() []string {
+	var addrs []string
+	if s.udp != nil {
+		addrs = append(addrs, "udp://"+s.udp.LocalAddr().String())
+	}
+	if s.tcp != nil {
+		addrs = append(addrs, "tcp://"+s.tcp.Addr().String())
+	}
+	if s.unix != nil {
+		addrs = append(addrs, "unixgram://"+s.unixPath)
+	}
+	return addrs
+}
+
+// close closes the listeners and removes the unixgram socket file.
+func (s *syslogServer) close() {
+	if s.udp != nil {
+		s.udp.Close()
+	}
+	if s.tcp != nil {
+		s.tcp.Close()
+	}
+	if s.unix != nil {
+		s.unix.Close()
+		os.Remove(s.unixPath)
+	}
+}
+
+// serve receives messages and sends them as events until ctx is done or a
+// listener fails. The listeners are closed before it returns.
+func (s *syslogServer) serve(ctx context.Context, events chan<- inputEvent) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		serveErr error
+	)
+	run := func(f func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := f(); err != nil && ctx.Err() == nil {
+				errOnce.Do(func() { serveErr = err })
+				cancel()
+			}
+		}()
+	}
+
+	if s.udp != nil {
+		run(func() error { return s.readPackets(s.udp, events) })
+	}
+	if s.unix != nil {
+		run(func() error { return s.readPackets(s.unix, events) })
+	}
+	if s.tcp != nil {
+		run(func() error {
+			for {
+				conn, err := s.tcp.Accept()
+				if err != nil {
+					return err
+				}
+				run(func() error { return s.readStream(ctx, conn, events) })
+			}
+		})
+	}
+
+	<-ctx.Done()
+	s.close()
+	wg.Wait()
+	return serveErr
+}
+
+// readPackets sends an event for each datagram received on conn.
+func (s *syslogServer) readPackets(conn net.PacketConn, events chan<- inputEvent) error {
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		msg := strings.TrimRight(string(buf[:n]), "\r\n")
+		var truncated bool
+		if len(msg) > s.maxBytes {
+			msg, truncated = truncateUTF8(msg[:s.maxBytes]), true
+		}
+		s.send(msg, truncated, addr, events)
+	}
+}
+
+// readStream sends an event for each message received on a TCP connection.
+// The framing is detected from the first byte of the connection as described
+// in RFC 6587. Messages that begin with a digit use octet counting (the
+// message length and a space precede each message), otherwise each message
+// ends with a newline.
+func (s *syslogServer) readStream(ctx context.Context, conn net.Conn, events chan<- inputEvent) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil
+	}
+
+	if first[0] < '0' || first[0] > '9' {
+		lines := newLineReader(r, s.maxBytes, 0)
+		for {
+			line, truncated, err := lines.next()
+			if err != nil {
+				return nil
+			}
+			if line != "" {
+				s.send(line, truncated, conn.RemoteAddr(), events)
+			}
+		}
+	}
+
+	for {
+		msg, truncated, err := s.readOctetCounted(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				events <- inputEvent{lineNumber: s.next(), err: fmt.Errorf("failed reading syslog stream: %w", err)}
+			}
+			return nil
+		}
+		s.send(msg, truncated, conn.RemoteAddr(), events)
+	}
+}
+
+// readOctetCounted reads a message framed as "MSG-LEN SP SYSLOG-MSG".
+// Messages longer than maxBytes are truncated.
+func (s *syslogServer) readOctetCounted(r *bufio.Reader) (msg string, truncated bool, err error) {
+	length, err := r.ReadString(' ')
+	if err != nil {
+		if errors.Is(err, io.EOF) && strings.TrimSpace(length) != "" {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", false, err
+	}
+	n, err := strconv.Atoi(strings.TrimLeft(length[:len(length)-1], "\r\n"))
+	if err != nil || n < 1 {
+		return "", false, fmt.Errorf("invalid message length %q", strings.TrimSpace(length))
+	}
+
+	size := n
+	if size > s.maxBytes {
+		size, truncated = s.maxBytes, true
+	}
+	buf := make([]byte, size)
+	if _, err = io.ReadFull(r, buf); err != nil {
+		return "", false, unexpectedEOF(err)
+	}
+	if _, err = r.Discard(n - size); err != nil {
+		return "", false, unexpectedEOF(err)
+	}
+
+	msg = strings.TrimRight(string(buf), "\r\n")
+	if truncated {
+		msg = truncateUTF8(msg)
+	}
+	return msg, truncated, nil
+}
+
+// unexpectedEOF converts io.EOF to io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// next returns the sequence number of the next message.
+func (s *syslogServer) next() uint64 {
+	return atomic.AddUint64(&s.sequence, 1)
+}
+
+// send sends an event for the message. A message that cannot be parsed is
+// sent as an input error with the sequence number of the message.
+func (s *syslogServer) send(msg string, truncated bool, remote net.Addr, events chan<- inputEvent) {
+	sequence := s.next()
+	evt, err := syslogEvent(msg, truncated, remote, time.Now())
+	if err != nil {
+		events <- inputEvent{lineNumber: sequence, err: fmt.Errorf("failed to parse syslog message: %w", err), raw: msg}
+		return
+	}
+	evt.Put("@metadata.line_number", event.UnsignedInteger(sequence))
+	events <- inputEvent{lineNumber: sequence, event: evt}
+}
+
+// syslogEvent parses a syslog message and returns an event containing its
+// header as ECS fields. The message that follows the header is stored in
+// message and the whole message is stored in event.original. The receive
+// time is used as @timestamp if the message does not contain one.
+func syslogEvent(msg string, truncated bool, remote net.Addr, now time.Time) (*event.Event, error) {
+	m, err := syslog.Parse(msg, now)
+	if err != nil {
+		return nil, err
+	}
+
+	evt := event.New()
+	evt.Put("event.original", event.String(msg))
+	if truncated {
+		eventutil.Append(evt, "log.flags", event.String("truncated"))
+	}
+
+	timestamp := m.Timestamp
+	if timestamp.IsZero() {
+		timestamp = now
+	}
+	evt.Put("@timestamp", event.Timestamp(timestamp.UnixNano()))
+
+	evt.Put("log.syslog.priority", event.Integer(int64(m.Priority)))
+	evt.Put("log.syslog.facility.code", event.Integer(int64(m.Facility())))
+	evt.Put("log.syslog.severity.code", event.Integer(int64(m.Severity())))
+	if m.Version > 0 {
+		evt.Put("log.syslog.version", event.String(strconv.Itoa(m.Version)))
+	}
+	if m.Hostname != "" {
+		evt.Put("host.hostname", event.String(m.Hostname))
+		evt.Put("log.syslog.hostname", event.String(m.Hostname))
+	}
+	if m.AppName != "" {
+		evt.Put("process.name", event.String(m.AppName))
+		evt.Put("log.syslog.appname", event.String(m.AppName))
+	}
+	if m.ProcID != "" {
+		evt.Put("log.syslog.procid", event.String(m.ProcID))
+		if pid, err := strconv.ParseInt(m.ProcID, 10, 64); err == nil {
+			evt.Put("process.pid", event.Integer(pid))
+		}
+	}
+	if m.MsgID != "" {
+		evt.Put("log.syslog.msgid", event.String(m.MsgID))
+	}
+	if len(m.StructuredData) > 0 {
+		// Objects are used because SD-IDs and parameter names may contain dots.
+		sd := make(map[string]*event.Value, len(m.StructuredData))
+		for id, params := range m.StructuredData {
+			values := make(map[string]*event.Value, len(params))
+			for name, value := range params {
+				values[name] = event.String(value)
+			}
+			sd[id] = event.Object(values)
+		}
+		evt.Put("log.syslog.structured_data", event.Object(sd))
+	}
+	evt.Put("message", event.String(m.Message))
+	if remote != nil && remote.String() != "" {
+		evt.Put("log.source.address", event.String(remote.String()))
+	}
+	return evt, nil
+}
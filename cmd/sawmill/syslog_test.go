@@ -0,0 +1,195 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+)
+
+func TestSyslogEvent(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	remote := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5514}
+
+	evt, err := syslogEvent(`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog 1234 ID47 [exampleSDID@32473 iut="3" eventSource="Application"] An application event`, false, remote, now)
+	require.NoError(t, err)
+	assert.Equal(t, event.Timestamp(time.Date(2003, 10, 11, 22, 14, 15, 3e6, time.UTC).UnixNano()), evt.Get("@timestamp"))
+	assert.Equal(t, event.Integer(165), evt.Get("log.syslog.priority"))
+	assert.Equal(t, event.Integer(20), evt.Get("log.syslog.facility.code"))
+	assert.Equal(t, event.Integer(5), evt.Get("log.syslog.severity.code"))
+	assert.Equal(t, event.String("mymachine.example.com"), evt.Get("host.hostname"))
+	assert.Equal(t, event.String("evntslog"), evt.Get("process.name"))
+	assert.Equal(t, event.Integer(1234), evt.Get("process.pid"))
+	assert.Equal(t, event.String("ID47"), evt.Get("log.syslog.msgid"))
+	assert.Equal(t, event.String("Application"), evt.Get("log.syslog.structured_data").Object["exampleSDID@32473"].Object["eventSource"])
+	assert.Equal(t, event.String("An application event"), evt.Get("message"))
+	assert.Equal(t, event.String("127.0.0.1:5514"), evt.Get("log.source.address"))
+
+	evt, err = syslogEvent("<34>Oct 11 22:14:15 mymachine su[42]: 'su root' failed", true, nil, now)
+	require.NoError(t, err)
+	assert.Equal(t, event.Timestamp(time.Date(2020, 10, 11, 22, 14, 15, 0, time.UTC).UnixNano()), evt.Get("@timestamp"))
+	assert.Equal(t, event.String("mymachine"), evt.Get("host.hostname"))
+	assert.Equal(t, event.String("su"), evt.Get("process.name"))
+	assert.Equal(t, event.Integer(42), evt.Get("process.pid"))
+	assert.Equal(t, event.String("'su root' failed"), evt.Get("message"))
+	assert.Equal(t, event.Array(event.String("truncated")), evt.Get("log.flags"))
+	assert.Nil(t, evt.Get("log.source.address"))
+
+	// The receive time is used when the message has no timestamp.
+	evt, err = syslogEvent("<13>hello", false, nil, now)
+	require.NoError(t, err)
+	assert.Equal(t, event.Timestamp(now.UnixNano()), evt.Get("@timestamp"))
+	assert.Equal(t, event.String("hello"), evt.Get("message"))
+
+	_, err = syslogEvent("hello", false, nil, now)
+	assert.Error(t, err)
+}
+
+// startSyslogServer starts a syslog server on loopback sockets and returns it
+// along with the channel that receives its events. The server is stopped when
+// the test ends.
+func startSyslogServer(t *testing.T) (*syslogServer, <-chan inputEvent) {
+	t.Helper()
+
+	s, err := newSyslogServer(syslogConfig{
+		udpAddr:  "127.0.0.1:0",
+		tcpAddr:  "127.0.0.1:0",
+		unixPath: filepath.Join(t.TempDir(), "syslog.sock"),
+		maxBytes: 16,
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan inputEvent, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- s.serve(ctx, events)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		assert.NoError(t, <-done)
+	})
+	return s, events
+}
+
+// receiveMessages returns the message field, or the error, of the next n
+// events sorted in lexical order.
+func receiveMessages(t *testing.T, events <-chan inputEvent, n int) []string {
+	t.Helper()
+
+	var messages []string
+	for i := 0; i < n; i++ {
+		select {
+		case e := <-events:
+			if e.err != nil {
+				messages = append(messages, "error: "+e.err.Error())
+				continue
+			}
+			messages = append(messages, e.event.Get("message").String)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out after receiving %d of %d messages", i, n)
+		}
+	}
+	sort.Strings(messages)
+	return messages
+}
+
+func TestSyslogServerPackets(t *testing.T) {
+	s, events := startSyslogServer(t)
+
+	for _, addr := range []net.Addr{s.udp.LocalAddr(), s.unix.LocalAddr()} {
+		conn, err := net.Dial(addr.Network(), addr.String())
+		require.NoError(t, err)
+		defer conn.Close()
+
+		_, err = conn.Write([]byte("<13>" + addr.Network() + "\n"))
+		require.NoError(t, err)
+		_, err = conn.Write([]byte("<13>truncated after max-bytes"))
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{"truncated af", "truncated af", "udp", "unixgram"}, receiveMessages(t, events, 4))
+}
+
+func TestSyslogServerTCP(t *testing.T) {
+	testCases := []struct {
+		name     string
+		data     string
+		messages []string
+	}{
+		{
+			name:     "newline",
+			data:     "<13>one\r\n\n<13>two\n<13>truncated after max-bytes\n<13>three",
+			messages: []string{"one", "three", "truncated af", "two"},
+		},
+		{
+			name:     "octet counting",
+			data:     "7 <13>one9 <13>two\n\n29 <13>truncated after max-bytes5 <13>3",
+			messages: []string{"3", "one", "truncated af", "two"},
+		},
+		{
+			name:     "invalid length",
+			data:     "7 <13>onex <13>two",
+			messages: []string{`error: failed reading syslog stream: invalid message length "x"`, "one"},
+		},
+		{
+			name:     "incomplete message",
+			data:     "7 <13>one9 <13>",
+			messages: []string{"error: failed reading syslog stream: unexpected EOF", "one"},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			s, events := startSyslogServer(t)
+
+			conn, err := net.Dial("tcp", s.tcp.Addr().String())
+			require.NoError(t, err)
+			_, err = conn.Write([]byte(tc.data))
+			require.NoError(t, err)
+			require.NoError(t, conn.Close())
+
+			assert.Equal(t, tc.messages, receiveMessages(t, events, len(tc.messages)))
+		})
+	}
+}
+
+func TestSyslogServerParseError(t *testing.T) {
+	s, events := startSyslogServer(t)
+
+	conn, err := net.Dial("udp", s.udp.LocalAddr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("not syslog"))
+	require.NoError(t, err)
+
+	messages := receiveMessages(t, events, 1)
+	require.Len(t, messages, 1)
+	assert.True(t, strings.HasPrefix(messages[0], "error: failed to parse syslog message: "), messages[0])
+}
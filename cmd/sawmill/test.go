@@ -0,0 +1,132 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/andrewkroh/go-sawmill/pkg/pipeline/pipelinetest"
+)
+
+const (
+	colorReset = "\x1b[0m"
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorCyan  = "\x1b[36m"
+)
+
+// testCommand runs the pipeline test cases found in each directory given as
+// an argument (defaults to the current directory).
+func testCommand(args []string) error {
+	fs := flag.NewFlagSet("test", flag.ExitOnError)
+	update := fs.Bool("update", false, "write the actual output to the expected output files")
+	noColor := fs.Bool("no-color", false, "disable colored output")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s test [flags] [dir ...]\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	dirs := fs.Args()
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+
+	color := !*noColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+	return runTests(os.Stdout, dirs, *update, color)
+}
+
+func runTests(out io.Writer, dirs []string, update, color bool) error {
+	paint := func(c, s string) string {
+		if !color {
+			return s
+		}
+		return c + s + colorReset
+	}
+
+	var passed, failed int
+	for _, dir := range dirs {
+		cases, err := pipelinetest.FindCases(dir)
+		if err != nil {
+			return err
+		}
+
+		for _, c := range cases {
+			result, err := c.Run(update)
+			switch {
+			case err != nil:
+				failed++
+				fmt.Fprintf(out, "%s %s: %v\n", paint(colorRed, "FAIL"), c.InputFile, err)
+			case result.Updated:
+				passed++
+				fmt.Fprintf(out, "%s %s\n", paint(colorCyan, "UPDATED"), c.ExpectedFile)
+			case result.Failed():
+				failed++
+				fmt.Fprintf(out, "%s %s\n", paint(colorRed, "FAIL"), c.InputFile)
+				writeDiff(out, result.Diff, paint)
+			default:
+				passed++
+				fmt.Fprintf(out, "%s %s\n", paint(colorGreen, "PASS"), c.InputFile)
+			}
+		}
+	}
+
+	fmt.Fprintf(out, "\n%d passed, %d failed\n", passed, failed)
+	switch {
+	case failed > 0:
+		return fmt.Errorf("%d of %d test cases failed", failed, passed+failed)
+	case passed == 0:
+		return fmt.Errorf("no pipeline test cases found in %v", dirs)
+	}
+	return nil
+}
+
+// writeDiff writes an indented unified diff with removed lines in red and
+// added lines in green.
+func writeDiff(out io.Writer, diff string, paint func(color, s string) string) {
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		if line == "" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "---"), strings.HasPrefix(line, "+++"):
+		case strings.HasPrefix(line, "-"):
+			line = paint(colorRed, strings.TrimSuffix(line, "\n")) + "\n"
+		case strings.HasPrefix(line, "+"):
+			line = paint(colorGreen, strings.TrimSuffix(line, "\n")) + "\n"
+		case strings.HasPrefix(line, "@@"):
+			line = paint(colorCyan, strings.TrimSuffix(line, "\n")) + "\n"
+		}
+		fmt.Fprint(out, "    ", line)
+	}
+}
+
+// isTerminal returns true if f is a character device (e.g. a terminal).
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
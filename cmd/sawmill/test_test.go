@@ -0,0 +1,62 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunTests(t *testing.T) {
+	const testdata = "../../pkg/pipeline/pipelinetest/testdata"
+
+	t.Run("pass", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, runTests(&out, []string{testdata}, false, false))
+		assert.Contains(t, out.String(), "PASS "+filepath.Join(testdata, "greeting.log"))
+		assert.Contains(t, out.String(), "2 passed, 0 failed")
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		dir := t.TempDir()
+		for _, name := range []string{"greeting.pipeline.yml", "greeting.log", "greeting-expected.json"} {
+			data, err := os.ReadFile(filepath.Join(testdata, name))
+			require.NoError(t, err)
+			data = bytes.ReplaceAll(data, []byte("hello world"), []byte("HELLO WORLD"))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o644))
+		}
+
+		var out bytes.Buffer
+		err := runTests(&out, []string{dir}, false, true)
+		require.Error(t, err)
+		assert.Contains(t, out.String(), colorRed+"FAIL"+colorReset)
+		assert.Contains(t, out.String(), colorRed+`-      "message": "HELLO WORLD"`+colorReset)
+		assert.Contains(t, out.String(), colorGreen+`+      "message": "hello world"`+colorReset)
+		assert.Contains(t, out.String(), "0 passed, 1 failed")
+	})
+
+	t.Run("no cases", func(t *testing.T) {
+		var out bytes.Buffer
+		require.Error(t, runTests(&out, []string{t.TempDir()}, false, false))
+	})
+}
@@ -0,0 +1,96 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/andrewkroh/go-sawmill/pkg/pipeline"
+)
+
+// validateCommand validates the pipeline files given as arguments and reports
+// all problems with their positions.
+func validateCommand(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s validate <file or dir> ...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("at least one pipeline file or directory must be specified")
+	}
+
+	return validatePipelines(os.Stdout, fs.Args())
+}
+
+func validatePipelines(out io.Writer, paths []string) error {
+	var files []string
+	for _, path := range paths {
+		f, err := pipelineFilesInPath(path)
+		if err != nil {
+			return err
+		}
+		files = append(files, f...)
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no pipeline files found in %v", paths)
+	}
+
+	var problems int
+	pipelineFiles := map[string]string{} // Pipeline ID to file.
+	for _, file := range files {
+		errs, err := pipeline.ValidateFile(file)
+		if err != nil {
+			problems++
+			fmt.Fprintf(out, "%s: %v\n", file, err)
+			continue
+		}
+		for _, e := range errs {
+			source := file
+			if e.File != "" {
+				source = e.File
+			}
+			fmt.Fprintf(out, "%s:%d:%d: %s: %s\n", source, e.Line, e.Column, e.Path, e.Message)
+		}
+		problems += len(errs)
+
+		// Pipeline IDs must be unique for the pipelines to be loaded together.
+		if c, err := loadPipeline(file); err == nil && c != nil && c.ID != "" {
+			if first, found := pipelineFiles[c.ID]; found {
+				problems++
+				fmt.Fprintf(out, "%s: duplicate pipeline id %q (first defined in %s)\n", file, c.ID, first)
+			} else {
+				pipelineFiles[c.ID] = file
+			}
+		}
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("found %d problems in %d pipeline files", problems, len(files))
+	}
+	fmt.Fprintf(out, "%d pipeline files are valid\n", len(files))
+	return nil
+}
@@ -0,0 +1,60 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatePipelines(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644))
+	}
+	write("a.yml", `id: a
+processors:
+  - lowercase:
+      field: message
+`)
+	write("b.yml", `id: a
+processors:
+  - lowercase:
+      fields: message
+`)
+
+	var out bytes.Buffer
+	require.NoError(t, validatePipelines(&out, []string{filepath.Join(dir, "a.yml")}))
+	assert.Equal(t, "1 pipeline files are valid\n", out.String())
+
+	out.Reset()
+	err := validatePipelines(&out, []string{dir})
+	require.Error(t, err)
+	assert.Equal(t, "found 3 problems in 2 pipeline files", err.Error())
+
+	b := filepath.Join(dir, "b.yml")
+	assert.Equal(t, b+`:3:5: processors[0].lowercase: missing required option "field" for processor type lowercase
+`+b+`:4:7: processors[0].lowercase.fields: unknown option "fields" for processor type lowercase (did you mean "field"?)
+`+b+`: duplicate pipeline id "a" (first defined in `+filepath.Join(dir, "a.yml")+`)
+`, out.String())
+}
@@ -0,0 +1,120 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"sync"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+)
+
+// inputEvent is an event read from a line of input.
+type inputEvent struct {
+	lineNumber uint64
+	offset     int64         // Byte offset of the event in the input.
+	end        inputPosition // Position in the input after the event.
+	cursor     *fileCursor   // Records the progress of the input file. Nil if not recorded.
+	event      *event.Event
+	err        error  // Non-nil if the input could not be decoded into an event.
+	raw        string // Input that could not be decoded. Empty if unknown.
+}
+
+// outputEvent is the result of processing an inputEvent.
+type outputEvent struct {
+	lineNumber uint64
+	end        inputPosition
+	cursor     *fileCursor
+	event      *event.Event // Nil if the event was dropped or failed.
+	original   *event.Event // Copy of the input event. Only set if processing failed and originals are kept.
+	err        error
+}
+
+// commit records that the output for the event has been written.
+func (o outputEvent) commit() {
+	if o.cursor != nil {
+		o.cursor.commit(o.end)
+	}
+}
+
+// processFunc processes an event. It returns a nil event if the event was
+// dropped.
+type processFunc func(evt *event.Event) (*event.Event, error)
+
+type workItem struct {
+	in     inputEvent
+	result chan<- outputEvent
+}
+
+// processEvents processes the events received from in using the given number
+// of worker goroutines. Results are written to out in the same order that the
+// events were received. At most 2*workers events are in-flight at any time.
+// out is closed after in is closed and all events have been processed. If
+// keepOriginals is true then the results of failed events include a copy of
+// the event as it was before processing. For input that could not be decoded
+// it is an event containing the raw input as event.original.
+func processEvents(process processFunc, workers int, keepOriginals bool, in <-chan inputEvent, out chan<- outputEvent) {
+	defer close(out)
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	work := make(chan workItem, workers)
+	pending := make(chan (<-chan outputEvent), workers)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for item := range work {
+				o := outputEvent{lineNumber: item.in.lineNumber, end: item.in.end, cursor: item.in.cursor, err: item.in.err}
+				if o.err == nil {
+					var original *event.Event
+					if keepOriginals {
+						original = item.in.event.Clone()
+					}
+					if o.event, o.err = process(item.in.event); o.err != nil {
+						o.original = original
+					}
+				} else if keepOriginals && item.in.raw != "" {
+					o.original, _ = rawEvent(item.in.raw, false)
+					o.original.Put("@metadata.line_number", event.UnsignedInteger(item.in.lineNumber))
+				}
+				item.result <- o
+			}
+		}()
+	}
+
+	// Dispatch work while recording the input order. The order is preserved
+	// by reading each event's result channel in the order it was dispatched.
+	go func() {
+		defer close(pending)
+		defer close(work)
+		for e := range in {
+			result := make(chan outputEvent, 1)
+			pending <- result
+			work <- workItem{in: e, result: result}
+		}
+	}()
+
+	for result := range pending {
+		out <- <-result
+	}
+	wg.Wait()
+}
@@ -0,0 +1,82 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+	"github.com/andrewkroh/go-sawmill/pkg/pipeline"
+)
+
+func TestProcessInputWorkers(t *testing.T) {
+	pipe, err := pipeline.New(&pipeline.Config{
+		ID: "uppercase",
+		Processors: []pipeline.ProcessorConfig{
+			{
+				"uppercase": &pipeline.ProcessorOptionConfig{
+					Config: map[string]interface{}{
+						"field":        "event.original",
+						"target_field": "message",
+					},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer pipe.Close()
+
+	const lines = 500
+	var input strings.Builder
+	for i := 1; i <= lines; i++ {
+		fmt.Fprintf(&input, "line-%d\n", i)
+	}
+
+	for _, n := range []int{1, 8} {
+		n := n
+		t.Run(fmt.Sprintf("workers=%d", n), func(t *testing.T) {
+			defer func(n int) { workers = n }(workers)
+			workers = n
+
+			process := func(evt *event.Event) (*event.Event, error) {
+				return processEvent(pipe, evt)
+			}
+
+			var out bytes.Buffer
+			require.NoError(t, processInput(context.Background(), strings.NewReader(input.String()), &out, process))
+
+			dec := json.NewDecoder(&out)
+			for i := 1; i <= lines; i++ {
+				var evt struct {
+					Message string `json:"message"`
+				}
+				require.NoError(t, dec.Decode(&evt))
+				assert.Equal(t, fmt.Sprintf("LINE-%d", i), evt.Message)
+			}
+			assert.False(t, dec.More())
+		})
+	}
+}
@@ -40,16 +40,30 @@ func Load(jsonPipeline *C.char) int32 {
 		return 1
 	}
 
-	var err error
-	pipe, err = pipeline.New(config)
+	newPipe, err := pipeline.New(config)
 	if err != nil {
 		fmt.Println(err)
 		return 1
 	}
 
+	// Release the resources held by a previously loaded pipeline.
+	Close()
+	pipe = newPipe
+
 	return 0
 }
 
+//export Close
+func Close() {
+	if pipe == nil {
+		return
+	}
+	if err := pipe.Close(); err != nil {
+		fmt.Println(err)
+	}
+	pipe = nil
+}
+
 //export Process
 func Process(input *C.char) *C.char {
 	jsonData := C.GoString(input)
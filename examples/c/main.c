@@ -18,4 +18,7 @@ int main() {
     printf("Calling Process() with input = %s\n", in);
     char* out = Process(in);
     printf("Process() returned: %s\n", out);
+
+    // Release pipeline resources.
+    Close();
 }
@@ -48,6 +48,7 @@ func process(this js.Value, args []js.Value) interface{} {
 	if err != nil {
 		return "failed to create new pipeline: " + err.Error()
 	}
+	defer pipe.Close()
 
 	var event *event.Event
 	if err = json.Unmarshal([]byte(eventJSON), &event); err != nil {
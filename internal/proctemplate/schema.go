@@ -32,6 +32,10 @@ type Processors struct {
 type Processor struct {
 	Description   string
 	Configuration []ConfigurationOption
+
+	// Builtin processors are implemented by the pipeline package so no code
+	// is generated for them.
+	Builtin bool
 }
 
 type ConfigurationOption struct {
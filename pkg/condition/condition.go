@@ -0,0 +1,346 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package condition implements the expression language used by the "if"
+// option of processors.
+//
+// A condition is a boolean expression composed of comparisons between event
+// fields and literals. For example:
+//
+//	event.kind == "alert" && (event.severity >= 3 || tags == null)
+//
+// Operators in order of increasing precedence:
+//
+//	||                   logical or
+//	&&                   logical and
+//	== != < <= > >=      comparison
+//	!                    logical not
+//
+// Operands are field references (dot-separated keys like event.kind),
+// strings in single or double quotes, numbers, true, false, and null.
+// Parentheses can be used for grouping. A field that does not exist is null.
+// Numbers of different types are compared by value. Ordering comparisons
+// apply to numbers, strings, and timestamps and are false for other types.
+// The logical operators treat only the boolean value true as true.
+package condition
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+)
+
+// Op is a binary operator.
+type Op string
+
+const (
+	OpOr  Op = "||"
+	OpAnd Op = "&&"
+	OpEq  Op = "=="
+	OpNe  Op = "!="
+	OpLt  Op = "<"
+	OpLte Op = "<="
+	OpGt  Op = ">"
+	OpGte Op = ">="
+)
+
+// precedence returns the binding strength of the operator. Higher values
+// bind more tightly.
+func (op Op) precedence() int {
+	switch op {
+	case OpOr:
+		return 1
+	case OpAnd:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// Expr is a node in the syntax tree of a condition. It is one of *Binary,
+// *Not, *Field, or *Literal.
+type Expr interface {
+	fmt.Stringer
+	eval(evt Getter) *event.Value
+}
+
+// Binary is a logical operation or comparison of two expressions.
+type Binary struct {
+	Op          Op
+	Left, Right Expr
+}
+
+// Not is the logical negation of an expression.
+type Not struct {
+	X Expr
+}
+
+// Field is a reference to the value of an event field.
+type Field struct {
+	Name string // Dot-separated key.
+}
+
+// Literal is a constant value. Its type is one of string, integer, float,
+// bool, or null.
+type Literal struct {
+	Value *event.Value
+}
+
+// Getter provides access to event fields. processor.Event implements it.
+type Getter interface {
+	Get(key string) *event.Value
+}
+
+// Condition is a parsed condition expression. It is safe for concurrent use.
+type Condition struct {
+	source string
+	expr   Expr
+}
+
+// Parse parses the expression. The returned error is a *SyntaxError.
+func Parse(expr string) (*Condition, error) {
+	p := &parser{lex: lexer{input: expr}}
+	p.next()
+
+	root, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokenEOF || p.err != nil {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+
+	return &Condition{source: expr, expr: root}, nil
+}
+
+// MustParse is like Parse, but it panics if the expression cannot be parsed.
+func MustParse(expr string) *Condition {
+	c, err := Parse(expr)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Eval evaluates the condition against the event.
+func (c *Condition) Eval(evt Getter) bool {
+	return isTrue(c.expr.eval(evt))
+}
+
+// Expr returns the root of the syntax tree.
+func (c *Condition) Expr() Expr {
+	return c.expr
+}
+
+// Source returns the expression that was parsed.
+func (c *Condition) Source() string {
+	return c.source
+}
+
+// String returns the expression in a normalized form.
+func (c *Condition) String() string {
+	return c.expr.String()
+}
+
+func (b *Binary) eval(evt Getter) *event.Value {
+	switch b.Op {
+	case OpOr:
+		return event.Bool(isTrue(b.Left.eval(evt)) || isTrue(b.Right.eval(evt)))
+	case OpAnd:
+		return event.Bool(isTrue(b.Left.eval(evt)) && isTrue(b.Right.eval(evt)))
+	}
+
+	left, right := b.Left.eval(evt), b.Right.eval(evt)
+	switch b.Op {
+	case OpEq:
+		return event.Bool(equal(left, right))
+	case OpNe:
+		return event.Bool(!equal(left, right))
+	}
+
+	cmp, ok := compare(left, right)
+	if !ok {
+		return event.Bool(false)
+	}
+	switch b.Op {
+	case OpLt:
+		return event.Bool(cmp < 0)
+	case OpLte:
+		return event.Bool(cmp <= 0)
+	case OpGt:
+		return event.Bool(cmp > 0)
+	case OpGte:
+		return event.Bool(cmp >= 0)
+	default:
+		return event.Bool(false)
+	}
+}
+
+func (b *Binary) String() string {
+	return operand(b.Left, b.Op.precedence(), false) + " " + string(b.Op) + " " +
+		operand(b.Right, b.Op.precedence(), true)
+}
+
+// operand renders a child of a binary expression. Parentheses are added when
+// the child binds less tightly than its parent. Comparisons are not
+// associative so a comparison on the right side is always parenthesized.
+func operand(x Expr, parentPrecedence int, right bool) string {
+	if b, ok := x.(*Binary); ok {
+		p := b.Op.precedence()
+		if p < parentPrecedence || (p == parentPrecedence && (right || p == OpEq.precedence())) {
+			return "(" + b.String() + ")"
+		}
+	}
+	return x.String()
+}
+
+func (n *Not) eval(evt Getter) *event.Value {
+	return event.Bool(!isTrue(n.X.eval(evt)))
+}
+
+func (n *Not) String() string {
+	if _, ok := n.X.(*Binary); ok {
+		return "!(" + n.X.String() + ")"
+	}
+	return "!" + n.X.String()
+}
+
+func (f *Field) eval(evt Getter) *event.Value {
+	if v := evt.Get(f.Name); v != nil {
+		return v
+	}
+	return event.NullValue
+}
+
+func (f *Field) String() string {
+	return f.Name
+}
+
+func (l *Literal) eval(Getter) *event.Value {
+	return l.Value
+}
+
+func (l *Literal) String() string {
+	switch l.Value.Type {
+	case event.StringType:
+		return strconv.Quote(l.Value.String)
+	case event.IntegerType:
+		return strconv.FormatInt(l.Value.Integer, 10)
+	case event.FloatType:
+		s := strconv.FormatFloat(l.Value.Float, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eEn") {
+			s += ".0"
+		}
+		return s
+	case event.BoolType:
+		return strconv.FormatBool(l.Value.Bool)
+	default:
+		return "null"
+	}
+}
+
+func isTrue(v *event.Value) bool {
+	return v != nil && v.Type == event.BoolType && v.Bool
+}
+
+func equal(a, b *event.Value) bool {
+	if cmp, ok := compareNumbers(a, b); ok {
+		return cmp == 0
+	}
+	return a.Equal(b)
+}
+
+// compare returns -1, 0, or 1 if a is less than, equal to, or greater than b.
+// It returns false if the values cannot be ordered.
+func compare(a, b *event.Value) (int, bool) {
+	if cmp, ok := compareNumbers(a, b); ok {
+		return cmp, true
+	}
+	if a.Type != b.Type {
+		return 0, false
+	}
+
+	switch a.Type {
+	case event.StringType:
+		return strings.Compare(a.String, b.String), true
+	case event.TimestampType:
+		return compareInts(a.Timestamp.UnixNanos, b.Timestamp.UnixNanos), true
+	default:
+		return 0, false
+	}
+}
+
+func compareNumbers(a, b *event.Value) (int, bool) {
+	if !isNumber(a) || !isNumber(b) {
+		return 0, false
+	}
+
+	switch {
+	case a.Type == event.IntegerType && b.Type == event.IntegerType:
+		return compareInts(a.Integer, b.Integer), true
+	case a.Type == event.UnsignedIntegerType && b.Type == event.UnsignedIntegerType:
+		switch {
+		case a.UnsignedInteger < b.UnsignedInteger:
+			return -1, true
+		case a.UnsignedInteger > b.UnsignedInteger:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	af, bf := toFloat(a), toFloat(b)
+	switch {
+	case af < bf:
+		return -1, true
+	case af > bf:
+		return 1, true
+	case af == bf:
+		return 0, true
+	}
+	return 0, false // NaN
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func isNumber(v *event.Value) bool {
+	switch v.Type {
+	case event.IntegerType, event.UnsignedIntegerType, event.FloatType:
+		return true
+	}
+	return false
+}
+
+func toFloat(v *event.Value) float64 {
+	switch v.Type {
+	case event.IntegerType:
+		return float64(v.Integer)
+	case event.UnsignedIntegerType:
+		return float64(v.UnsignedInteger)
+	default:
+		return v.Float
+	}
+}
@@ -0,0 +1,154 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package condition
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+)
+
+func testEvent() *event.Event {
+	evt := event.New()
+	evt.Put("event.kind", event.String("alert"))
+	evt.Put("event.severity", event.Integer(3))
+	evt.Put("event.risk_score", event.Float(47.5))
+	evt.Put("event.sequence", event.UnsignedInteger(10))
+	evt.Put("event.created", event.Timestamp(1000))
+	evt.Put("event.ingested", event.Timestamp(2000))
+	evt.Put("tags", event.Array(event.String("a"), event.String("b")))
+	evt.Put("flags.enabled", event.Bool(true))
+	evt.Put("flags.disabled", event.Bool(false))
+	evt.Put("message", event.String(`it's "quoted"`))
+	return evt
+}
+
+func TestEval(t *testing.T) {
+	testCases := []struct {
+		Expr   string
+		Result bool
+	}{
+		{`event.kind == "alert"`, true},
+		{`event.kind == 'alert'`, true},
+		{`event.kind != "alert"`, false},
+		{`"alert" == event.kind`, true},
+		{`event.severity == 3`, true},
+		{`event.severity == 3.0`, true},
+		{`event.severity > 2 && event.severity <= 3`, true},
+		{`event.severity < 3`, false},
+		{`event.severity >= -1`, true},
+		{`event.risk_score > 47`, true},
+		{`event.risk_score < 4.75e1`, false},
+		{`event.sequence == 10`, true},
+		{`event.sequence > event.severity`, true},
+		{`event.created < event.ingested`, true},
+		{`event.kind > "aaa"`, true},
+		{`event.kind > 1`, false},
+		{`event.kind < 1`, false},
+		{`missing == null`, true},
+		{`missing != null`, false},
+		{`event.kind != null`, true},
+		{`missing > 1`, false},
+		{`flags.enabled`, true},
+		{`flags.disabled`, false},
+		{`!flags.disabled`, true},
+		{`!!flags.enabled`, true},
+		{`event.kind`, false},
+		{`flags.enabled == true`, true},
+		{`flags.disabled == false`, true},
+		{`true`, true},
+		{`false || true`, true},
+		{`true && false`, false},
+		{`false && true || true`, true},
+		{`false && (true || true)`, false},
+		{`!(event.kind == "alert")`, false},
+		{`message == 'it\'s "quoted"'`, true},
+		{`message == "it's \"quoted\""`, true},
+		{`tags == tags`, true},
+		{`tags == "a"`, false},
+		{`event == event`, true},
+	}
+
+	evt := testEvent()
+	for _, tc := range testCases {
+		c, err := Parse(tc.Expr)
+		require.NoError(t, err, tc.Expr)
+		assert.Equal(t, tc.Result, c.Eval(evt), tc.Expr)
+	}
+}
+
+func TestString(t *testing.T) {
+	testCases := []struct {
+		Expr, String string
+	}{
+		{`a == 'b'`, `a == "b"`},
+		{`a==1&&b!=2.5||!c`, `a == 1 && b != 2.5 || !c`},
+		{`(a || b) && c`, `(a || b) && c`},
+		{`a || (b || c)`, `a || (b || c)`},
+		{`(a || b) || c`, `a || b || c`},
+		{`a || b && c`, `a || b && c`},
+		{`!(a == null)`, `!(a == null)`},
+		{`(a == b) == c`, `(a == b) == c`},
+		{`x > 1e3`, `x > 1000.0`},
+		{`@timestamp < 0`, `@timestamp < 0`},
+	}
+
+	for _, tc := range testCases {
+		c, err := Parse(tc.Expr)
+		require.NoError(t, err, tc.Expr)
+		assert.Equal(t, tc.String, c.String(), tc.Expr)
+		assert.Equal(t, tc.Expr, c.Source())
+
+		// The normalized form must parse to the same expression.
+		again, err := Parse(c.String())
+		require.NoError(t, err, c.String())
+		assert.Equal(t, c.Expr(), again.Expr(), tc.Expr)
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	testCases := []struct {
+		Expr   string
+		Offset int
+		Msg    string
+	}{
+		{``, 0, `expected a field, literal, or "(" but found end of expression`},
+		{`a ==`, 4, `expected a field, literal, or "(" but found end of expression`},
+		{`a == b c`, 7, `unexpected "c"`},
+		{`(a == b`, 7, `expected ")" but found end of expression`},
+		{`a == "b`, 5, `unterminated string`},
+		{`a = b`, 2, `unexpected character '='`},
+		{`a & b`, 2, `unexpected character '&'`},
+		{`a == b == c`, 7, `comparisons cannot be chained, use parentheses`},
+		{`a. == 1`, 0, `invalid field reference "a."`},
+		{`a == "\x"`, 6, `invalid escape sequence \x`},
+		{`a == 1.2.3`, 5, `invalid number "1.2.3"`},
+		{`&& a`, 0, `expected a field, literal, or "(" but found "&&"`},
+	}
+
+	for _, tc := range testCases {
+		_, err := Parse(tc.Expr)
+		var syntaxErr *SyntaxError
+		require.ErrorAs(t, err, &syntaxErr, tc.Expr)
+		assert.Equal(t, tc.Offset, syntaxErr.Offset, tc.Expr)
+		assert.Equal(t, tc.Msg, syntaxErr.Msg, tc.Expr)
+	}
+}
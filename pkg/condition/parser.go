@@ -0,0 +1,307 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package condition
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+)
+
+// SyntaxError is returned when an expression cannot be parsed.
+type SyntaxError struct {
+	Expr   string // Expression being parsed.
+	Offset int    // Byte offset of the error within Expr.
+	Msg    string // Description of the problem.
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("invalid condition %q: %s at offset %d", e.Expr, e.Msg, e.Offset)
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOp     // Binary operator.
+	tokenNot    // !
+	tokenLParen // (
+	tokenRParen // )
+)
+
+type token struct {
+	kind   tokenKind
+	text   string // Raw text for identifiers, numbers, and operators.
+	value  string // Unquoted value for strings.
+	offset int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return "string " + strconv.Quote(t.value)
+	default:
+		return strconv.Quote(t.text)
+	}
+}
+
+type lexer struct {
+	input string
+	pos   int
+}
+
+// next returns the next token. Invalid input is returned as an error.
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.input) && isSpace(l.input[l.pos]) {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos >= len(l.input) {
+		return token{kind: tokenEOF, offset: start}, nil
+	}
+
+	c := l.input[l.pos]
+	switch {
+	case c == '(':
+		l.pos++
+		return token{kind: tokenLParen, text: "(", offset: start}, nil
+	case c == ')':
+		l.pos++
+		return token{kind: tokenRParen, text: ")", offset: start}, nil
+	case c == '"' || c == '\'':
+		return l.lexString(c)
+	case isDigit(c) || (c == '-' && l.pos+1 < len(l.input) && isDigit(l.input[l.pos+1])):
+		l.pos++
+		for l.pos < len(l.input) && (isDigit(l.input[l.pos]) || strings.IndexByte(".eE+-", l.input[l.pos]) >= 0) {
+			// Only allow a sign directly after an exponent.
+			if (l.input[l.pos] == '+' || l.input[l.pos] == '-') && !strings.ContainsAny(l.input[l.pos-1:l.pos], "eE") {
+				break
+			}
+			l.pos++
+		}
+		return token{kind: tokenNumber, text: l.input[start:l.pos], offset: start}, nil
+	case isIdentStart(c):
+		for l.pos < len(l.input) && (isIdentStart(l.input[l.pos]) || isDigit(l.input[l.pos]) || l.input[l.pos] == '.') {
+			l.pos++
+		}
+		return token{kind: tokenIdent, text: l.input[start:l.pos], offset: start}, nil
+	}
+
+	for _, op := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">"} {
+		if strings.HasPrefix(l.input[l.pos:], op) {
+			l.pos += len(op)
+			return token{kind: tokenOp, text: op, offset: start}, nil
+		}
+	}
+	if c == '!' {
+		l.pos++
+		return token{kind: tokenNot, text: "!", offset: start}, nil
+	}
+
+	return token{}, &SyntaxError{Expr: l.input, Offset: start, Msg: fmt.Sprintf("unexpected character %q", c)}
+}
+
+func (l *lexer) lexString(quote byte) (token, error) {
+	start := l.pos
+	l.pos++ // Opening quote.
+
+	var sb strings.Builder
+	for l.pos < len(l.input) {
+		c := l.input[l.pos]
+		switch c {
+		case quote:
+			l.pos++
+			return token{kind: tokenString, text: l.input[start:l.pos], value: sb.String(), offset: start}, nil
+		case '\\':
+			if l.pos+1 >= len(l.input) {
+				break
+			}
+			l.pos++
+			switch esc := l.input[l.pos]; esc {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case '\\', '"', '\'':
+				sb.WriteByte(esc)
+			default:
+				return token{}, &SyntaxError{Expr: l.input, Offset: l.pos - 1, Msg: fmt.Sprintf("invalid escape sequence \\%c", esc)}
+			}
+		default:
+			sb.WriteByte(c)
+		}
+		l.pos++
+	}
+
+	return token{}, &SyntaxError{Expr: l.input, Offset: start, Msg: "unterminated string"}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '@' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// parser is a recursive descent parser for conditions.
+type parser struct {
+	lex lexer
+	tok token // Current token.
+	err error // First lexing error.
+}
+
+func (p *parser) next() {
+	if p.err != nil {
+		return
+	}
+	tok, err := p.lex.next()
+	if err != nil {
+		p.err = err
+		tok = token{kind: tokenEOF, offset: p.lex.pos}
+	}
+	p.tok = tok
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+	return &SyntaxError{Expr: p.lex.input, Offset: p.tok.offset, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) parseExpr() (Expr, error) {
+	return p.parseBinary(OpOr.precedence())
+}
+
+// parseBinary parses binary operations whose operators have at least the
+// given precedence.
+func (p *parser) parseBinary(minPrecedence int) (Expr, error) {
+	var left Expr
+	var err error
+	if minPrecedence < OpEq.precedence() {
+		left, err = p.parseBinary(minPrecedence + 1)
+	} else {
+		left, err = p.parseUnary()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for p.tok.kind == tokenOp && Op(p.tok.text).precedence() == minPrecedence {
+		op := Op(p.tok.text)
+		p.next()
+
+		var right Expr
+		if minPrecedence < OpEq.precedence() {
+			right, err = p.parseBinary(minPrecedence + 1)
+		} else {
+			right, err = p.parseUnary()
+		}
+		if err != nil {
+			return nil, err
+		}
+		left = &Binary{Op: op, Left: left, Right: right}
+
+		// Comparisons are not associative (e.g. a == b == c).
+		if minPrecedence == OpEq.precedence() && p.tok.kind == tokenOp && Op(p.tok.text).precedence() == minPrecedence {
+			return nil, p.errorf("comparisons cannot be chained, use parentheses")
+		}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	if p.tok.kind == tokenNot {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{X: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Expr, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokenLParen:
+		p.next()
+		x, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokenRParen {
+			return nil, p.errorf("expected \")\" but found %s", p.tok)
+		}
+		p.next()
+		return x, nil
+	case tokenString:
+		p.next()
+		return &Literal{Value: event.String(tok.value)}, nil
+	case tokenNumber:
+		v, err := parseNumber(tok.text)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", tok.text)
+		}
+		p.next()
+		return &Literal{Value: v}, nil
+	case tokenIdent:
+		p.next()
+		switch tok.text {
+		case "true":
+			return &Literal{Value: event.Bool(true)}, nil
+		case "false":
+			return &Literal{Value: event.Bool(false)}, nil
+		case "null":
+			return &Literal{Value: event.NullValue}, nil
+		}
+		if strings.HasPrefix(tok.text, ".") || strings.HasSuffix(tok.text, ".") || strings.Contains(tok.text, "..") {
+			return nil, &SyntaxError{Expr: p.lex.input, Offset: tok.offset, Msg: fmt.Sprintf("invalid field reference %q", tok.text)}
+		}
+		return &Field{Name: tok.text}, nil
+	default:
+		return nil, p.errorf("expected a field, literal, or \"(\" but found %s", tok)
+	}
+}
+
+func parseNumber(s string) (*event.Value, error) {
+	if !strings.ContainsAny(s, ".eE") {
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return event.Integer(i), nil
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, err
+	}
+	return event.Float(f), nil
+}
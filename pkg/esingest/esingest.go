@@ -0,0 +1,380 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package esingest converts pipelines between Elasticsearch ingest pipelines
+// and sawmill pipelines.
+package esingest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/andrewkroh/go-sawmill/pkg/pipeline"
+)
+
+// ErrMissingID is returned by Import when no pipeline ID is given and the
+// data does not contain one.
+var ErrMissingID = errors.New("pipeline id must be specified")
+
+// Problem describes part of an ingest pipeline that could not be converted.
+// The unconverted part is copied verbatim to the output so that it is
+// reported by pipeline validation until it is fixed by hand.
+type Problem struct {
+	Path    string // Location in the ingest pipeline (e.g. processors[1].grok).
+	Message string
+}
+
+func (p Problem) String() string {
+	return p.Path + ": " + p.Message
+}
+
+// conversion describes how an ingest processor is converted.
+type conversion struct {
+	// Ingest option names mapped to sawmill option names.
+	options map[string]string
+
+	// Ingest defaults of options that sawmill does not support. The option
+	// is omitted when it is set to its default.
+	defaults map[string]interface{}
+
+	// Converts the value of an ingest option. It is keyed by the ingest
+	// option name.
+	values map[string]func(c *converter, path string, v interface{}) interface{}
+}
+
+// conversions contains the ingest processors that can be converted. They have
+// the same name in sawmill.
+var conversions = map[string]conversion{
+	"append": {
+		options:  sameNames("field", "value", "allow_duplicates"),
+		defaults: map[string]interface{}{"media_type": "application/json"},
+		values: map[string]func(*converter, string, interface{}) interface{}{
+			"value": (*converter).appendValue,
+		},
+	},
+	"community_id": {
+		options: sameNames("source_ip", "source_port", "destination_ip", "destination_port",
+			"iana_number", "icmp_type", "icmp_code", "transport", "seed", "target_field", "ignore_failure"),
+		defaults: map[string]interface{}{"ignore_missing": true},
+	},
+	"drop": {},
+	"foreach": {
+		options: sameNames("field", "processor", "ignore_missing"),
+		values:  map[string]func(*converter, string, interface{}) interface{}{},
+	},
+	"lowercase": {
+		options: sameNames("field", "target_field", "ignore_missing"),
+	},
+	"pipeline": {
+		options: sameNames("name", "ignore_missing_pipeline"),
+	},
+	"remove": {
+		options: map[string]string{"field": "fields", "ignore_missing": "ignore_missing"},
+		values: map[string]func(*converter, string, interface{}) interface{}{
+			"field": (*converter).stringToArray,
+		},
+	},
+	"set": {
+		options: map[string]string{
+			"field":          "target_field",
+			"value":          "value",
+			"copy_from":      "copy_from",
+			"ignore_failure": "ignore_failure",
+		},
+		defaults: map[string]interface{}{
+			"override":           true,
+			"ignore_empty_value": false,
+			"media_type":         "application/json",
+		},
+	},
+	"uppercase": {
+		options: sameNames("field", "target_field", "ignore_missing"),
+	},
+}
+
+func init() {
+	// Set here to avoid an initialization cycle.
+	conversions["foreach"].values["processor"] = (*converter).foreachProcessor
+}
+
+func sameNames(names ...string) map[string]string {
+	m := make(map[string]string, len(names))
+	for _, name := range names {
+		m[name] = name
+	}
+	return m
+}
+
+// Import converts the JSON definition of an Elasticsearch ingest pipeline
+// (the body of a PUT _ingest/pipeline/<id> request) to a sawmill pipeline
+// with the given ID. The response of GET _ingest/pipeline/<id> is also
+// accepted when it contains a single pipeline, and its ID is used when id is
+// empty.
+//
+// Processors and options that cannot be converted are returned as problems.
+// An error is returned only when the data is not a valid ingest pipeline.
+func Import(id string, data []byte) (*pipeline.Config, []Problem, error) {
+	var raw map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, nil, fmt.Errorf("invalid ingest pipeline JSON: %w", err)
+	}
+	if raw == nil {
+		return nil, nil, errors.New("invalid ingest pipeline JSON: expected an object")
+	}
+	raw = normalize(raw).(map[string]interface{})
+
+	if name, def, ok := unwrap(raw); ok {
+		if id == "" {
+			id = name
+		}
+		raw = def
+	}
+	if id == "" {
+		return nil, nil, ErrMissingID
+	}
+
+	if _, found := raw["processors"]; !found {
+		return nil, nil, errors.New("invalid ingest pipeline: processors must be specified")
+	}
+
+	c := &converter{}
+	config := &pipeline.Config{ID: id}
+	config.Description, _ = raw["description"].(string)
+	config.Processors = c.processors("processors", raw["processors"])
+	if v, found := raw["on_failure"]; found {
+		config.OnFailure = c.processors("on_failure", v)
+	}
+	for _, key := range sortedKeys(raw) {
+		switch key {
+		case "description", "processors", "on_failure":
+		case "version", "_meta", "deprecated":
+			// Metadata that has no equivalent.
+		default:
+			c.addf(key, "unknown pipeline option %q", key)
+		}
+	}
+
+	return config, c.problems, nil
+}
+
+// unwrap returns the pipeline from a GET _ingest/pipeline response.
+func unwrap(raw map[string]interface{}) (string, map[string]interface{}, bool) {
+	if len(raw) != 1 {
+		return "", nil, false
+	}
+	for name, v := range raw {
+		def, ok := v.(map[string]interface{})
+		if _, hasProcessors := def["processors"]; !ok || !hasProcessors {
+			return "", nil, false
+		}
+		return name, def, true
+	}
+	return "", nil, false
+}
+
+type converter struct {
+	problems []Problem
+}
+
+func (c *converter) addf(path, format string, args ...interface{}) {
+	c.problems = append(c.problems, Problem{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *converter) processors(path string, v interface{}) []pipeline.ProcessorConfig {
+	list, ok := v.([]interface{})
+	if !ok {
+		c.addf(path, "must be a list of processors")
+		return nil
+	}
+
+	var out []pipeline.ProcessorConfig
+	for i, raw := range list {
+		if p := c.processor(path+"["+strconv.Itoa(i)+"]", raw); p != nil {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// processor converts a single processor. It returns nil if the processor
+// is malformed.
+func (c *converter) processor(path string, raw interface{}) pipeline.ProcessorConfig {
+	m, ok := raw.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		c.addf(path, "processor must contain exactly one processor type")
+		return nil
+	}
+
+	var name string
+	var opts map[string]interface{}
+	for name = range m {
+		if m[name] != nil {
+			if opts, ok = m[name].(map[string]interface{}); !ok {
+				c.addf(path+"."+name, "processor options must be an object")
+				return nil
+			}
+		}
+	}
+	path += "." + name
+
+	conv, supported := conversions[name]
+	if !supported {
+		c.addf(path, "processor type %q cannot be converted", name)
+	}
+
+	out := &pipeline.ProcessorOptionConfig{}
+	for _, key := range sortedKeys(opts) {
+		v := opts[key]
+		optPath := path + "." + key
+
+		switch key {
+		case "tag":
+			out.Tag, _ = v.(string)
+			continue
+		case "description":
+			out.Description, _ = v.(string)
+			continue
+		case "if":
+			out.If = pipeline.ConditionalExpressionConfig(c.condition(optPath, v))
+			continue
+		case "on_failure":
+			out.OnFailure = c.processors(optPath, v)
+			continue
+		}
+
+		if !supported {
+			setOption(out, key, v)
+			continue
+		}
+
+		target, found := conv.options[key]
+		if !found {
+			if def, hasDefault := conv.defaults[key]; hasDefault && reflect.DeepEqual(def, v) {
+				continue
+			}
+			if key == "ignore_failure" && v == false {
+				continue
+			}
+			c.addf(optPath, "option %q of processor type %s cannot be converted", key, name)
+			setOption(out, key, v)
+			continue
+		}
+
+		if convert := conv.values[key]; convert != nil {
+			v = convert(c, optPath, v)
+		}
+		if s, ok := v.(string); ok && strings.Contains(s, "{{") {
+			c.addf(optPath, "templates are not supported")
+		}
+		setOption(out, target, v)
+	}
+
+	return pipeline.ProcessorConfig{name: out}
+}
+
+func setOption(p *pipeline.ProcessorOptionConfig, key string, v interface{}) {
+	if p.Config == nil {
+		p.Config = map[string]interface{}{}
+	}
+	p.Config[key] = v
+}
+
+// condition translates a Painless condition. The original script is returned
+// if it cannot be translated.
+func (c *converter) condition(path string, v interface{}) string {
+	script, ok := v.(string)
+	if !ok {
+		c.addf(path, "condition must be a string")
+		return fmt.Sprint(v)
+	}
+
+	cond, err := translatePainless(script)
+	if err != nil {
+		c.addf(path, "cannot translate Painless condition: %v", err)
+		return script
+	}
+	return cond
+}
+
+// appendValue converts the value of an append processor. Sawmill appends a
+// single string.
+func (c *converter) appendValue(path string, v interface{}) interface{} {
+	if list, ok := v.([]interface{}); ok && len(list) == 1 {
+		v = list[0]
+	}
+	if _, ok := v.(string); !ok {
+		c.addf(path, "only a single string value can be converted")
+	}
+	return v
+}
+
+// foreachProcessor converts the processor of a foreach processor.
+func (c *converter) foreachProcessor(path string, v interface{}) interface{} {
+	if p := c.processor(path, v); p != nil {
+		return p
+	}
+	return v
+}
+
+func (c *converter) stringToArray(path string, v interface{}) interface{} {
+	if s, ok := v.(string); ok {
+		return []interface{}{s}
+	}
+	return v
+}
+
+// normalize converts JSON numbers to int64 or float64 so that they are
+// encoded as numbers.
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, x := range v {
+			v[k] = normalize(x)
+		}
+		return v
+	case []interface{}:
+		for i, x := range v {
+			v[i] = normalize(x)
+		}
+		return v
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	default:
+		return v
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
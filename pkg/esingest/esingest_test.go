@@ -0,0 +1,141 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package esingest
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/andrewkroh/go-sawmill/pkg/pipeline"
+
+	// Register processors:
+	_ "github.com/andrewkroh/go-sawmill/pkg/processor/append"
+	_ "github.com/andrewkroh/go-sawmill/pkg/processor/community_id"
+	_ "github.com/andrewkroh/go-sawmill/pkg/processor/drop"
+	_ "github.com/andrewkroh/go-sawmill/pkg/processor/lowercase"
+	_ "github.com/andrewkroh/go-sawmill/pkg/processor/remove"
+	_ "github.com/andrewkroh/go-sawmill/pkg/processor/set"
+	_ "github.com/andrewkroh/go-sawmill/pkg/processor/uppercase"
+)
+
+func TestImport(t *testing.T) {
+	data, err := os.ReadFile("testdata/nginx.json")
+	require.NoError(t, err)
+
+	config, problems, err := Import("nginx", data)
+	require.NoError(t, err)
+
+	expected, err := os.ReadFile("testdata/nginx.yml")
+	require.NoError(t, err)
+	out, err := yaml.Marshal(config)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(out))
+
+	assert.Equal(t, []Problem{
+		{Path: "processors[1].grok", Message: `processor type "grok" cannot be converted`},
+		{Path: "processors[3].append.if", Message: `cannot translate Painless condition: unsupported method call "contains" at offset 56`},
+		{Path: "processors[3].append.value", Message: "templates are not supported"},
+		{Path: "processors[4].remove.ignore_failure", Message: `option "ignore_failure" of processor type remove cannot be converted`},
+		{Path: "processors[6].set.override", Message: `option "override" of processor type set cannot be converted`},
+		{Path: "on_failure[0].set.value", Message: "templates are not supported"},
+	}, problems)
+}
+
+func TestImportValid(t *testing.T) {
+	data := []byte(`{
+  "processors": [
+    {"append": {"field": "tags", "value": ["imported"], "media_type": "application/json"}},
+    {"community_id": {"target_field": "network.id", "seed": 1, "ignore_missing": true}},
+    {"lowercase": {"field": "message", "target_field": "lower", "ignore_failure": false}},
+    {"uppercase": {"field": "message", "target_field": "upper", "tag": "up"}},
+    {"remove": {"field": ["a", "b"], "ignore_missing": true}},
+    {"set": {"field": "c", "copy_from": "message", "override": true}},
+    {"foreach": {"field": "tags", "processor": {"uppercase": {"field": "_ingest._value"}}}},
+    {"pipeline": {"name": "other", "ignore_missing_pipeline": true}},
+    {"drop": {"if": "ctx.event?.kind == 'debug'"}}
+  ],
+  "on_failure": [{"set": {"field": "error.message", "value": "failed"}}]
+}`)
+
+	config, problems, err := Import("valid", data)
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+	assert.Empty(t, pipeline.Validate(config))
+}
+
+func TestImportGetResponse(t *testing.T) {
+	data := []byte(`{"my-pipeline": {"processors": [{"drop": {}}]}}`)
+
+	config, problems, err := Import("", data)
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+	assert.Equal(t, "my-pipeline", config.ID)
+	assert.Len(t, config.Processors, 1)
+
+	config, _, err = Import("other", data)
+	require.NoError(t, err)
+	assert.Equal(t, "other", config.ID)
+}
+
+func TestImportErrors(t *testing.T) {
+	testCases := map[string]struct {
+		id   string
+		data string
+		err  string
+	}{
+		"invalid JSON":  {"x", `{`, "invalid ingest pipeline JSON: unexpected EOF"},
+		"not an object": {"x", `null`, "invalid ingest pipeline JSON: expected an object"},
+		"no processors": {"x", `{"description": "x"}`, "invalid ingest pipeline: processors must be specified"},
+		"no id":         {"", `{"processors": []}`, "pipeline id must be specified"},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			_, _, err := Import(tc.id, []byte(tc.data))
+			require.Error(t, err)
+			assert.Equal(t, tc.err, err.Error())
+		})
+	}
+}
+
+func TestImportMalformedProcessors(t *testing.T) {
+	data := []byte(`{
+  "processors": [
+    {"set": {"field": "a", "value": 1}, "drop": {}},
+    {"set": "a"},
+    {"drop": null}
+  ],
+  "on_failure": {"drop": {}},
+  "unknown": true
+}`)
+
+	config, problems, err := Import("x", data)
+	require.NoError(t, err)
+	assert.Len(t, config.Processors, 1)
+	assert.Equal(t, []Problem{
+		{Path: "processors[0]", Message: "processor must contain exactly one processor type"},
+		{Path: "processors[1].set", Message: "processor options must be an object"},
+		{Path: "on_failure", Message: "must be a list of processors"},
+		{Path: "unknown", Message: `unknown pipeline option "unknown"`},
+	}, problems)
+}
@@ -0,0 +1,437 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package esingest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/andrewkroh/go-sawmill/pkg/condition"
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+	"github.com/andrewkroh/go-sawmill/pkg/pipeline"
+)
+
+// ingestPipeline is the body of a PUT _ingest/pipeline/<id> request.
+type ingestPipeline struct {
+	Description string                   `json:"description,omitempty"`
+	Processors  []map[string]interface{} `json:"processors"`
+	OnFailure   []map[string]interface{} `json:"on_failure,omitempty"`
+}
+
+// Export converts a sawmill pipeline to the JSON definition of an
+// Elasticsearch ingest pipeline (the body of a PUT _ingest/pipeline/<id>
+// request). The pipeline ID is not part of the definition.
+//
+// Conditions are translated to Painless. Processors and options that have no
+// ingest equivalent are returned as problems. Sawmill-only processors and
+// options are copied as-is so that Elasticsearch rejects the pipeline until
+// they are fixed by hand, except for timeouts which are omitted. An error
+// is returned only when the pipeline cannot be encoded.
+func Export(config *pipeline.Config) ([]byte, []Problem, error) {
+	e := &exporter{}
+	if config.Timeout != "" {
+		e.addf("timeout", "pipeline timeouts are not supported")
+	}
+
+	out := ingestPipeline{
+		Description: config.Description,
+		Processors:  e.processors("processors", config.Processors),
+		OnFailure:   e.processors("on_failure", config.OnFailure),
+	}
+	if out.Processors == nil {
+		out.Processors = []map[string]interface{}{}
+	}
+
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), e.problems, nil
+}
+
+// exportOptions returns the sawmill option names of the processor mapped to
+// the ingest option names.
+func exportOptions(procType string) (map[string]string, bool) {
+	conv, found := conversions[procType]
+	if !found {
+		return nil, false
+	}
+	options := make(map[string]string, len(conv.options))
+	for ingestName, name := range conv.options {
+		options[name] = ingestName
+	}
+	return options, true
+}
+
+type exporter struct {
+	problems []Problem
+}
+
+func (e *exporter) addf(path, format string, args ...interface{}) {
+	e.problems = append(e.problems, Problem{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (e *exporter) processors(path string, list []pipeline.ProcessorConfig) []map[string]interface{} {
+	var out []map[string]interface{}
+	for i, p := range list {
+		if m := e.processor(path+"["+strconv.Itoa(i)+"]", p); m != nil {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// processor converts a single processor. It returns nil if the processor is
+// malformed.
+func (e *exporter) processor(path string, p pipeline.ProcessorConfig) map[string]interface{} {
+	if len(p) != 1 {
+		e.addf(path, "processor must contain exactly one processor type")
+		return nil
+	}
+
+	var name string
+	var opts *pipeline.ProcessorOptionConfig
+	for name, opts = range p {
+	}
+	if opts == nil {
+		opts = &pipeline.ProcessorOptionConfig{}
+	}
+	path += "." + name
+
+	options, supported := exportOptions(name)
+	if !supported {
+		e.addf(path, "processor type %q is not supported by Elasticsearch", name)
+	}
+
+	out := map[string]interface{}{}
+	switch {
+	case opts.Tag != "":
+		out["tag"] = opts.Tag
+		if opts.ID != "" {
+			e.addf(path+".id", "processor IDs are not supported, the tag is used instead")
+		}
+	case opts.ID != "":
+		out["tag"] = opts.ID
+		e.addf(path+".id", "processor IDs are not supported, the ID is used as the tag")
+	}
+	if opts.Description != "" {
+		out["description"] = opts.Description
+		e.references(path+".description", opts.Description)
+	}
+	if opts.If != "" {
+		out["if"] = e.condition(path+".if", string(opts.If))
+		e.references(path+".if", string(opts.If))
+	}
+	if opts.Timeout != "" {
+		e.addf(path+".timeout", "processor timeouts are not supported")
+	}
+	if len(opts.OnFailure) > 0 {
+		out["on_failure"] = e.processors(path+".on_failure", opts.OnFailure)
+	}
+
+	keys := make([]string, 0, len(opts.Config))
+	for k := range opts.Config {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		v := opts.Config[key]
+		if !supported {
+			out[key] = v
+			continue
+		}
+
+		ingestName, found := options[key]
+		if !found {
+			e.addf(path+"."+key, "option %q of processor type %s is not supported by Elasticsearch", key, name)
+			out[key] = v
+			continue
+		}
+
+		switch {
+		case name == "foreach" && key == "processor":
+			v = e.foreachProcessor(path+"."+key, v)
+		case name == "remove" && key == "fields":
+			e.references(path+"."+key, v)
+			// A single field is written as a string like it is usually
+			// written in ingest pipelines.
+			if list, ok := v.([]interface{}); ok && len(list) == 1 {
+				v = list[0]
+			}
+		default:
+			e.references(path+"."+key, v)
+		}
+		out[ingestName] = v
+	}
+
+	return map[string]interface{}{name: out}
+}
+
+// references reports the ${...} references contained in the strings of v.
+// Pipelines are exported with unsubstituted references so that secrets are
+// not written to the output.
+func (e *exporter) references(path string, v interface{}) {
+	switch v := v.(type) {
+	case string:
+		if containsReference(v) {
+			e.addf(path, "references are not supported by Elasticsearch, %q must be substituted by hand", v)
+		}
+	case []interface{}:
+		for i, item := range v {
+			e.references(path+"["+strconv.Itoa(i)+"]", item)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			e.references(path+"."+k, v[k])
+		}
+	}
+}
+
+// containsReference returns true if s contains a ${...} reference that is
+// not escaped as $${.
+func containsReference(s string) bool {
+	for i := strings.Index(s, "${"); i >= 0; {
+		if i == 0 || s[i-1] != '$' {
+			return true
+		}
+		j := strings.Index(s[i+2:], "${")
+		if j < 0 {
+			break
+		}
+		i += 2 + j
+	}
+	return false
+}
+
+// foreachProcessor converts the processor of a foreach processor.
+func (e *exporter) foreachProcessor(path string, v interface{}) interface{} {
+	p, ok := v.(pipeline.ProcessorConfig)
+	if !ok {
+		var err error
+		if p, err = rawProcessorConfig(v); err != nil {
+			e.addf(path, "invalid processor: %v", err)
+			return v
+		}
+	}
+	if m := e.processor(path, p); m != nil {
+		return m
+	}
+	return v
+}
+
+// condition translates a sawmill condition. The original expression is
+// returned if it is invalid.
+func (e *exporter) condition(path, expr string) string {
+	c, err := condition.Parse(expr)
+	if err != nil {
+		e.addf(path, "%v", err)
+		return expr
+	}
+	painless, err := toPainless(c.Expr())
+	if err != nil {
+		e.addf(path, "%v", err)
+		return expr
+	}
+	return painless
+}
+
+// rawProcessorConfig converts an untyped processor definition into a
+// ProcessorConfig.
+func rawProcessorConfig(raw interface{}) (pipeline.ProcessorConfig, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var procConfig pipeline.ProcessorConfig
+	if err = json.Unmarshal(data, &procConfig); err != nil {
+		return nil, err
+	}
+	return procConfig, nil
+}
+
+// toPainless translates a condition to Painless. Fields are accessed with
+// null-safe operators because a missing field is null in sawmill. Painless
+// throws when a null or mistyped value is used as a boolean or is ordered, so
+// those fields are guarded with instanceof checks (e.g.
+// ctx.a instanceof Number && ctx.a > 1). Only numbers can be ordered.
+func toPainless(expr condition.Expr) (string, error) {
+	s, _, err := painlessExpr(expr, true)
+	return s, err
+}
+
+// painlessAtom is the precedence of expressions that never need parentheses.
+const painlessAtom = 4
+
+// painlessExpr renders expr and returns the precedence of its outermost
+// operator. If cond is true then expr is evaluated as a boolean.
+func painlessExpr(expr condition.Expr, cond bool) (string, int, error) {
+	switch x := expr.(type) {
+	case *condition.Binary:
+		logical := x.Op == condition.OpOr || x.Op == condition.OpAnd
+		if !logical && x.Op != condition.OpEq && x.Op != condition.OpNe {
+			return painlessOrdering(x)
+		}
+		left, err := painlessOperand(x.Left, x.Op, false, logical)
+		if err != nil {
+			return "", 0, err
+		}
+		right, err := painlessOperand(x.Right, x.Op, true, logical)
+		if err != nil {
+			return "", 0, err
+		}
+		return left + " " + string(x.Op) + " " + right, binaryPrecedence(x.Op), nil
+	case *condition.Not:
+		s, p, err := painlessExpr(x.X, true)
+		if err != nil {
+			return "", 0, err
+		}
+		if p < painlessAtom {
+			s = "(" + s + ")"
+		}
+		return "!" + s, painlessAtom, nil
+	case *condition.Field:
+		f := painlessField(x.Name)
+		if cond {
+			return f + " instanceof Boolean && " + f, binaryPrecedence(condition.OpAnd), nil
+		}
+		return f, painlessAtom, nil
+	case *condition.Literal:
+		if cond && x.Value.Type != event.BoolType {
+			return "", 0, fmt.Errorf("cannot translate condition %s: %s is not a boolean", expr, x)
+		}
+		return painlessLiteral(x.Value), painlessAtom, nil
+	default:
+		return "", 0, fmt.Errorf("cannot translate condition %s", expr)
+	}
+}
+
+// painlessOperand renders a child of a binary expression. Sawmill
+// comparisons have the same precedence so comparisons that are operands of
+// comparisons are always parenthesized.
+func painlessOperand(x condition.Expr, parent condition.Op, right, cond bool) (string, error) {
+	s, p, err := painlessExpr(x, cond)
+	if err != nil {
+		return "", err
+	}
+	parentPrecedence := binaryPrecedence(parent)
+	if p < parentPrecedence || (p == parentPrecedence && (right || p == binaryPrecedence(condition.OpEq))) {
+		s = "(" + s + ")"
+	}
+	return s, nil
+}
+
+// painlessOrdering renders an ordering comparison of fields and numbers.
+// Each field is guarded by a Number type check.
+func painlessOrdering(b *condition.Binary) (string, int, error) {
+	var guards []string
+	operand := func(x condition.Expr) (string, error) {
+		switch v := x.(type) {
+		case *condition.Field:
+			f := painlessField(v.Name)
+			guards = append(guards, f+" instanceof Number && ")
+			return f, nil
+		case *condition.Literal:
+			switch v.Value.Type {
+			case event.IntegerType, event.UnsignedIntegerType, event.FloatType:
+				return painlessLiteral(v.Value), nil
+			}
+		}
+		return "", fmt.Errorf("cannot translate condition %s: only fields and numbers can be ordered", b)
+	}
+
+	left, err := operand(b.Left)
+	if err != nil {
+		return "", 0, err
+	}
+	right, err := operand(b.Right)
+	if err != nil {
+		return "", 0, err
+	}
+
+	s := left + " " + string(b.Op) + " " + right
+	if len(guards) == 0 {
+		return s, binaryPrecedence(b.Op), nil
+	}
+	return strings.Join(guards, "") + s, binaryPrecedence(condition.OpAnd), nil
+}
+
+func painlessField(name string) string {
+	var sb strings.Builder
+	sb.WriteString("ctx")
+	for i, key := range strings.Split(name, ".") {
+		switch {
+		case isPainlessIdent(key) && i == 0:
+			sb.WriteString("." + key)
+		case isPainlessIdent(key):
+			sb.WriteString("?." + key)
+		case i == 0:
+			sb.WriteString("[" + quotePainless(key) + "]")
+		default:
+			sb.WriteString("?.get(" + quotePainless(key) + ")")
+		}
+	}
+	return sb.String()
+}
+
+func isPainlessIdent(s string) bool {
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '_' && !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func painlessLiteral(v *event.Value) string {
+	switch v.Type {
+	case event.StringType:
+		return quotePainless(v.String)
+	case event.IntegerType:
+		if v.Integer < math.MinInt32 || v.Integer > math.MaxInt32 {
+			// Integer literals are an int unless they have the long suffix.
+			return strconv.FormatInt(v.Integer, 10) + "L"
+		}
+	case event.UnsignedIntegerType:
+		if v.UnsignedInteger > math.MaxInt32 {
+			return strconv.FormatUint(v.UnsignedInteger, 10) + "L"
+		}
+	}
+	return (&condition.Literal{Value: v}).String()
+}
+
+func quotePainless(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
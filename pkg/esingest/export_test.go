@@ -0,0 +1,157 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package esingest
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrewkroh/go-sawmill/pkg/pipeline"
+)
+
+func TestExport(t *testing.T) {
+	config := &pipeline.Config{
+		ID:          "test",
+		Description: "Export test.",
+		Timeout:     "1s",
+		Processors: []pipeline.ProcessorConfig{
+			{"set": {
+				ID:      "set-kind",
+				If:      `event.kind == null`,
+				Timeout: "10ms",
+				Config:  map[string]interface{}{"target_field": "event.kind", "value": "event"},
+			}},
+			{"lowercase": {
+				ID:     "lower",
+				Tag:    "lowercase-message",
+				Config: map[string]interface{}{"field": "message", "bogus": true},
+			}},
+			{"fail": {
+				If:     `message == "x"`,
+				Config: map[string]interface{}{"message": "failed"},
+			}},
+			{"drop": nil},
+		},
+	}
+
+	data, problems, err := Export(config)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{
+  "description": "Export test.",
+  "processors": [
+    {"set": {"tag": "set-kind", "if": "ctx.event?.kind == null", "field": "event.kind", "value": "event"}},
+    {"lowercase": {"tag": "lowercase-message", "field": "message", "bogus": true}},
+    {"fail": {"if": "ctx.message == 'x'", "message": "failed"}},
+    {"drop": {}}
+  ]
+}`, string(data))
+
+	assert.Equal(t, []Problem{
+		{Path: "timeout", Message: "pipeline timeouts are not supported"},
+		{Path: "processors[0].set.id", Message: "processor IDs are not supported, the ID is used as the tag"},
+		{Path: "processors[0].set.timeout", Message: "processor timeouts are not supported"},
+		{Path: "processors[1].lowercase.id", Message: "processor IDs are not supported, the tag is used instead"},
+		{Path: "processors[1].lowercase.bogus", Message: `option "bogus" of processor type lowercase is not supported by Elasticsearch`},
+		{Path: "processors[2].fail", Message: `processor type "fail" is not supported by Elasticsearch`},
+	}, problems)
+}
+
+// TestRoundTrip verifies that importing and then exporting an ingest pipeline
+// that only uses supported processors reproduces the original.
+func TestRoundTrip(t *testing.T) {
+	data, err := os.ReadFile("testdata/roundtrip.json")
+	require.NoError(t, err)
+
+	config, problems, err := Import("roundtrip", data)
+	require.NoError(t, err)
+	require.Empty(t, problems)
+
+	exported, problems, err := Export(config)
+	require.NoError(t, err)
+	require.Empty(t, problems)
+	assert.Equal(t, string(data), string(exported))
+
+	// Importing the export must produce the same pipeline.
+	reimported, problems, err := Import("roundtrip", exported)
+	require.NoError(t, err)
+	require.Empty(t, problems)
+	assert.Equal(t, config, reimported)
+}
+
+// lossyPipelines are the test pipelines whose export is reported as lossy.
+var lossyPipelines = map[string][]Problem{
+	"include.pipeline.yml": {
+		{Path: "processors[1].lowercase.id", Message: "processor IDs are not supported, the ID is used as the tag"},
+		{Path: "processors[2].uppercase.id", Message: "processor IDs are not supported, the ID is used as the tag"},
+	},
+}
+
+// TestRoundTripPipelines verifies that exporting and then importing the
+// pipelines used by the pipeline tests reproduces them.
+func TestRoundTripPipelines(t *testing.T) {
+	files, err := filepath.Glob("../pipeline/testdata/*.pipeline.yml")
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	for _, f := range files {
+		f := f
+		t.Run(filepath.Base(f), func(t *testing.T) {
+			if filepath.Base(f) == "global-on-failure.pipeline.yml" {
+				t.Skip("uses the fail processor that is only registered by tests")
+			}
+
+			config, err := pipeline.LoadConfigFile(f, pipeline.LoadOptions{})
+			require.NoError(t, err)
+
+			exported, problems, err := Export(config)
+			require.NoError(t, err)
+
+			reimported, importProblems, err := Import(config.ID, exported)
+			require.NoError(t, err)
+			require.Empty(t, importProblems)
+
+			// Processor IDs, like those of included processors, cannot be
+			// represented in Elasticsearch so they are reported. Only the
+			// re-export of such pipelines can be compared.
+			if want, found := lossyPipelines[filepath.Base(f)]; found {
+				assert.Equal(t, want, problems)
+
+				reexported, problems, err := Export(reimported)
+				require.NoError(t, err)
+				require.Empty(t, problems)
+				assert.Equal(t, string(exported), string(reexported))
+				return
+			}
+			require.Empty(t, problems)
+
+			// Compare the JSON to ignore differences in numeric types and
+			// between untyped and typed foreach processors.
+			expected, err := json.Marshal(config)
+			require.NoError(t, err)
+			actual, err := json.Marshal(reimported)
+			require.NoError(t, err)
+			assert.JSONEq(t, string(expected), string(actual))
+		})
+	}
+}
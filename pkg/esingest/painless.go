@@ -0,0 +1,464 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package esingest
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/andrewkroh/go-sawmill/pkg/condition"
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+)
+
+// translatePainless translates a Painless condition to a sawmill condition.
+// Only comparisons of ctx fields (e.g. ctx.event?.kind, ctx['event'], or
+// ctx.event?.get('kind')) and literals that are combined with logical
+// operators can be translated.
+// Unlike Painless, accessing a field of a missing object is not an error
+// (the result is null). The instanceof checks that Export adds to guard
+// booleans and ordering comparisons are dropped because sawmill conditions
+// are false for values of the wrong type.
+func translatePainless(script string) (string, error) {
+	p := &painlessParser{lex: painlessLexer{input: strings.TrimSpace(script)}}
+	p.next()
+
+	expr, err := p.parseBinary(condition.OpOr)
+	if err != nil {
+		return "", err
+	}
+	if p.tok.kind == painlessSemicolon {
+		p.next()
+	}
+	if p.tok.kind != painlessEOF {
+		return "", p.errorf("unexpected %s", p.tok)
+	}
+	if p.err != nil {
+		return "", p.err
+	}
+
+	// Round-trip through the parser to ensure the result is valid.
+	c, err := condition.Parse(expr.String())
+	if err != nil {
+		return "", err
+	}
+	return c.String(), nil
+}
+
+type painlessTokenKind int
+
+const (
+	painlessEOF painlessTokenKind = iota
+	painlessIdent
+	painlessString
+	painlessNumber
+	painlessOp        // Binary operator.
+	painlessNot       // !
+	painlessDot       // . or ?.
+	painlessLParen    // (
+	painlessRParen    // )
+	painlessLBracket  // [
+	painlessRBracket  // ]
+	painlessSemicolon // ;
+)
+
+type painlessToken struct {
+	kind   painlessTokenKind
+	text   string
+	value  string // Unquoted value for strings.
+	offset int
+}
+
+func (t painlessToken) String() string {
+	if t.kind == painlessEOF {
+		return "end of script"
+	}
+	return strconv.Quote(t.text) + " at offset " + strconv.Itoa(t.offset)
+}
+
+type painlessLexer struct {
+	input string
+	pos   int
+}
+
+func (l *painlessLexer) next() (painlessToken, error) {
+	for l.pos < len(l.input) && strings.IndexByte(" \t\r\n", l.input[l.pos]) >= 0 {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos >= len(l.input) {
+		return painlessToken{kind: painlessEOF, offset: start}, nil
+	}
+
+	tok := func(kind painlessTokenKind, n int) (painlessToken, error) {
+		l.pos += n
+		return painlessToken{kind: kind, text: l.input[start:l.pos], offset: start}, nil
+	}
+
+	c := l.input[l.pos]
+	rest := l.input[l.pos:]
+	switch {
+	case c == '\'' || c == '"':
+		return l.lexString(c)
+	case c >= '0' && c <= '9':
+		n := 0
+		for n < len(rest) && (rest[n] >= '0' && rest[n] <= '9' || rest[n] == '.') {
+			n++
+		}
+		if n < len(rest) && (rest[n] == 'L' || rest[n] == 'l') {
+			n++ // Long suffix.
+		}
+		return tok(painlessNumber, n)
+	case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		n := 0
+		for n < len(rest) && (rest[n] == '_' || (rest[n] >= 'a' && rest[n] <= 'z') ||
+			(rest[n] >= 'A' && rest[n] <= 'Z') || (rest[n] >= '0' && rest[n] <= '9')) {
+			n++
+		}
+		return tok(painlessIdent, n)
+	case strings.HasPrefix(rest, "==="), strings.HasPrefix(rest, "!=="):
+		return painlessToken{}, fmt.Errorf("unsupported operator %q at offset %d", rest[:3], start)
+	case strings.HasPrefix(rest, "?."):
+		return tok(painlessDot, 2)
+	case c == '.':
+		return tok(painlessDot, 1)
+	case c == '(':
+		return tok(painlessLParen, 1)
+	case c == ')':
+		return tok(painlessRParen, 1)
+	case c == '[':
+		return tok(painlessLBracket, 1)
+	case c == ']':
+		return tok(painlessRBracket, 1)
+	case c == ';':
+		return tok(painlessSemicolon, 1)
+	}
+
+	for _, op := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">"} {
+		if strings.HasPrefix(rest, op) {
+			return tok(painlessOp, len(op))
+		}
+	}
+	if c == '!' {
+		return tok(painlessNot, 1)
+	}
+
+	return painlessToken{}, fmt.Errorf("unsupported character %q at offset %d", c, start)
+}
+
+func (l *painlessLexer) lexString(quote byte) (painlessToken, error) {
+	start := l.pos
+	l.pos++ // Opening quote.
+
+	var sb strings.Builder
+	for l.pos < len(l.input) {
+		c := l.input[l.pos]
+		l.pos++
+		switch c {
+		case quote:
+			return painlessToken{kind: painlessString, text: l.input[start:l.pos], value: sb.String(), offset: start}, nil
+		case '\\':
+			if l.pos < len(l.input) {
+				c = l.input[l.pos]
+				l.pos++
+			}
+		}
+		sb.WriteByte(c)
+	}
+
+	return painlessToken{}, fmt.Errorf("unterminated string at offset %d", start)
+}
+
+type painlessParser struct {
+	lex painlessLexer
+	tok painlessToken // Current token.
+	err error         // First lexing error.
+}
+
+func (p *painlessParser) next() {
+	if p.err != nil {
+		return
+	}
+	tok, err := p.lex.next()
+	if err != nil {
+		p.err = err
+		tok = painlessToken{kind: painlessEOF, offset: p.lex.pos}
+	}
+	p.tok = tok
+}
+
+func (p *painlessParser) errorf(format string, args ...interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+	return fmt.Errorf(format, args...)
+}
+
+// precedence returns the precedence of the operator in the current token, or
+// zero if it is not a binary operator.
+func (p *painlessParser) precedence() int {
+	if p.tok.kind != painlessOp {
+		return 0
+	}
+	return binaryPrecedence(condition.Op(p.tok.text))
+}
+
+func binaryPrecedence(op condition.Op) int {
+	switch op {
+	case condition.OpOr:
+		return 1
+	case condition.OpAnd:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// parseBinary parses binary operations whose operators have at least the
+// precedence of op.
+func (p *painlessParser) parseBinary(op condition.Op) (condition.Expr, error) {
+	minPrecedence := binaryPrecedence(op)
+
+	operand := func() (condition.Expr, error) {
+		switch minPrecedence {
+		case 1:
+			return p.parseBinary(condition.OpAnd)
+		case 2:
+			return p.parseGuarded()
+		default:
+			return p.parseUnary()
+		}
+	}
+
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for p.precedence() == minPrecedence {
+		op := condition.Op(p.tok.text)
+		p.next()
+
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &condition.Binary{Op: op, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// parseGuarded parses a comparison that is preceded by zero or more type
+// checks (e.g. ctx.a instanceof Number && ctx.a > 1). Each check must guard
+// a field of the comparison.
+func (p *painlessParser) parseGuarded() (condition.Expr, error) {
+	var guards []painlessGuard
+	for {
+		g, ok, err := p.parseGuard()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		guards = append(guards, g)
+	}
+
+	x, err := p.parseBinary(condition.OpEq)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range guards {
+		if !g.guards(x) {
+			return nil, fmt.Errorf("unsupported instanceof check of %s at offset %d", g.field, g.offset)
+		}
+	}
+	return x, nil
+}
+
+// painlessGuard is a type check of a field that is followed by &&.
+type painlessGuard struct {
+	field  string
+	typ    string // Boolean or Number.
+	offset int    // Offset of instanceof.
+}
+
+// parseGuard parses a type check. If the current tokens are not a type check
+// then the parser is left unchanged and false is returned.
+func (p *painlessParser) parseGuard() (painlessGuard, bool, error) {
+	if p.tok.kind != painlessIdent || p.tok.text != "ctx" {
+		return painlessGuard{}, false, nil
+	}
+
+	saved := *p
+	p.next()
+	x, err := p.parseField()
+	if err != nil || p.tok.kind != painlessIdent || p.tok.text != "instanceof" {
+		*p = saved
+		return painlessGuard{}, false, nil
+	}
+
+	g := painlessGuard{field: x.(*condition.Field).Name, offset: p.tok.offset}
+	p.next()
+	if p.tok.kind != painlessIdent || (p.tok.text != "Boolean" && p.tok.text != "Number") {
+		return g, false, p.errorf("unsupported instanceof type %s", p.tok)
+	}
+	g.typ = p.tok.text
+	p.next()
+	if p.tok.kind != painlessOp || p.tok.text != string(condition.OpAnd) {
+		return g, false, p.errorf("expected \"&&\" after instanceof but found %s", p.tok)
+	}
+	p.next()
+	return g, true, nil
+}
+
+// guards returns true if the type check can be dropped from x. A Boolean
+// check must guard the field itself and a Number check must guard an
+// operand of an ordering comparison.
+func (g painlessGuard) guards(x condition.Expr) bool {
+	isField := func(x condition.Expr) bool {
+		f, ok := x.(*condition.Field)
+		return ok && f.Name == g.field
+	}
+
+	if g.typ == "Boolean" {
+		return isField(x)
+	}
+	b, ok := x.(*condition.Binary)
+	if !ok {
+		return false
+	}
+	switch b.Op {
+	case condition.OpLt, condition.OpLte, condition.OpGt, condition.OpGte:
+		return isField(b.Left) || isField(b.Right)
+	default:
+		return false
+	}
+}
+
+func (p *painlessParser) parseUnary() (condition.Expr, error) {
+	if p.tok.kind == painlessNot {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &condition.Not{X: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *painlessParser) parsePrimary() (condition.Expr, error) {
+	tok := p.tok
+	switch tok.kind {
+	case painlessLParen:
+		p.next()
+		x, err := p.parseBinary(condition.OpOr)
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != painlessRParen {
+			return nil, p.errorf("expected \")\" but found %s", p.tok)
+		}
+		p.next()
+		return x, nil
+	case painlessString:
+		p.next()
+		return &condition.Literal{Value: event.String(tok.value)}, nil
+	case painlessNumber:
+		p.next()
+		if i, err := strconv.ParseInt(strings.TrimRight(tok.text, "Ll"), 10, 64); err == nil {
+			return &condition.Literal{Value: event.Integer(i)}, nil
+		}
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at offset %d", tok.text, tok.offset)
+		}
+		return &condition.Literal{Value: event.Float(f)}, nil
+	case painlessIdent:
+		p.next()
+		switch tok.text {
+		case "true":
+			return &condition.Literal{Value: event.Bool(true)}, nil
+		case "false":
+			return &condition.Literal{Value: event.Bool(false)}, nil
+		case "null":
+			return &condition.Literal{Value: event.NullValue}, nil
+		case "ctx":
+			return p.parseField()
+		}
+		return nil, p.errorf("unsupported identifier %s", tok)
+	default:
+		return nil, p.errorf("unexpected %s", tok)
+	}
+}
+
+// parseField parses the accessors that follow ctx.
+func (p *painlessParser) parseField() (condition.Expr, error) {
+	var keys []string
+	for {
+		switch p.tok.kind {
+		case painlessDot:
+			p.next()
+			if p.tok.kind != painlessIdent {
+				return nil, p.errorf("expected a field name but found %s", p.tok)
+			}
+			keys = append(keys, p.tok.text)
+			p.next()
+		case painlessLBracket:
+			p.next()
+			if p.tok.kind != painlessString {
+				return nil, p.errorf("expected a string but found %s", p.tok)
+			}
+			if strings.Contains(p.tok.value, ".") {
+				return nil, p.errorf("unsupported key containing a dot %s", p.tok)
+			}
+			keys = append(keys, p.tok.value)
+			p.next()
+			if p.tok.kind != painlessRBracket {
+				return nil, p.errorf("expected \"]\" but found %s", p.tok)
+			}
+			p.next()
+		default:
+			if len(keys) == 0 {
+				return nil, errors.New("unsupported use of ctx without a field")
+			}
+			if p.tok.kind == painlessLParen {
+				// Map.get('key') is an accessor.
+				if keys[len(keys)-1] != "get" {
+					return nil, p.errorf("unsupported method call %q at offset %d", keys[len(keys)-1], p.tok.offset)
+				}
+				p.next()
+				if p.tok.kind != painlessString {
+					return nil, p.errorf("expected a string but found %s", p.tok)
+				}
+				if strings.Contains(p.tok.value, ".") {
+					return nil, p.errorf("unsupported key containing a dot %s", p.tok)
+				}
+				keys[len(keys)-1] = p.tok.value
+				p.next()
+				if p.tok.kind != painlessRParen {
+					return nil, p.errorf("expected \")\" but found %s", p.tok)
+				}
+				p.next()
+				continue
+			}
+			return &condition.Field{Name: strings.Join(keys, ".")}, nil
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package esingest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrewkroh/go-sawmill/pkg/condition"
+)
+
+func TestTranslatePainless(t *testing.T) {
+	testCases := []struct {
+		script string
+		want   string
+	}{
+		{`ctx.event.kind == 'alert'`, `event.kind == "alert"`},
+		{`ctx?.event?.kind != "alert"`, `event.kind != "alert"`},
+		{`ctx['@timestamp'] == null`, `@timestamp == null`},
+		{`ctx.event?.severity >= 3 && ctx.tags == null;`, `event.severity >= 3 && tags == null`},
+		{`!(ctx.a == 1 || ctx.b < 2.5) && ctx.c`, `!(a == 1 || b < 2.5) && c`},
+		{`ctx.msg == 'it\'s'`, `msg == "it's"`},
+		{`ctx.flag == true || ctx.flag == false`, `flag == true || flag == false`},
+		{`ctx.a instanceof Number && ctx.a > 1 || ctx.b instanceof Boolean && ctx.b`, `a > 1 || b`},
+		{`!(ctx.a instanceof Boolean && ctx.a)`, `!a`},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.script, func(t *testing.T) {
+			got, err := translatePainless(tc.script)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestTranslatePainlessUnsupported(t *testing.T) {
+	testCases := map[string]string{
+		`ctx.tags.contains('x')`:               `unsupported method call "contains" at offset 17`,
+		`ctx.message =~ /foo/`:                 `unsupported character '=' at offset 12`,
+		`params.x == 1`:                        `unsupported identifier "params" at offset 0`,
+		`ctx == null`:                          `unsupported use of ctx without a field`,
+		`ctx['a.b'] == 1`:                      `unsupported key containing a dot "'a.b'" at offset 4`,
+		`ctx.a === ctx.b`:                      `unsupported operator "===" at offset 6`,
+		`ctx.a == 'x`:                          `unterminated string at offset 9`,
+		`def x = ctx.a; return x == 1`:         `unsupported identifier "def" at offset 0`,
+		`ctx.a instanceof String`:              `unsupported instanceof type "String" at offset 17`,
+		`ctx.a instanceof Number`:              `expected "&&" after instanceof but found end of script`,
+		`ctx.a instanceof Number && ctx.b > 1`: `unsupported instanceof check of a at offset 6`,
+		`ctx.a instanceof Boolean && !ctx.a`:   `unsupported instanceof check of a at offset 6`,
+		`ctx.a == ctx.b instanceof Number`:     `unexpected "instanceof" at offset 15`,
+		`(ctx.a == 1`:                          `expected ")" but found end of script`,
+		`ctx.a == 1 ctx.b == 2`:                `unexpected "ctx" at offset 11`,
+		`ctx.a.`:                               `expected a field name but found end of script`,
+		`ctx.network.transport == 'tcp' ? `:    `unsupported character '?' at offset 31`,
+	}
+
+	for script, want := range testCases {
+		script, want := script, want
+		t.Run(script, func(t *testing.T) {
+			_, err := translatePainless(script)
+			require.Error(t, err)
+			assert.Equal(t, want, err.Error())
+		})
+	}
+}
+
+func TestToPainless(t *testing.T) {
+	testCases := []struct {
+		expr string
+		want string
+	}{
+		{`event.kind == "alert"`, `ctx.event?.kind == 'alert'`},
+		{`@timestamp != null`, `ctx['@timestamp'] != null`},
+		{`labels.@app == 'it\'s'`, `ctx.labels?.get('@app') == 'it\'s'`},
+		{`a == 1 || b < 2.5 && !c`, `ctx.a == 1 || ctx.b instanceof Number && ctx.b < 2.5 && !(ctx.c instanceof Boolean && ctx.c)`},
+		{`(a || b) && !(c == true)`, `(ctx.a instanceof Boolean && ctx.a || ctx.b instanceof Boolean && ctx.b) && !(ctx.c == true)`},
+		{`(a == b) == false`, `(ctx.a == ctx.b) == false`},
+		{`a == (b < 1)`, `ctx.a == (ctx.b instanceof Number && ctx.b < 1)`},
+		{`a >= b`, `ctx.a instanceof Number && ctx.b instanceof Number && ctx.a >= ctx.b`},
+		{`1 < a.b`, `ctx.a?.b instanceof Number && 1 < ctx.a?.b`},
+		{`a && b > 1`, `ctx.a instanceof Boolean && ctx.a && (ctx.b instanceof Number && ctx.b > 1)`},
+		{`2 > 1 && true`, `2 > 1 && true`},
+		{`a < 2147483647 || a > 2147483648`, `ctx.a instanceof Number && ctx.a < 2147483647 || ctx.a instanceof Number && ctx.a > 2147483648L`},
+		{`path == "C:\\temp"`, `ctx.path == 'C:\\temp'`},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.expr, func(t *testing.T) {
+			c, err := condition.Parse(tc.expr)
+			require.NoError(t, err)
+
+			got, err := toPainless(c.Expr())
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+
+			// Translating back must produce the same condition.
+			back, err := translatePainless(got)
+			require.NoError(t, err)
+			assert.Equal(t, c.String(), back)
+		})
+	}
+}
+
+func TestToPainlessUnsupported(t *testing.T) {
+	testCases := map[string]string{
+		`a < "x"`:      `cannot translate condition a < "x": only fields and numbers can be ordered`,
+		`a > (b == 1)`: `cannot translate condition a > (b == 1): only fields and numbers can be ordered`,
+		`a || 1`:       `cannot translate condition 1: 1 is not a boolean`,
+	}
+
+	for expr, want := range testCases {
+		expr, want := expr, want
+		t.Run(expr, func(t *testing.T) {
+			c, err := condition.Parse(expr)
+			require.NoError(t, err)
+
+			_, err = toPainless(c.Expr())
+			require.Error(t, err)
+			assert.Equal(t, want, err.Error())
+		})
+	}
+}
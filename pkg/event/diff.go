@@ -0,0 +1,98 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package event
+
+import (
+	"sort"
+	"strings"
+)
+
+// ChangeOp is the type of modification described by a Change.
+type ChangeOp string
+
+const (
+	ChangeAdd     ChangeOp = "add"     // Key was added.
+	ChangeRemove  ChangeOp = "remove"  // Key was removed.
+	ChangeReplace ChangeOp = "replace" // Value of the key was changed.
+)
+
+// Change describes a modification to a single key of an event.
+type Change struct {
+	Op  ChangeOp `json:"op"`
+	Key string   `json:"key"`           // Dot-separated key. Dots within a name are escaped.
+	Old *Value   `json:"old,omitempty"` // Value before the change. Nil for add.
+	New *Value   `json:"new,omitempty"` // Value after the change. Nil for remove.
+}
+
+// Diff returns the changes required to transform before into after. Objects
+// are compared recursively such that each change refers to the most specific
+// key that differs. Arrays are compared as a whole. The changes are sorted by
+// key. The values of the changes are copies so they are not affected by later
+// modifications of either event.
+func Diff(before, after *Event) []Change {
+	var a, b map[string]*Value
+	if before != nil {
+		a = before.fields
+	}
+	if after != nil {
+		b = after.fields
+	}
+
+	var changes []Change
+	diffObjects(nil, a, b, &changes)
+	return changes
+}
+
+func diffObjects(path []string, a, b map[string]*Value, changes *[]Change) {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, found := a[k]; !found {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		keyPath := append(path[:len(path):len(path)], k)
+
+		av, inA := a[k]
+		bv, inB := b[k]
+		switch {
+		case !inB:
+			*changes = append(*changes, Change{Op: ChangeRemove, Key: changeKey(keyPath), Old: av.Clone()})
+		case !inA:
+			*changes = append(*changes, Change{Op: ChangeAdd, Key: changeKey(keyPath), New: bv.Clone()})
+		case av != nil && bv != nil && av.Type == ObjectType && bv.Type == ObjectType:
+			diffObjects(keyPath, av.Object, bv.Object, changes)
+		case !av.Equal(bv):
+			*changes = append(*changes, Change{Op: ChangeReplace, Key: changeKey(keyPath), Old: av.Clone(), New: bv.Clone()})
+		}
+	}
+}
+
+// changeKey is the inverse of keyToPath.
+func changeKey(path []string) string {
+	escaped := make([]string, len(path))
+	for i, name := range path {
+		escaped[i] = strings.ReplaceAll(name, ".", `\.`)
+	}
+	return strings.Join(escaped, ".")
+}
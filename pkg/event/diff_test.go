@@ -0,0 +1,64 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package event
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	before := New()
+	before.Put("message", String("hello"))
+	before.Put("event.kind", String("event"))
+	before.Put("event.original", String("hello"))
+	before.Put("tags", Array(String("a")))
+	before.Put(`foo\.bar`, Integer(1))
+
+	after := before.Clone()
+	after.Put("message", String("HELLO"))
+	after.Delete("event.original")
+	after.Put("event.category", Array(String("network")))
+	after.Put("tags", Array(String("a"), String("b")))
+	after.Put(`foo\.bar`, Integer(2))
+
+	assert.Equal(t, []Change{
+		{Op: ChangeAdd, Key: "event.category", New: Array(String("network"))},
+		{Op: ChangeRemove, Key: "event.original", Old: String("hello")},
+		{Op: ChangeReplace, Key: `foo\.bar`, Old: Integer(1), New: Integer(2)},
+		{Op: ChangeReplace, Key: "message", Old: String("hello"), New: String("HELLO")},
+		{Op: ChangeReplace, Key: "tags", Old: Array(String("a")), New: Array(String("a"), String("b"))},
+	}, Diff(before, after))
+
+	assert.Empty(t, Diff(before, before.Clone()))
+	assert.Empty(t, Diff(New(), nil))
+	assert.Equal(t, []Change{{Op: ChangeAdd, Key: "message", New: String("hello")}},
+		Diff(nil, func() *Event { e := New(); e.Put("message", String("hello")); return e }()))
+}
+
+func TestDiffCopiesValues(t *testing.T) {
+	after := New()
+	after.Put("tags", Array(String("a")))
+
+	changes := Diff(nil, after)
+	tags := after.Get("tags")
+	tags.Array = append(tags.Array, String("b"))
+
+	assert.Equal(t, []Change{{Op: ChangeAdd, Key: "tags", New: Array(String("a"))}}, changes)
+}
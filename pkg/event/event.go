@@ -130,13 +130,33 @@ func (e *Event) delete(path []string) (deleted *Value) {
 	}
 
 	v := e.get(path)
-	if v != nil {
-		delete(e.fields, path[0])
+	if v == nil {
+		return nil
+	}
+
+	// Only the last key in the path is removed from its parent object.
+	m := e.fields
+	for _, key := range path[:len(path)-1] {
+		m = m[key].Object
 	}
+	delete(m, path[len(path)-1])
 
 	return v
 }
 
+// Clone returns a deep copy of the event.
+func (e *Event) Clone() *Event {
+	if e == nil {
+		return nil
+	}
+
+	c := &Event{}
+	if e.fields != nil {
+		c.fields = cloneObject(e.fields)
+	}
+	return c
+}
+
 func (e *Event) MarshalJSON() ([]byte, error) {
 	return json.Marshal(e.fields)
 }
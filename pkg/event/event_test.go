@@ -190,6 +190,18 @@ func TestEventDelete(t *testing.T) {
 		assert.Equal(t, val, e.Delete("a.b"))
 	})
 
+	t.Run("delete nested keeps siblings", func(t *testing.T) {
+		e := New()
+		e.init()
+		e.fields["a"] = Object(map[string]*Value{
+			"b": val,
+			"c": val,
+		})
+		assert.Equal(t, val, e.Delete("a.b"))
+		assert.Nil(t, e.Get("a.b"))
+		assert.Equal(t, val, e.Get("a.c"))
+	})
+
 	t.Run("delete key not found", func(t *testing.T) {
 		e := New()
 		e.init()
@@ -103,6 +103,82 @@ func (v *Value) Format(f fmt.State, verb rune) {
 	fmt.Fprintf(f, "%v", v.value())
 }
 
+// Clone returns a deep copy of the value.
+func (v *Value) Clone() *Value {
+	if v == nil {
+		return nil
+	}
+
+	c := *v
+	if v.Array != nil {
+		c.Array = make([]*Value, len(v.Array))
+		for i, item := range v.Array {
+			c.Array[i] = item.Clone()
+		}
+	}
+	if v.Object != nil {
+		c.Object = cloneObject(v.Object)
+	}
+	return &c
+}
+
+func cloneObject(m map[string]*Value) map[string]*Value {
+	c := make(map[string]*Value, len(m))
+	for k, v := range m {
+		c[k] = v.Clone()
+	}
+	return c
+}
+
+// Equal returns true if the values have the same type and contents. Arrays
+// and objects are compared recursively.
+func (v *Value) Equal(o *Value) bool {
+	if v == nil || o == nil {
+		return v == o
+	}
+	if v.Type != o.Type {
+		return false
+	}
+
+	switch v.Type {
+	case ArrayType:
+		if len(v.Array) != len(o.Array) {
+			return false
+		}
+		for i := range v.Array {
+			if !v.Array[i].Equal(o.Array[i]) {
+				return false
+			}
+		}
+		return true
+	case ObjectType:
+		if len(v.Object) != len(o.Object) {
+			return false
+		}
+		for k, item := range v.Object {
+			other, found := o.Object[k]
+			if !found || !item.Equal(other) {
+				return false
+			}
+		}
+		return true
+	case BoolType:
+		return v.Bool == o.Bool
+	case FloatType:
+		return v.Float == o.Float
+	case IntegerType:
+		return v.Integer == o.Integer
+	case StringType:
+		return v.String == o.String
+	case TimestampType:
+		return v.Timestamp == o.Timestamp
+	case UnsignedIntegerType:
+		return v.UnsignedInteger == o.UnsignedInteger
+	default:
+		return true
+	}
+}
+
 func (v *Value) MarshalJSON() ([]byte, error) {
 	// TODO: Replace this with an optimized version. There are a finite
 	// set of types so we can optimize this to avoid reflection.
@@ -124,3 +124,46 @@ func TestValueJSONMarshal(t *testing.T) {
 
 	assert.Equal(t, `{"hello":"world"}`, string(data))
 }
+
+func TestValueClone(t *testing.T) {
+	v := Object(map[string]*Value{
+		"list": Array(String("a"), Integer(1)),
+		"nested": Object(map[string]*Value{
+			"ts": Timestamp(testTimeUnix),
+		}),
+	})
+
+	c := v.Clone()
+	assert.True(t, v.Equal(c))
+
+	c.Object["list"].Array[0].String = "changed"
+	c.Object["nested"].Object["new"] = Bool(true)
+	assert.Equal(t, "a", v.Object["list"].Array[0].String)
+	assert.NotContains(t, v.Object["nested"].Object, "new")
+	assert.False(t, v.Equal(c))
+}
+
+func TestValueEqual(t *testing.T) {
+	testCases := []struct {
+		A, B  *Value
+		Equal bool
+	}{
+		{nil, nil, true},
+		{nil, NullValue, false},
+		{NullValue, &Value{Type: NullType}, true},
+		{String("a"), String("a"), true},
+		{String("a"), String("b"), false},
+		{Integer(1), UnsignedInteger(1), false},
+		{Float(1.5), Float(1.5), true},
+		{Array(Integer(1), Integer(2)), Array(Integer(1), Integer(2)), true},
+		{Array(Integer(1), Integer(2)), Array(Integer(2), Integer(1)), false},
+		{Array(Integer(1)), Array(Integer(1), Integer(1)), false},
+		{Object(map[string]*Value{"a": Bool(true)}), Object(map[string]*Value{"a": Bool(true)}), true},
+		{Object(map[string]*Value{"a": Bool(true)}), Object(map[string]*Value{"b": Bool(true)}), false},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.Equal, tc.A.Equal(tc.B), "%v == %v", tc.A, tc.B)
+		assert.Equal(t, tc.Equal, tc.B.Equal(tc.A), "%v == %v", tc.B, tc.A)
+	}
+}
@@ -48,8 +48,10 @@ func Unregister(c ...prometheus.Collector) {
 	}
 }
 
-func Listen(host string) {
-	httpHandler := promhttp.HandlerFor(reg, promhttp.HandlerOpts{
+// Handler returns an HTTP handler that serves the registered metrics in the
+// Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{
 		ErrorLog:            nil,
 		ErrorHandling:       0,
 		Registry:            nil,
@@ -58,7 +60,10 @@ func Listen(host string) {
 		Timeout:             0,
 		EnableOpenMetrics:   false,
 	})
+}
+
+func Listen(host string) {
 	mux := http.NewServeMux()
-	mux.Handle("/metrics", httpHandler)
+	mux.Handle("/metrics", Handler())
 	go http.ListenAndServe(host, mux)
 }
@@ -0,0 +1,65 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+)
+
+// Result is the outcome of processing a single event with ProcessBatch.
+type Result struct {
+	Event *event.Event // Processed event. Nil if the event was dropped or failed.
+	Err   error        // Error returned from processing the event.
+}
+
+// ProcessBatch processes the events concurrently using at most
+// runtime.GOMAXPROCS(0) goroutines. It returns a Result for each event in the
+// same order as the input. Each event is processed as if by ProcessContext.
+// The events must not be modified by the caller until ProcessBatch returns.
+func (pipe *Pipeline) ProcessBatch(ctx context.Context, events []*event.Event) []Result {
+	results := make([]Result, len(events))
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(events) {
+		workers = len(events)
+	}
+
+	var next int64 = -1
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(events) {
+					return
+				}
+				results[i].Event, results[i].Err = pipe.ProcessContext(ctx, events[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
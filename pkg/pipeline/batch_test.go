@@ -0,0 +1,103 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+)
+
+// These tests are most useful when run with the race detector (go test -race).
+
+func TestProcessBatch(t *testing.T) {
+	c := callPipelineConfig("a", "b")
+	c.Processors = append(c.Processors, ProcessorConfig{
+		"lowercase": &ProcessorOptionConfig{
+			Config: map[string]interface{}{
+				"field": "name",
+			},
+		},
+	})
+
+	set, err := NewSet(c, callPipelineConfig("b"))
+	require.NoError(t, err)
+	defer set.Close()
+
+	const count = 1000
+	events := make([]*event.Event, count)
+	for i := range events {
+		events[i] = event.New()
+		events[i].Put("seq", event.Integer(int64(i)))
+		// Every tenth event is missing the name field and fails.
+		if i%10 != 0 {
+			events[i].Put("name", event.String("NAME-"+strconv.Itoa(i)))
+		}
+	}
+
+	results := set.Get("a").ProcessBatch(context.Background(), events)
+	require.Len(t, results, count)
+
+	for i, r := range results {
+		if i%10 == 0 {
+			var procErr *ProcessorError
+			require.ErrorAs(t, r.Err, &procErr, "event %d", i)
+			assert.Equal(t, "lowercase", procErr.ProcessorType)
+			assert.Nil(t, r.Event)
+			continue
+		}
+
+		require.NoError(t, r.Err, "event %d", i)
+		require.NotNil(t, r.Event)
+		assert.EqualValues(t, i, r.Event.Get("seq").Integer)
+		assert.Equal(t, "name-"+strconv.Itoa(i), r.Event.Get("name").String)
+		assert.Len(t, r.Event.Get("path").Array, 2)
+	}
+
+	assert.EqualValues(t, count, testutil.ToFloat64(set.Get("a").processors[2].metricEventsInTotal))
+}
+
+func TestProcessBatchEmpty(t *testing.T) {
+	pipe, err := New(callPipelineConfig("a"))
+	require.NoError(t, err)
+	defer pipe.Close()
+
+	assert.Empty(t, pipe.ProcessBatch(context.Background(), nil))
+}
+
+func TestProcessBatchCancelled(t *testing.T) {
+	pipe, err := New(callPipelineConfig("a"))
+	require.NoError(t, err)
+	defer pipe.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results := pipe.ProcessBatch(ctx, []*event.Event{newTestEvent(), newTestEvent()})
+	require.Len(t, results, 2)
+	for _, r := range results {
+		assert.True(t, errors.Is(r.Err, context.Canceled))
+	}
+}
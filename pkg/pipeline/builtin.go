@@ -0,0 +1,96 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"sort"
+
+	"github.com/elastic/go-ucfg"
+
+	"github.com/andrewkroh/go-sawmill/pkg/processor"
+	"github.com/andrewkroh/go-sawmill/pkg/processor/registry"
+)
+
+// builtinConstructor constructs a builtin processor. The pipeline ID and
+// processor ID are provided so that builtins can construct nested processors.
+type builtinConstructor func(pipelineID, id string, config map[string]interface{}) (processor.Processor, error)
+
+// builtinProcessor is a processor that is implemented by the pipeline
+// package because it depends on pipeline internals.
+type builtinProcessor struct {
+	newProcessor builtinConstructor
+	options      []registry.Option // Options accepted by the processor.
+}
+
+// builtinProcessors contains the builtin processors. They take precedence
+// over processors from the registry.
+var builtinProcessors map[string]builtinProcessor
+
+func init() {
+	builtinProcessors = map[string]builtinProcessor{
+		foreachProcessorName: {
+			newProcessor: newForeachProcessor,
+			// The processor option is not unpacked by ucfg so it is not
+			// declared by the config struct.
+			options: append(registry.ConfigOptions(foreachConfig{}), registry.Option{Name: "processor", Required: true}),
+		},
+		pipelineProcessorName: {
+			newProcessor: newPipelineRefProcessor,
+			options:      registry.ConfigOptions(pipelineRefConfig{}),
+		},
+	}
+}
+
+// newProcessor constructs a builtin processor or a processor from the
+// registry.
+func newProcessor(pipelineID, id, processorType string, config map[string]interface{}) (processor.Processor, error) {
+	if builtin, found := builtinProcessors[processorType]; found {
+		return builtin.newProcessor(pipelineID, id, config)
+	}
+	return registry.NewProcessor(processorType, config)
+}
+
+// processorOptions returns the options accepted by a builtin processor or a
+// processor from the registry. It returns false if the processor type is
+// unknown.
+func processorOptions(processorType string) ([]registry.Option, bool) {
+	if builtin, found := builtinProcessors[processorType]; found {
+		return builtin.options, true
+	}
+	return registry.Options(processorType)
+}
+
+// processorTypes returns the names of all builtin and registered processors.
+func processorTypes() []string {
+	names := registry.Names()
+	for name := range builtinProcessors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// unpackConfig unpacks the raw processor options into the given config struct
+// pointer in the same manner as the processor registry.
+func unpackConfig(config map[string]interface{}, to interface{}) error {
+	uConf, err := ucfg.NewFrom(config)
+	if err != nil {
+		return err
+	}
+	return uConf.Unpack(to)
+}
@@ -25,17 +25,32 @@ import (
 type Config struct {
 	ID          string            `yaml:"id,omitempty"          json:"id,omitempty"`
 	Description string            `yaml:"description,omitempty" json:"description,omitempty"`
+	Timeout     string            `yaml:"timeout,omitempty"     json:"timeout,omitempty"`
 	Processors  []ProcessorConfig `yaml:"processors,omitempty"  json:"processors,omitempty"`
 	OnFailure   []ProcessorConfig `yaml:"on_failure,omitempty"  json:"on_failure,omitempty"`
+
+	secrets []interface{} // Values redacted by processor.ConfigString while the pipeline is open.
+	files   []string      // Files read by LoadConfig or LoadConfigFile.
+}
+
+// Files returns the absolute paths of the files that were read to load the
+// config. This includes the pipeline file, included files, and files
+// referenced by ${file:path}. It is empty if the config was not loaded by
+// LoadConfig or LoadConfigFile.
+func (c *Config) Files() []string {
+	return c.files
 }
 
 type ProcessorConfig map[string]*ProcessorOptionConfig
 
 type ProcessorOptionConfig struct {
-	ID        string                      `yaml:"id,omitempty"         json:"id,omitempty"`
-	If        ConditionalExpressionConfig `yaml:"if,omitempty"         json:"if,omitempty"`
-	OnFailure []ProcessorConfig           `yaml:"on_failure,omitempty" json:"on_failure,omitempty"`
-	Config    map[string]interface{}      `yaml:",inline"              json:"-"                    config:",inline"`
+	ID          string                      `yaml:"id,omitempty"          json:"id,omitempty"`
+	Tag         string                      `yaml:"tag,omitempty"         json:"tag,omitempty"`
+	Description string                      `yaml:"description,omitempty" json:"description,omitempty"`
+	If          ConditionalExpressionConfig `yaml:"if,omitempty"          json:"if,omitempty"`
+	Timeout     string                      `yaml:"timeout,omitempty"     json:"timeout,omitempty"`
+	OnFailure   []ProcessorConfig           `yaml:"on_failure,omitempty"  json:"on_failure,omitempty"`
+	Config      map[string]interface{}      `yaml:",inline"               json:"-"                     config:",inline"`
 }
 
 type ConditionalExpressionConfig string
@@ -72,7 +87,10 @@ func (c *ProcessorOptionConfig) UnmarshalJSON(data []byte) error {
 		return err
 	}
 	delete(raw, "id")
+	delete(raw, "tag")
+	delete(raw, "description")
 	delete(raw, "if")
+	delete(raw, "timeout")
 	delete(raw, "on_failure")
 
 	if len(raw) > 0 {
@@ -91,9 +109,18 @@ func (c ProcessorOptionConfig) MarshalJSON() ([]byte, error) {
 	if c.ID != "" {
 		data["id"] = c.ID
 	}
+	if c.Tag != "" {
+		data["tag"] = c.Tag
+	}
+	if c.Description != "" {
+		data["description"] = c.Description
+	}
 	if c.If != "" {
 		data["if"] = c.If
 	}
+	if c.Timeout != "" {
+		data["timeout"] = c.Timeout
+	}
 	if len(c.OnFailure) > 0 {
 		data["on_failure"] = c.OnFailure
 	}
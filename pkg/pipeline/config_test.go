@@ -18,6 +18,7 @@
 package pipeline
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -45,3 +46,18 @@ on_failure:
 	assert.Equal(t, "fail", name)
 	assert.NotNil(t, options)
 }
+
+func TestProcessorOptionConfigJSON(t *testing.T) {
+	const js = `{"description":"Lowercase the ID.","field":"user.id","id":"lc","tag":"lowercase-user"}`
+
+	var opts ProcessorOptionConfig
+	require.NoError(t, json.Unmarshal([]byte(js), &opts))
+	assert.Equal(t, "lc", opts.ID)
+	assert.Equal(t, "lowercase-user", opts.Tag)
+	assert.Equal(t, "Lowercase the ID.", opts.Description)
+	assert.Equal(t, map[string]interface{}{"field": "user.id"}, opts.Config)
+
+	data, err := json.Marshal(opts)
+	require.NoError(t, err)
+	assert.JSONEq(t, js, string(data))
+}
@@ -0,0 +1,171 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrewkroh/go-sawmill/pkg/processor"
+	"github.com/andrewkroh/go-sawmill/pkg/processor/registry"
+)
+
+// sleepProcessor sleeps for the configured duration or until the context is
+// done.
+type sleepProcessor struct {
+	config sleepConfig
+}
+
+type sleepConfig struct {
+	Duration time.Duration `config:"duration"`
+}
+
+func (p *sleepProcessor) Process(evt processor.Event) error {
+	select {
+	case <-time.After(p.config.Duration):
+		return nil
+	case <-evt.Context().Done():
+		return evt.Context().Err()
+	}
+}
+
+func (p *sleepProcessor) Config() sleepConfig {
+	return p.config
+}
+
+func init() {
+	registry.MustRegister("sleep", func(c sleepConfig) (*sleepProcessor, error) {
+		return &sleepProcessor{config: c}, nil
+	})
+}
+
+func sleepPipeline(sleep, timeout string) *Config {
+	return &Config{
+		ID: "sleep",
+		Processors: []ProcessorConfig{
+			{
+				"sleep": &ProcessorOptionConfig{
+					ID:      "sleep",
+					Timeout: timeout,
+					Config: map[string]interface{}{
+						"duration": sleep,
+					},
+				},
+			},
+		},
+		OnFailure: []ProcessorConfig{
+			{
+				"set": &ProcessorOptionConfig{
+					Config: map[string]interface{}{
+						"target_field": "event.kind",
+						"value":        "pipeline_error",
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestProcessContext(t *testing.T) {
+	t.Run("processor timeout", func(t *testing.T) {
+		c := sleepPipeline("1m", "10ms")
+		c.OnFailure = nil
+		pipe, err := New(c)
+		require.NoError(t, err)
+
+		_, err = pipe.Process(newTestEvent())
+		require.Error(t, err)
+
+		var timeoutErr *TimeoutError
+		require.ErrorAs(t, err, &timeoutErr)
+		assert.Equal(t, 10*time.Millisecond, timeoutErr.Timeout)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		var procErr *ProcessorError
+		require.ErrorAs(t, err, &procErr)
+		assert.Equal(t, "sleep", procErr.ProcessorID)
+
+		assert.EqualValues(t, 1, testutil.ToFloat64(pipe.processors[0].metricTimeoutsTotal))
+	})
+
+	t.Run("processor timeout handled by on_failure", func(t *testing.T) {
+		pipe, err := New(sleepPipeline("1m", "10ms"))
+		require.NoError(t, err)
+
+		evt, err := pipe.Process(newTestEvent())
+		require.NoError(t, err)
+		assert.Equal(t, "pipeline_error", evt.Get("event.kind").String)
+	})
+
+	t.Run("pipeline timeout", func(t *testing.T) {
+		c := sleepPipeline("1m", "")
+		c.Timeout = "10ms"
+		pipe, err := New(c)
+		require.NoError(t, err)
+
+		_, err = pipe.Process(newTestEvent())
+		require.Error(t, err)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		var timeoutErr *TimeoutError
+		require.ErrorAs(t, err, &timeoutErr)
+		assert.Equal(t, 10*time.Millisecond, timeoutErr.Timeout)
+	})
+
+	t.Run("context deadline", func(t *testing.T) {
+		pipe, err := New(sleepPipeline("1m", ""))
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		evt := newTestEvent()
+		_, err = pipe.ProcessContext(ctx, evt)
+		require.Error(t, err)
+
+		var timeoutErr *TimeoutError
+		require.ErrorAs(t, err, &timeoutErr)
+		assert.Zero(t, timeoutErr.Timeout)
+
+		// on_failure is not executed after the deadline is exceeded.
+		assert.Nil(t, evt.Get("event.kind"))
+	})
+
+	t.Run("context cancelled", func(t *testing.T) {
+		pipe, err := New(sleepPipeline("0s", ""))
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err = pipe.ProcessContext(ctx, newTestEvent())
+		require.ErrorIs(t, err, context.Canceled)
+		assert.EqualValues(t, 0, testutil.ToFloat64(pipe.processors[0].metricEventsInTotal))
+	})
+
+	t.Run("invalid timeout", func(t *testing.T) {
+		_, err := New(sleepPipeline("0s", "soon"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid timeout")
+	})
+}
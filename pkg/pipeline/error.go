@@ -0,0 +1,97 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// ProcessorError is returned by the pipeline when a processor fails and the
+// failure is not recovered by an on_failure handler or ignored. It identifies
+// the processor that failed.
+//
+// Use errors.As(err, &procErr) to obtain the ProcessorError from an error
+// returned by Pipeline.Process.
+type ProcessorError struct {
+	PipelineID    string // ID of the pipeline containing the processor.
+	ProcessorID   string // ID of the processor that failed.
+	ProcessorType string // Type of the processor (e.g. lowercase).
+	ProcessorTag  string // Optional user-defined tag of the processor.
+	Err           error  // Underlying cause of the failure.
+}
+
+func (e *ProcessorError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("processor <")
+	sb.WriteString(e.ProcessorID)
+	sb.WriteString("> of type <")
+	sb.WriteString(e.ProcessorType)
+	sb.WriteByte('>')
+	if e.ProcessorTag != "" {
+		sb.WriteString(" with tag <")
+		sb.WriteString(e.ProcessorTag)
+		sb.WriteByte('>')
+	}
+	sb.WriteString(" in pipeline <")
+	sb.WriteString(e.PipelineID)
+	sb.WriteString("> failed")
+	if e.Err != nil {
+		sb.WriteString(": ")
+		sb.WriteString(e.Err.Error())
+	}
+	return sb.String()
+}
+
+func (e *ProcessorError) Unwrap() error {
+	return e.Err
+}
+
+// TimeoutError is returned when a processor exceeds its timeout or when the
+// deadline for processing the event is exceeded. It matches
+// context.DeadlineExceeded when used with errors.Is.
+type TimeoutError struct {
+	// Timeout is the processor or pipeline timeout that was exceeded. It is
+	// zero when the deadline came from the context given by the caller.
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Timeout > 0 {
+		return "processing timed out after " + e.Timeout.String()
+	}
+	return "processing deadline exceeded"
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// contextError returns an error if the context is done. A TimeoutError is
+// returned if the deadline was exceeded.
+func contextError(ctx context.Context, timeout time.Duration) error {
+	switch err := ctx.Err(); err {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return &TimeoutError{Timeout: timeout}
+	default:
+		return err
+	}
+}
@@ -18,6 +18,9 @@
 package pipeline
 
 import (
+	"context"
+	"time"
+
 	"github.com/andrewkroh/go-sawmill/pkg/event"
 	"github.com/andrewkroh/go-sawmill/pkg/processor"
 )
@@ -28,8 +31,12 @@ var _ processor.Event = (*pipelineEvent)(nil)
 // event.Event and contains state about the event w.r.t. the pipeline.
 type pipelineEvent struct {
 	data      *event.Event
+	ctx       context.Context
 	cancelled bool
 	dropped   bool
+	depth     int           // Number of nested pipeline invocations.
+	timeout   time.Duration // Pipeline timeout that set the context deadline. Zero if the deadline is from the caller.
+	trace     *trace        // Records processor execution when simulating. Nil otherwise.
 }
 
 func (e *pipelineEvent) Put(key string, v *event.Value) (*event.Value, error) {
@@ -48,10 +55,17 @@ func (e *pipelineEvent) Delete(key string) *event.Value {
 	return e.data.Delete(key)
 }
 
+func (e *pipelineEvent) Context() context.Context {
+	if e.ctx == nil {
+		return context.Background()
+	}
+	return e.ctx
+}
+
 func (e *pipelineEvent) Cancel() {
 	e.cancelled = true
 }
 
-func (e pipelineEvent) Drop() {
+func (e *pipelineEvent) Drop() {
 	e.dropped = true
 }
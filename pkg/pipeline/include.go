@@ -0,0 +1,248 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// includeKey is the key of the directive that splices the processors from
+// another file into a processor list.
+const includeKey = "include"
+
+// includer resolves include directives and substitutes references.
+type includer struct {
+	opts    LoadOptions
+	stack   []string              // Absolute paths of the files being included.
+	origins map[*yaml.Node]string // Included processors to the file they came from.
+	secrets []interface{}         // Substituted values that contain file contents.
+	files   []string              // Absolute paths of the files that were read.
+}
+
+// addFile records a file that the config is loaded from.
+func (inc *includer) addFile(path string) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	for _, f := range inc.files {
+		if f == path {
+			return
+		}
+	}
+	inc.files = append(inc.files, path)
+}
+
+// readFile reads a file referenced by ${file:path} and records it.
+func (inc *includer) readFile(path string) ([]byte, error) {
+	inc.addFile(path)
+	if inc.opts.ReadFile != nil {
+		return inc.opts.ReadFile(path)
+	}
+	return os.ReadFile(path)
+}
+
+// expandPipeline resolves the includes in the processors and on_failure lists
+// of a pipeline definition. Relative paths are resolved against dir.
+func (inc *includer) expandPipeline(doc *yaml.Node, dir string) error {
+	if doc.Kind != yaml.MappingNode {
+		return nil
+	}
+	// Like the IDs generated by New, the IDs of included processors start
+	// with the pipeline ID so that they are unique across pipelines.
+	var prefix string
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if doc.Content[i].Value == "id" && doc.Content[i+1].Value != "" {
+			prefix = doc.Content[i+1].Value + "."
+		}
+	}
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		switch key := doc.Content[i].Value; key {
+		case "processors", "on_failure":
+			if err := inc.expandList(doc.Content[i+1], prefix+key, dir); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// expandList replaces each include directive in a processor list with the
+// processors from the included file. Included processors without an ID are
+// given one that contains the path of the file they came from.
+func (inc *includer) expandList(list *yaml.Node, path, dir string) error {
+	if list.Kind != yaml.SequenceNode {
+		return nil
+	}
+
+	content := make([]*yaml.Node, 0, len(list.Content))
+	for i, item := range list.Content {
+		itemPath := path + "[" + strconv.Itoa(i) + "]"
+
+		file, isInclude, err := includePath(item)
+		if err != nil {
+			return err
+		}
+		if !isInclude {
+			if err = inc.expandOnFailure(item, itemPath, dir); err != nil {
+				return err
+			}
+			content = append(content, item)
+			continue
+		}
+
+		if inc.opts.Untrusted {
+			return fmt.Errorf("line %d, column %d: include %s is not allowed", item.Line, item.Column, file)
+		}
+
+		base := itemPath + "." + includeKey + "(" + file + ")"
+		included, err := inc.load(file, base, dir)
+		if err != nil {
+			return fmt.Errorf("line %d, column %d: failed to include %s: %w", item.Line, item.Column, file, err)
+		}
+		content = append(content, included...)
+	}
+	list.Content = content
+	return nil
+}
+
+// expandOnFailure resolves the includes in the on_failure list of a
+// processor.
+func (inc *includer) expandOnFailure(proc *yaml.Node, path, dir string) error {
+	if proc.Kind != yaml.MappingNode || len(proc.Content) != 2 {
+		return nil
+	}
+	procType, opts := proc.Content[0].Value, proc.Content[1]
+	if opts.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(opts.Content); i += 2 {
+		if opts.Content[i].Value == "on_failure" {
+			return inc.expandList(opts.Content[i+1], path+"."+procType+".on_failure", dir)
+		}
+	}
+	return nil
+}
+
+// load reads the processors from an included file. The file contains either
+// a list of processors or a pipeline definition whose processors are used.
+func (inc *includer) load(file, base, dir string) ([]*yaml.Node, error) {
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(dir, file)
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range inc.stack {
+		if f == abs {
+			return nil, fmt.Errorf("include cycle: %s -> %s", strings.Join(inc.stack, " -> "), abs)
+		}
+	}
+
+	inc.addFile(abs)
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, err
+	}
+	var root yaml.Node
+	if err = yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	if len(root.Content) == 0 {
+		return nil, errors.New("file is empty")
+	}
+	if err = inc.substituteNode(&root); err != nil {
+		return nil, err
+	}
+
+	list := root.Content[0]
+	if list.Kind == yaml.MappingNode {
+		list = nil
+		for i := 0; i+1 < len(root.Content[0].Content); i += 2 {
+			if root.Content[0].Content[i].Value == "processors" {
+				list = root.Content[0].Content[i+1]
+			}
+		}
+	}
+	if list == nil || list.Kind != yaml.SequenceNode {
+		return nil, errors.New("file must contain a list of processors or a pipeline with processors")
+	}
+
+	inc.stack = append(inc.stack, abs)
+	defer func() { inc.stack = inc.stack[:len(inc.stack)-1] }()
+	if err = inc.expandList(list, base, filepath.Dir(abs)); err != nil {
+		return nil, err
+	}
+
+	for i, proc := range list.Content {
+		setDefaultID(proc, base+"["+strconv.Itoa(i)+"]")
+		if _, found := inc.origins[proc]; !found {
+			if inc.origins == nil {
+				inc.origins = map[*yaml.Node]string{}
+			}
+			inc.origins[proc] = file
+		}
+	}
+	return list.Content, nil
+}
+
+// includePath returns the path of an include directive. isInclude is false
+// if the node is not an include directive.
+func includePath(n *yaml.Node) (path string, isInclude bool, err error) {
+	if n.Kind != yaml.MappingNode || len(n.Content) != 2 || n.Content[0].Value != includeKey {
+		return "", false, nil
+	}
+	if v := n.Content[1]; v.Kind != yaml.ScalarNode || v.Value == "" {
+		return "", true, fmt.Errorf("line %d, column %d: include must be a file path", v.Line, v.Column)
+	}
+	return n.Content[1].Value, true, nil
+}
+
+// setDefaultID sets the ID of a processor that does not have one. The ID is
+// the processor's path followed by its type, like the IDs that are generated
+// by New.
+func setDefaultID(proc *yaml.Node, path string) {
+	if proc.Kind != yaml.MappingNode || len(proc.Content) != 2 {
+		return
+	}
+	procType, opts := proc.Content[0].Value, proc.Content[1]
+	switch {
+	case opts.Kind == yaml.ScalarNode && opts.Tag == "!!null":
+		opts = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: opts.Line, Column: opts.Column}
+		proc.Content[1] = opts
+	case opts.Kind != yaml.MappingNode:
+		return
+	}
+	for i := 0; i+1 < len(opts.Content); i += 2 {
+		if opts.Content[i].Value == "id" {
+			return
+		}
+	}
+
+	opts.Content = append([]*yaml.Node{
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: "id"},
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: path + "." + procType},
+	}, opts.Content...)
+}
@@ -0,0 +1,267 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFiles writes the files to a new temporary directory and returns the
+// directory.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+	return dir
+}
+
+func processorIDs(procs []ProcessorConfig) []string {
+	var ids []string
+	for _, proc := range procs {
+		for _, opts := range proc {
+			ids = append(ids, opts.ID)
+		}
+	}
+	return ids
+}
+
+func TestLoadConfigFileInclude(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.pipeline.yml": `
+id: main
+processors:
+  - set:
+      target_field: first
+      value: 1
+  - include: common/geo.yml
+  - include: common/tags.yml
+on_failure:
+  - include: common/error.yml
+`,
+		// A list of processors that includes a file relative to itself.
+		"common/geo.yml": `
+- set:
+    id: geo-city
+    target_field: geo.city
+    value: Tokyo
+- include: ../shared/country.yml
+`,
+		// A pipeline definition whose processors are included.
+		"shared/country.yml": `
+id: country
+processors:
+  - uppercase:
+      field: geo.country
+`,
+		"common/tags.yml": `
+- append:
+    field: tags
+    value: geo
+- drop:
+`,
+		"common/error.yml": `
+- set:
+    target_field: error.handled
+    value: true
+`,
+	})
+
+	config, err := LoadConfigFile(filepath.Join(dir, "main.pipeline.yml"), LoadOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"",
+		"geo-city",
+		"main.processors[1].include(common/geo.yml)[1].include(../shared/country.yml)[0].uppercase",
+		"main.processors[2].include(common/tags.yml)[0].append",
+		"main.processors[2].include(common/tags.yml)[1].drop",
+	}, processorIDs(config.Processors))
+	assert.Equal(t, []string{
+		"main.on_failure[0].include(common/error.yml)[0].set",
+	}, processorIDs(config.OnFailure))
+	assert.Equal(t, []string{
+		filepath.Join(dir, "main.pipeline.yml"),
+		filepath.Join(dir, "common", "geo.yml"),
+		filepath.Join(dir, "shared", "country.yml"),
+		filepath.Join(dir, "common", "tags.yml"),
+		filepath.Join(dir, "common", "error.yml"),
+	}, config.Files())
+
+	pipe, err := New(config)
+	require.NoError(t, err)
+	defer pipe.Close()
+
+	// Metrics are labeled with the position in the expanded pipeline, not
+	// with the ID that names the included file.
+	assert.Contains(t, pipe.processors[2].metricEventsInTotal.Desc().String(),
+		`component_id="main.processors[2].uppercase"`)
+}
+
+func TestLoadConfigFileIncludeTwice(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.pipeline.yml": `
+id: main
+processors:
+  - include: common.yml
+  - lowercase:
+      field: message
+      on_failure:
+        - include: common.yml
+  - include: common.yml
+`,
+		"common.yml": `
+- set:
+    target_field: ok
+    value: true
+`,
+	})
+
+	config, err := LoadConfigFile(filepath.Join(dir, "main.pipeline.yml"), LoadOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"main.processors[0].include(common.yml)[0].set",
+		"",
+		"main.processors[2].include(common.yml)[0].set",
+	}, processorIDs(config.Processors))
+	assert.Equal(t, []string{
+		"main.processors[1].lowercase.on_failure[0].include(common.yml)[0].set",
+	}, processorIDs(config.Processors[1]["lowercase"].OnFailure))
+	assert.Empty(t, Validate(config))
+}
+
+func TestLoadConfigFileIncludeErrors(t *testing.T) {
+	testCases := []struct {
+		name  string
+		files map[string]string
+		err   string
+	}{
+		{
+			name: "cycle",
+			files: map[string]string{
+				"main.pipeline.yml": "processors:\n  - include: a.yml\n",
+				"a.yml":             "- include: b.yml\n",
+				"b.yml":             "- include: a.yml\n",
+			},
+			err: "include cycle",
+		},
+		{
+			name: "self",
+			files: map[string]string{
+				"main.pipeline.yml": "processors:\n  - include: main.pipeline.yml\n",
+			},
+			err: "include cycle",
+		},
+		{
+			name: "missing file",
+			files: map[string]string{
+				"main.pipeline.yml": "processors:\n  - include: missing.yml\n",
+			},
+			err: "line 2, column 5: failed to include missing.yml",
+		},
+		{
+			name: "not a path",
+			files: map[string]string{
+				"main.pipeline.yml": "processors:\n  - include: [a.yml]\n",
+			},
+			err: "line 2, column 14: include must be a file path",
+		},
+		{
+			name: "no processors",
+			files: map[string]string{
+				"main.pipeline.yml": "processors:\n  - include: a.yml\n",
+				"a.yml":             "id: a\n",
+			},
+			err: "file must contain a list of processors",
+		},
+		{
+			name: "empty file",
+			files: map[string]string{
+				"main.pipeline.yml": "processors:\n  - include: a.yml\n",
+				"a.yml":             "",
+			},
+			err: "file is empty",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			dir := writeFiles(t, tc.files)
+			_, err := LoadConfigFile(filepath.Join(dir, "main.pipeline.yml"), LoadOptions{})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
+
+func TestLoadConfigInclude(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"common.yml": "- set:\n    target_field: ok\n    value: ${VALUE:yes}\n",
+	})
+
+	// Without a file the includes are resolved relative to Dir.
+	config, err := LoadConfig([]byte("processors:\n  - include: common.yml\n"), LoadOptions{Dir: dir})
+	require.NoError(t, err)
+	require.Len(t, config.Processors, 1)
+	assert.Equal(t, "yes", config.Processors[0]["set"].Config["value"])
+}
+
+func TestValidateFileInclude(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.pipeline.yml": `
+id: main
+processors:
+  - lowercase:
+      field: message
+      ignore_missng: true
+  - include: common/geo.yml
+`,
+		"common/geo.yml": `
+- set:
+    target_field: geo.city
+    value: Tokyo
+- uppercase:
+    feild: geo.country
+`,
+	})
+
+	errs, err := ValidateFile(filepath.Join(dir, "main.pipeline.yml"))
+	require.NoError(t, err)
+	require.Len(t, errs, 3, errs.Error())
+
+	assert.Equal(t, "", errs[0].File)
+	assert.Equal(t, 6, errs[0].Line)
+	assert.Equal(t, "processors[0].lowercase.ignore_missng", errs[0].Path)
+
+	for _, e := range errs[1:] {
+		assert.Equal(t, filepath.Join(dir, "common", "geo.yml"), e.File)
+		assert.Contains(t, e.Path, "processors[2].uppercase")
+	}
+	assert.Equal(t, 5, errs[1].Line)
+	assert.Equal(t, 6, errs[2].Line)
+}
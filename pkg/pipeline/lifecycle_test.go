@@ -0,0 +1,139 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrewkroh/go-sawmill/pkg/processor"
+	"github.com/andrewkroh/go-sawmill/pkg/processor/registry"
+)
+
+var (
+	resourcesStarted int64
+	resourcesClosed  int64
+)
+
+// resourceProcessor counts the number of times that it has been started and
+// closed.
+type resourceProcessor struct {
+	config resourceConfig
+}
+
+type resourceConfig struct{}
+
+func (p *resourceProcessor) Process(event processor.Event) error { return nil }
+
+func (p *resourceProcessor) Config() resourceConfig { return p.config }
+
+func (p *resourceProcessor) Start() error {
+	atomic.AddInt64(&resourcesStarted, 1)
+	return nil
+}
+
+func (p *resourceProcessor) Close() error {
+	atomic.AddInt64(&resourcesClosed, 1)
+	return nil
+}
+
+func init() {
+	registry.MustRegister("resource", func(c resourceConfig) (*resourceProcessor, error) {
+		return &resourceProcessor{config: c}, nil
+	})
+}
+
+func resetResourceCounters() {
+	atomic.StoreInt64(&resourcesStarted, 0)
+	atomic.StoreInt64(&resourcesClosed, 0)
+}
+
+func TestPipelineClose(t *testing.T) {
+	resource := func() ProcessorConfig {
+		return ProcessorConfig{"resource": &ProcessorOptionConfig{}}
+	}
+
+	t.Run("close all processors", func(t *testing.T) {
+		resetResourceCounters()
+
+		pipe, err := New(&Config{
+			ID: "resources",
+			Processors: []ProcessorConfig{
+				resource(),
+				{
+					"resource": &ProcessorOptionConfig{
+						OnFailure: []ProcessorConfig{resource()},
+					},
+				},
+				{
+					"foreach": &ProcessorOptionConfig{
+						Config: map[string]interface{}{
+							"field": "list",
+							"processor": map[string]interface{}{
+								"resource": nil,
+							},
+						},
+					},
+				},
+			},
+			OnFailure: []ProcessorConfig{resource()},
+		})
+		require.NoError(t, err)
+		assert.EqualValues(t, 5, atomic.LoadInt64(&resourcesStarted))
+		assert.EqualValues(t, 0, atomic.LoadInt64(&resourcesClosed))
+
+		require.NoError(t, pipe.Close())
+		assert.EqualValues(t, 5, atomic.LoadInt64(&resourcesClosed))
+
+		// Close is idempotent.
+		require.NoError(t, pipe.Close())
+		assert.EqualValues(t, 5, atomic.LoadInt64(&resourcesClosed))
+	})
+
+	t.Run("close on construction failure", func(t *testing.T) {
+		resetResourceCounters()
+
+		_, err := New(&Config{
+			ID: "resources",
+			Processors: []ProcessorConfig{
+				resource(),
+				resource(),
+				{"non_existent": &ProcessorOptionConfig{}},
+			},
+		})
+		require.Error(t, err)
+		assert.EqualValues(t, 2, atomic.LoadInt64(&resourcesStarted))
+		assert.EqualValues(t, 2, atomic.LoadInt64(&resourcesClosed))
+	})
+
+	t.Run("set close", func(t *testing.T) {
+		resetResourceCounters()
+
+		set, err := NewSet(
+			&Config{ID: "a", Processors: []ProcessorConfig{resource()}},
+			&Config{ID: "b", Processors: []ProcessorConfig{resource()}},
+		)
+		require.NoError(t, err)
+
+		require.NoError(t, set.Close())
+		assert.EqualValues(t, 2, atomic.LoadInt64(&resourcesClosed))
+	})
+}
@@ -0,0 +1,261 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadOptions control the substitution of variables when loading a pipeline
+// definition.
+type LoadOptions struct {
+	// Strict causes references to unset environment variables without a
+	// default to be an error. Otherwise they are replaced by an empty string.
+	Strict bool
+
+	// LookupEnv returns the value of an environment variable. It defaults to
+	// os.LookupEnv.
+	LookupEnv func(name string) (string, bool)
+
+	// ReadFile returns the contents of a file referenced with ${file:path}.
+	// It defaults to os.ReadFile.
+	ReadFile func(path string) ([]byte, error)
+
+	// KeepReferences leaves ${...} references unsubstituted (e.g. to convert
+	// a pipeline without writing the secrets it references).
+	KeepReferences bool
+
+	// Untrusted causes ${...} references and includes to be an error. Use it
+	// for definitions from untrusted sources (e.g. HTTP requests) because
+	// references and includes read files and environment variables.
+	Untrusted bool
+
+	// Dir is the directory that relative include paths are resolved against.
+	// It defaults to the working directory. LoadConfigFile uses the directory
+	// of the file.
+	Dir string
+}
+
+// LoadConfig parses a YAML (or JSON) pipeline definition. References in
+// string values are substituted before the config is decoded:
+//
+//	${VAR}           value of the environment variable VAR
+//	${VAR:default}   value of VAR, or default if VAR is not set
+//	${file:path}     contents of the file without trailing newlines
+//	$${              literal ${
+//
+// When a value consists of a single reference and is not quoted then the
+// type of the substituted value is detected like any other YAML value (e.g.
+// seed: ${SEED} is a number). Values that contain file contents are treated
+// as secrets and are redacted by processor.ConfigString while a pipeline
+// constructed from the config is open. Environment variables are not secrets
+// and are never redacted; use ${file:path} for sensitive values.
+//
+// Processor lists can contain include directives (e.g. "- include: geo.yml")
+// that are replaced by the processors from another file. The file contains
+// a list of processors or a pipeline definition whose processors are used.
+// Included processors without an ID are given one that contains the path of
+// the included file (e.g. processors[1].include(geo.yml)[0].set). Includes
+// may be nested but must not form a cycle.
+func LoadConfig(data []byte, opts LoadOptions) (*Config, error) {
+	return loadConfig(data, opts, &includer{opts: opts})
+}
+
+func loadConfig(data []byte, opts LoadOptions, inc *includer) (*Config, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	if len(root.Content) == 0 {
+		return nil, errors.New("pipeline definition is empty")
+	}
+	if err := inc.substituteNode(&root); err != nil {
+		return nil, err
+	}
+	if err := inc.expandPipeline(root.Content[0], opts.Dir); err != nil {
+		return nil, err
+	}
+
+	var config *Config
+	if err := root.Decode(&config); err != nil {
+		return nil, err
+	}
+	if config != nil {
+		config.secrets = inc.secrets
+		config.files = inc.files
+	}
+	return config, nil
+}
+
+// LoadConfigFile reads a YAML (or JSON) pipeline definition from a file and
+// loads it like LoadConfig. Includes are resolved relative to the file.
+func LoadConfigFile(path string, opts LoadOptions) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	opts.Dir = filepath.Dir(abs)
+	return loadConfig(data, opts, &includer{opts: opts, stack: []string{abs}, files: []string{abs}})
+}
+
+// substituteNode substitutes the references in all scalar values within the
+// node. Mapping keys are not modified. Values that contain file contents are
+// added to inc.secrets.
+func (inc *includer) substituteNode(n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, c := range n.Content {
+			if err := inc.substituteNode(c); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			if err := inc.substituteNode(n.Content[i]); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		if inc.opts.KeepReferences || !strings.Contains(n.Value, "${") {
+			return nil
+		}
+		opts := inc.opts
+		opts.ReadFile = inc.readFile
+		value, secret, err := substitute(n.Value, opts)
+		if err != nil {
+			return fmt.Errorf("line %d, column %d: %w", n.Line, n.Column, err)
+		}
+		retype := n.Style&(yaml.TaggedStyle|yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 &&
+			isSingleReference(n.Value)
+		if retype {
+			// Resolve the type of the substituted value.
+			n.Tag = ""
+		}
+		n.Value = value
+		if secret {
+			inc.secrets = append(inc.secrets, value)
+			if retype {
+				// The secret may be decoded as a number (e.g. seed: ${file:seed}).
+				var v interface{}
+				if err = n.Decode(&v); err == nil && v != value {
+					inc.secrets = append(inc.secrets, v)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// isSingleReference returns true if s consists of exactly one reference.
+func isSingleReference(s string) bool {
+	return strings.HasPrefix(s, "${") && strings.Index(s, "}") == len(s)-1
+}
+
+// substitute replaces the references in s. secret is true if the result
+// contains the contents of a file.
+func substitute(s string, opts LoadOptions) (result string, secret bool, err error) {
+	lookupEnv := opts.LookupEnv
+	if lookupEnv == nil {
+		lookupEnv = os.LookupEnv
+	}
+	readFile := opts.ReadFile
+	if readFile == nil {
+		readFile = os.ReadFile
+	}
+
+	var sb strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			sb.WriteString(s)
+			break
+		}
+		if i > 0 && s[i-1] == '$' {
+			// Escaped.
+			sb.WriteString(s[:i-1])
+			sb.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+		sb.WriteString(s[:i])
+
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", false, fmt.Errorf("unterminated reference %q", s[i:])
+		}
+		ref := s[i+2 : i+end]
+		s = s[i+end+1:]
+
+		if opts.Untrusted {
+			return "", false, fmt.Errorf("reference ${%s} is not allowed", ref)
+		}
+
+		if path := strings.TrimPrefix(ref, "file:"); path != ref {
+			data, err := readFile(path)
+			if err != nil {
+				return "", false, fmt.Errorf("failed to read ${file:%s}: %w", path, err)
+			}
+			sb.WriteString(strings.TrimRight(string(data), "\r\n"))
+			secret = true
+			continue
+		}
+
+		name, def, hasDefault := ref, "", false
+		if j := strings.IndexByte(ref, ':'); j >= 0 {
+			name, def, hasDefault = ref[:j], ref[j+1:], true
+		}
+		if !isVariableName(name) {
+			return "", false, fmt.Errorf("invalid variable name %q", name)
+		}
+
+		value, found := lookupEnv(name)
+		switch {
+		case found:
+		case hasDefault:
+			value = def
+		case opts.Strict:
+			return "", false, fmt.Errorf("environment variable %s is not set", name)
+		}
+		sb.WriteString(value)
+	}
+
+	return sb.String(), secret, nil
+}
+
+func isVariableName(s string) bool {
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '_' && !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
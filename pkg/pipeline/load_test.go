@@ -0,0 +1,202 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrewkroh/go-sawmill/pkg/processor"
+)
+
+func testLookupEnv(name string) (string, bool) {
+	v, found := map[string]string{
+		"SEED":   "42",
+		"APP":    "web",
+		"EMPTY":  "",
+		"LOOKUP": "/etc/sawmill/lookup.csv",
+	}[name]
+	return v, found
+}
+
+func TestLoadConfig(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "hmac")
+	require.NoError(t, os.WriteFile(secretFile, []byte("s3cr3t-hmac-key\n"), 0o600))
+
+	config, err := LoadConfig([]byte(`
+id: ${APP}-logs
+description: Uses $${APP} for the application name.
+processors:
+  - community_id:
+      seed: ${SEED}
+      target_field: "${SEED}"
+  - set:
+      target_field: lookup.path
+      value: ${LOOKUP}
+  - set:
+      target_field: environment
+      value: ${ENVIRONMENT:production}
+  - set:
+      target_field: empty
+      value: x${EMPTY}${UNSET}x
+  - set:
+      target_field: auth
+      value: Bearer ${file:`+secretFile+`}
+`), LoadOptions{LookupEnv: testLookupEnv})
+	require.NoError(t, err)
+
+	assert.Equal(t, "web-logs", config.ID)
+	assert.Equal(t, "Uses ${APP} for the application name.", config.Description)
+
+	option := func(i int, name string) interface{} {
+		for _, opts := range config.Processors[i] {
+			return opts.Config[name]
+		}
+		return nil
+	}
+	assert.Equal(t, 42, option(0, "seed"))
+	assert.Equal(t, "42", option(0, "target_field"))
+	assert.Equal(t, "/etc/sawmill/lookup.csv", option(1, "value"))
+	assert.Equal(t, "production", option(2, "value"))
+	assert.Equal(t, "xx", option(3, "value"))
+	assert.Equal(t, "Bearer s3cr3t-hmac-key", option(4, "value"))
+	assert.Equal(t, []string{secretFile}, config.Files())
+
+	// Substituted file contents are redacted while the pipeline is open.
+	pipe, err := New(config)
+	require.NoError(t, err)
+	assert.Contains(t, pipe.Processors()[4].Config, `"String":"[redacted]"`)
+	assert.NotContains(t, pipe.Processors()[4].Config, "s3cr3t")
+	require.NoError(t, pipe.Close())
+	assert.Contains(t, pipe.Processors()[4].Config, `"String":"Bearer s3cr3t-hmac-key"`)
+}
+
+func TestLoadConfigRedactsNumbers(t *testing.T) {
+	seedFile := filepath.Join(t.TempDir(), "seed")
+	require.NoError(t, os.WriteFile(seedFile, []byte("1234\n"), 0o600))
+
+	config, err := LoadConfig([]byte(`
+id: redact
+processors:
+  - community_id:
+      seed: ${file:`+seedFile+`}
+      target_field: network.community_id
+  - set:
+      target_field: port
+      value: 12345
+`), LoadOptions{})
+	require.NoError(t, err)
+
+	pipe, err := New(config)
+	require.NoError(t, err)
+	defer pipe.Close()
+
+	// The seed is decoded as a number. Other numbers containing the same
+	// digits are not redacted.
+	assert.Contains(t, pipe.Processors()[0].Config, `"Seed":"[redacted]"`)
+	assert.NotContains(t, pipe.Processors()[0].Config, "1234,")
+	assert.Contains(t, pipe.Processors()[1].Config, `"UnsignedInteger":12345`)
+	assert.Equal(t, `x={"a":"[redacted]","b":[12345,"[redacted]",-1234]}`+"\n",
+		processor.ConfigString("x", map[string]interface{}{"a": "1234", "b": []interface{}{12345, 1234, -1234}}))
+}
+
+func TestLoadConfigJSON(t *testing.T) {
+	config, err := LoadConfig([]byte(`{"id": "${APP}", "processors": [{"drop": {"if": "app == \"${APP}\""}}]}`),
+		LoadOptions{LookupEnv: testLookupEnv})
+	require.NoError(t, err)
+	assert.Equal(t, "web", config.ID)
+	assert.EqualValues(t, `app == "web"`, config.Processors[0]["drop"].If)
+}
+
+func TestLoadConfigKeepReferences(t *testing.T) {
+	config, err := LoadConfig([]byte(`
+id: ${APP}
+processors:
+  - community_id:
+      seed: ${SEED}
+  - set:
+      target_field: auth
+      value: ${file:/etc/sawmill/secret}
+`), LoadOptions{LookupEnv: testLookupEnv, KeepReferences: true})
+	require.NoError(t, err)
+
+	assert.Equal(t, "${APP}", config.ID)
+	assert.Equal(t, "${SEED}", config.Processors[0]["community_id"].Config["seed"])
+	assert.Equal(t, "${file:/etc/sawmill/secret}", config.Processors[1]["set"].Config["value"])
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	testCases := map[string]struct {
+		yaml   string
+		strict bool
+		err    string
+	}{
+		"unset strict": {
+			yaml:   "id: test\nprocessors:\n  - drop:\n      if: ${UNSET} == 1\n",
+			strict: true,
+			err:    "line 4, column 11: environment variable UNSET is not set",
+		},
+		"unterminated": {
+			yaml: "id: ${APP\n",
+			err:  `line 1, column 5: unterminated reference "${APP"`,
+		},
+		"invalid name": {
+			yaml: "id: ${APP-NAME}\n",
+			err:  `line 1, column 5: invalid variable name "APP-NAME"`,
+		},
+		"missing file": {
+			yaml: "id: test\ndescription: ${file:/does/not/exist}\n",
+			err:  "line 2, column 14: failed to read ${file:/does/not/exist}: open /does/not/exist: no such file or directory",
+		},
+		"empty": {
+			yaml: "",
+			err:  "pipeline definition is empty",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			_, err := LoadConfig([]byte(tc.yaml), LoadOptions{Strict: tc.strict, LookupEnv: testLookupEnv})
+			require.Error(t, err)
+			assert.Equal(t, tc.err, err.Error())
+		})
+	}
+
+	// Unset variables are empty unless strict.
+	config, err := LoadConfig([]byte("id: test${UNSET}\n"), LoadOptions{LookupEnv: testLookupEnv})
+	require.NoError(t, err)
+	assert.Equal(t, "test", config.ID)
+}
+
+func TestValidateYAMLSubstitutes(t *testing.T) {
+	t.Setenv("SAWMILL_TEST_TIMEOUT", "5s")
+
+	errs, err := ValidateYAML([]byte(`
+id: test
+timeout: ${SAWMILL_TEST_TIMEOUT}
+processors:
+  - drop:
+`))
+	require.NoError(t, err)
+	assert.Empty(t, errs)
+}
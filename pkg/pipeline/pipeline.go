@@ -18,39 +18,106 @@
 package pipeline
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/andrewkroh/go-sawmill/pkg/event"
+	"github.com/andrewkroh/go-sawmill/pkg/processor"
 )
 
+// Pipeline processes events through a sequence of processors.
+//
+// A Pipeline is safe for concurrent use by multiple goroutines provided that
+// an event is not processed by more than one goroutine at a time. This relies
+// on processors honoring the concurrency contract of processor.Processor.
 type Pipeline struct {
 	id         string
+	timeout    time.Duration
 	processors []*pipelineProcessor
 	onFailure  []*pipelineProcessor
+	secrets    []interface{}
+	closeOnce  sync.Once
 }
 
+// New returns a new Pipeline constructed from the config. Pipeline processors
+// cannot reference other pipelines unless ignore_missing_pipeline is set. Use
+// NewSet to construct pipelines that reference each other.
 func New(config *Config) (*Pipeline, error) {
+	pipe, err := newPipeline(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = linkPipelines(map[string]*Pipeline{pipe.ID(): pipe}); err != nil {
+		pipe.Close()
+		return nil, err
+	}
+
+	return pipe, nil
+}
+
+func newPipeline(config *Config) (*Pipeline, error) {
 	if config.ID == "" {
 		return nil, errors.New("pipeline must have a non-empty id")
 	}
 
-	processors, err := newPipelineProcessors(config.ID+".processors", config.Processors)
+	timeout, err := parseTimeout(config.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timeout for pipeline %s: %w", config.ID, err)
+	}
+
+	processors, err := newPipelineProcessors(config.ID, config.ID+".processors", config.Processors)
 	if err != nil {
 		return nil, err
 	}
 
-	onFailureProcessors, err := newPipelineProcessors(config.ID+".on_failure", config.OnFailure)
+	onFailureProcessors, err := newPipelineProcessors(config.ID, config.ID+".on_failure", config.OnFailure)
 	if err != nil {
+		closeProcessors(processors...)
 		return nil, err
 	}
 
-	return &Pipeline{
+	pipe := &Pipeline{
 		id:         config.ID,
+		timeout:    timeout,
 		processors: processors,
 		onFailure:  onFailureProcessors,
-	}, nil
+	}
+
+	if err = pipe.checkDuplicateIDs(); err != nil {
+		closeProcessors(processors...)
+		closeProcessors(onFailureProcessors...)
+		return nil, err
+	}
+
+	// The secrets stay registered until the pipeline is closed so that
+	// reloading a pipeline does not accumulate them.
+	pipe.secrets = config.secrets
+	for _, secret := range pipe.secrets {
+		processor.RegisterSecret(secret)
+	}
+
+	return pipe, nil
+}
+
+// checkDuplicateIDs returns an error if two processors in the pipeline,
+// including nested foreach and on_failure processors, have the same ID.
+func (pipe *Pipeline) checkDuplicateIDs() error {
+	var err error
+	seen := map[string]struct{}{}
+	pipe.visitProcessors(func(proc *pipelineProcessor) {
+		if _, found := seen[proc.ID]; found && err == nil {
+			err = fmt.Errorf("duplicate processor ID %s in pipeline %s", proc.ID, pipe.id)
+		}
+		seen[proc.ID] = struct{}{}
+	})
+	return err
 }
 
 // Process transforms an event by processing it through the pipeline. There
@@ -60,8 +127,23 @@ func New(config *Config) (*Pipeline, error) {
 //	Dropped event - Empty slice and nil error.
 //	Processing error - Empty slice and non-nil error.
 //	Event split - Slice length is greater than 1 and non-nil error.
+//
+// When a processor fails the returned error contains a *ProcessorError that
+// identifies the failed processor.
 func (pipe *Pipeline) Process(evt *event.Event) (*event.Event, error) {
-	pipeEvt := &pipelineEvent{data: evt}
+	return pipe.ProcessContext(context.Background(), evt)
+}
+
+// ProcessContext is like Process, but processing stops when the context is
+// done. If the context deadline or a processor or pipeline timeout is
+// exceeded then the returned error contains a *TimeoutError. If the context
+// is cancelled then the returned error matches context.Canceled.
+//
+// Timeouts are cooperative. Processors are given the context and are expected
+// to return when it is done. A processor that exceeds its timeout fails even
+// if it completed.
+func (pipe *Pipeline) ProcessContext(ctx context.Context, evt *event.Event) (*event.Event, error) {
+	pipeEvt := &pipelineEvent{data: evt, ctx: ctx}
 
 	if err := pipe.process(pipeEvt); err != nil {
 		return nil, err
@@ -79,20 +161,52 @@ func (pipe *Pipeline) Process(evt *event.Event) (*event.Event, error) {
 // a processor.Event that allow the additional of metadata and an explicit
 // drop method.
 func (pipe *Pipeline) process(evt *pipelineEvent) error {
+	if pipe.timeout > 0 {
+		parent, parentTimeout := evt.ctx, evt.timeout
+		deadline := time.Now().Add(pipe.timeout)
+		ctx, cancel := context.WithDeadline(evt.Context(), deadline)
+		evt.ctx = ctx
+
+		// Attribute the deadline to this pipeline only if it is not
+		// superseded by an earlier one.
+		if d, _ := ctx.Deadline(); d.Equal(deadline) {
+			evt.timeout = pipe.timeout
+		}
+		defer func() {
+			cancel()
+			evt.ctx, evt.timeout = parent, parentTimeout
+		}()
+	}
+
 	var err error
 	for _, proc := range pipe.processors {
+		if err = contextError(evt.Context(), evt.timeout); err != nil {
+			// Cancelled or deadline exceeded. Do not run on_failure.
+			return err
+		}
+
 		if err = proc.Process(evt); err != nil {
 			// Go to global on_failure handler.
 			break
 		}
+		if evt.dropped {
+			return nil
+		}
 	}
 
 	if err != nil && len(pipe.onFailure) > 0 {
+		if evt.Context().Err() != nil {
+			return err
+		}
+
 		for _, proc := range pipe.onFailure {
 			if err = proc.Process(evt); err != nil {
 				// Failure in global on_failure.
 				return err
 			}
+			if evt.dropped {
+				return nil
+			}
 		}
 	}
 
@@ -107,6 +221,25 @@ func (pipe *Pipeline) ID() string {
 	return pipe.id
 }
 
+// Close closes all processors in the pipeline, including those in on_failure
+// handlers, that implement io.Closer. Pipelines that are executed by pipeline
+// processors are not closed. It returns the first error that occurred. The
+// pipeline must not be used after it is closed.
+func (pipe *Pipeline) Close() error {
+	var firstErr error
+	pipe.closeOnce.Do(func() {
+		pipe.visitProcessors(func(proc *pipelineProcessor) {
+			if err := proc.close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		})
+		for _, secret := range pipe.secrets {
+			processor.UnregisterSecret(secret)
+		}
+	})
+	return firstErr
+}
+
 func (pipe *Pipeline) Metrics() []prometheus.Collector {
 	var metrics []prometheus.Collector
 	pipe.visitProcessors(func(proc *pipelineProcessor) {
@@ -115,21 +248,68 @@ func (pipe *Pipeline) Metrics() []prometheus.Collector {
 			proc.metricErrorsTotal,
 			proc.metricEventsInTotal,
 			proc.metricEventsOutTotal,
+			proc.metricTimeoutsTotal,
 		)
 	})
 	return metrics
 }
 
+// ProcessorInfo describes a processor of a pipeline.
+type ProcessorInfo struct {
+	ID     string
+	Type   string
+	Tag    string
+	Config string // String representation of the processor's config. Empty if the processor does not provide one.
+}
+
+// Processors returns a description of each processor in the pipeline,
+// including the nested foreach and on_failure processors, in the order they
+// are defined.
+func (pipe *Pipeline) Processors() []ProcessorInfo {
+	var infos []ProcessorInfo
+	pipe.visitProcessors(func(proc *pipelineProcessor) {
+		info := ProcessorInfo{ID: proc.ID, Type: proc.Type, Tag: proc.Tag}
+		if s, ok := proc.proc.(fmt.Stringer); ok {
+			info.Config = strings.TrimSuffix(s.String(), "\n")
+		}
+		infos = append(infos, info)
+	})
+	return infos
+}
+
 func (pipe *Pipeline) visitProcessors(visit func(processor *pipelineProcessor)) {
 	for _, proc := range pipe.processors {
 		visitProcessor(visit, proc)
 	}
+	for _, proc := range pipe.onFailure {
+		visitProcessor(visit, proc)
+	}
 }
 
 func visitProcessor(visit func(processor *pipelineProcessor), proc *pipelineProcessor) {
 	visit(proc)
 
+	if foreach, ok := proc.proc.(*foreachProcessor); ok {
+		visitProcessor(visit, foreach.processor)
+	}
+
 	for _, proc := range proc.OnFailure {
 		visitProcessor(visit, proc)
 	}
 }
+
+// parseTimeout parses an optional timeout duration.
+func parseTimeout(timeout string) (time.Duration, error) {
+	if timeout == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(timeout)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, errors.New("timeout must not be negative")
+	}
+	return d, nil
+}
@@ -29,6 +29,7 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v3"
@@ -39,8 +40,11 @@ import (
 
 	// Register processors for testing purposes.
 	_ "github.com/andrewkroh/go-sawmill/pkg/processor/append"
+	_ "github.com/andrewkroh/go-sawmill/pkg/processor/community_id"
+	_ "github.com/andrewkroh/go-sawmill/pkg/processor/drop"
 	_ "github.com/andrewkroh/go-sawmill/pkg/processor/lowercase"
 	_ "github.com/andrewkroh/go-sawmill/pkg/processor/set"
+	_ "github.com/andrewkroh/go-sawmill/pkg/processor/uppercase"
 )
 
 var generateExpected = flag.Bool("g", false, "generate expected output")
@@ -252,6 +256,10 @@ func TestPipeline(t *testing.T) {
 		kind := evt.Get("event.kind")
 		require.NotNil(t, kind)
 		assert.Equal(t, "pipeline_error", kind.String)
+
+		// An error recovered by on_failure is still counted as an error.
+		assert.EqualValues(t, 1, testutil.ToFloat64(pipe.processors[0].metricErrorsTotal))
+		assert.EqualValues(t, 0, testutil.ToFloat64(pipe.processors[0].metricEventsOutTotal))
 	})
 
 	t.Run("pipeline err with global on_failure", func(t *testing.T) {
@@ -310,6 +318,92 @@ func TestPipeline(t *testing.T) {
 
 		assert.Contains(t, err.Error(), "non_existent")
 	})
+
+	t.Run("processor error details", func(t *testing.T) {
+		pipeline := &Config{
+			ID: "lowercase-non-existent",
+			Processors: []ProcessorConfig{
+				{
+					"lowercase": &ProcessorOptionConfig{
+						Tag: "lowercase-tag",
+						Config: map[string]interface{}{
+							"field": "non_existent",
+						},
+					},
+				},
+			},
+		}
+		pipe, err := New(pipeline)
+		require.NoError(t, err)
+
+		_, err = pipe.Process(newTestEvent())
+		require.Error(t, err)
+
+		var procErr *ProcessorError
+		require.ErrorAs(t, err, &procErr)
+		assert.Equal(t, "lowercase-non-existent", procErr.PipelineID)
+		assert.Equal(t, "lowercase-non-existent.processors[0].lowercase", procErr.ProcessorID)
+		assert.Equal(t, "lowercase", procErr.ProcessorType)
+		assert.Equal(t, "lowercase-tag", procErr.ProcessorTag)
+		assert.ErrorIs(t, err, processor.ErrorKeyMissing{})
+	})
+
+	t.Run("processor error from on_failure", func(t *testing.T) {
+		pipeline := &Config{
+			ID: "on-failure-fails",
+			Processors: []ProcessorConfig{
+				{
+					"fail": &ProcessorOptionConfig{
+						ID: "outer",
+						OnFailure: []ProcessorConfig{
+							{
+								"fail": &ProcessorOptionConfig{ID: "inner"},
+							},
+						},
+					},
+				},
+			},
+		}
+		pipe, err := New(pipeline)
+		require.NoError(t, err)
+
+		_, err = pipe.Process(newTestEvent())
+		var procErr *ProcessorError
+		require.ErrorAs(t, err, &procErr)
+		assert.Equal(t, "inner", procErr.ProcessorID)
+		assert.Equal(t, "fail", procErr.ProcessorType)
+	})
+}
+
+func TestNewInvalidCondition(t *testing.T) {
+	c := samplePipeline()
+	c.Processors[0]["set"].If = "event.kind =="
+
+	_, err := New(c)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid if condition for processor with ID logs-sample.processors[0].set")
+}
+
+func TestNewDuplicateProcessorID(t *testing.T) {
+	c := samplePipeline()
+	c.Processors[0]["set"].ID = "set-id"
+	c.OnFailure[0]["set"].ID = "set-id"
+
+	_, err := New(c)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "duplicate processor ID set-id in pipeline logs-sample")
+}
+
+func TestProcessorMetricsUsePositionalID(t *testing.T) {
+	c := samplePipeline()
+	c.Processors[0]["set"].ID = "set-id"
+
+	pipe, err := New(c)
+	require.NoError(t, err)
+
+	assert.Equal(t, "set-id", pipe.processors[0].ID)
+	assert.Contains(t, pipe.processors[0].metricEventsInTotal.Desc().String(),
+		`component_id="logs-sample.processors[0].set"`)
 }
 
 func newTestEvent() *event.Event {
@@ -325,11 +419,7 @@ func TestPipelines(t *testing.T) {
 
 	for _, name := range pipelineFiles {
 		t.Run(name, func(t *testing.T) {
-			data, err := ioutil.ReadFile(name)
-			require.NoError(t, err)
-
-			var pipelineConfig *Config
-			err = yaml.Unmarshal(data, &pipelineConfig)
+			pipelineConfig, err := LoadConfigFile(name, LoadOptions{})
 			require.NoError(t, err)
 
 			pipe, err := New(pipelineConfig)
@@ -337,7 +427,7 @@ func TestPipelines(t *testing.T) {
 
 			// Load events.
 			prefix := strings.TrimSuffix(name, ".pipeline.yml")
-			data, err = ioutil.ReadFile(prefix + ".events.json")
+			data, err := ioutil.ReadFile(prefix + ".events.json")
 			require.NoError(t, err)
 
 			type testEvents struct {
@@ -388,3 +478,36 @@ func TestPipelines(t *testing.T) {
 		})
 	}
 }
+
+func TestPipelineProcessors(t *testing.T) {
+	config, err := LoadConfig([]byte(`
+id: p
+processors:
+  - lowercase:
+      field: message
+      tag: lower
+      on_failure:
+        - set:
+            target_field: error.message
+            value: failed
+on_failure:
+  - set:
+      target_field: event.kind
+      value: pipeline_error
+`), LoadOptions{})
+	require.NoError(t, err)
+	pipe, err := New(config)
+	require.NoError(t, err)
+
+	procs := pipe.Processors()
+	require.Len(t, procs, 3)
+	assert.Equal(t, ProcessorInfo{
+		ID:     "p.processors[0].lowercase",
+		Type:   "lowercase",
+		Tag:    "lower",
+		Config: `lowercase={"Field":"message","IgnoreMissing":false,"TargetField":""}`,
+	}, procs[0])
+	assert.Equal(t, "p.processors[0].lowercase.on_failure[0].set", procs[1].ID)
+	assert.Equal(t, "p.on_failure[0].set", procs[2].ID)
+	assert.True(t, strings.HasPrefix(procs[2].Config, "set={"), procs[2].Config)
+}
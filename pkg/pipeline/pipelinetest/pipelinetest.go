@@ -0,0 +1,355 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package pipelinetest runs golden file tests for pipelines.
+//
+// Test cases are discovered from the files in a directory. Each pipeline file
+// named <name>.pipeline.yml (or .yaml or .json) is paired with input files
+// sharing its name prefix:
+//
+//	<name>.events.json - JSON array of input events.
+//	<name>.events.yml  - YAML list of input events.
+//	<name>.log         - Lines of text. Each non-empty line becomes an event
+//	                     containing event.original and @metadata.line_number.
+//
+// The output of processing the input is compared to the expected output
+// stored in <input name without extension>-expected.json. The expected output
+// is a JSON array containing the resulting event, error message, or drop
+// status for each input event. It is compared as JSON, so formatting and key
+// order do not matter. Because <name>.events.json and <name>.events.yml share
+// an expected file, only one of them may exist. Expected files can be
+// (re)generated by running with update enabled.
+package pipelinetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"gopkg.in/yaml.v3"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+	"github.com/andrewkroh/go-sawmill/pkg/pipeline"
+)
+
+var (
+	pipelineSuffixes = []string{".pipeline.yml", ".pipeline.yaml", ".pipeline.json"}
+	inputSuffixes    = []string{".events.json", ".events.yml", ".log"}
+)
+
+// Case is a single test case consisting of a pipeline and an input file.
+type Case struct {
+	Name         string // Name of the case (the input file name).
+	PipelineFile string // Path to the pipeline definition.
+	InputFile    string // Path to the input events or lines.
+	ExpectedFile string // Path to the expected output.
+}
+
+// Result is the result of running a Case.
+type Result struct {
+	Case    Case
+	Diff    string // Unified diff from the expected to the actual output. Empty when they match.
+	Updated bool   // True if the expected file was written.
+}
+
+// Failed returns true if the actual output did not match the expected output.
+func (r *Result) Failed() bool {
+	return r.Diff != ""
+}
+
+// Output is the expected output for a single input event.
+type Output struct {
+	Index   int          `json:"index"`
+	Event   *event.Event `json:"event,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	Dropped bool         `json:"dropped,omitempty"`
+}
+
+// FindCases returns the test cases contained in dir sorted by name.
+func FindCases(dir string) ([]Case, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]struct{}{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			files[entry.Name()] = struct{}{}
+		}
+	}
+
+	var cases []Case
+	inputs := map[string]string{} // Expected file name to input file name.
+	for name := range files {
+		prefix, found := trimAnySuffix(name, pipelineSuffixes)
+		if !found {
+			continue
+		}
+
+		for _, suffix := range inputSuffixes {
+			input := prefix + suffix
+			if _, found := files[input]; !found {
+				continue
+			}
+
+			expected := expectedFileName(input)
+			if other, found := inputs[expected]; found {
+				return nil, fmt.Errorf("inputs %s and %s in %s would share the expected output %s", other, input, dir, expected)
+			}
+			inputs[expected] = input
+
+			cases = append(cases, Case{
+				Name:         input,
+				PipelineFile: filepath.Join(dir, name),
+				InputFile:    filepath.Join(dir, input),
+				ExpectedFile: filepath.Join(dir, expected),
+			})
+		}
+	}
+	sort.Slice(cases, func(i, j int) bool {
+		return cases[i].Name < cases[j].Name
+	})
+
+	return cases, nil
+}
+
+func trimAnySuffix(s string, suffixes []string) (string, bool) {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(s, suffix) {
+			return strings.TrimSuffix(s, suffix), true
+		}
+	}
+	return s, false
+}
+
+func expectedFileName(input string) string {
+	return strings.TrimSuffix(input, filepath.Ext(input)) + "-expected.json"
+}
+
+// Run runs the test case. If update is true then the actual output is
+// written to the expected file rather than being compared to it.
+func (c Case) Run(update bool) (*Result, error) {
+	config, err := LoadPipeline(c.PipelineFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pipeline from %s: %w", c.PipelineFile, err)
+	}
+
+	pipe, err := pipeline.New(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pipeline from %s: %w", c.PipelineFile, err)
+	}
+	defer pipe.Close()
+
+	events, err := LoadEvents(c.InputFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load input from %s: %w", c.InputFile, err)
+	}
+
+	actual, err := marshalOutputs(Process(pipe, events))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Case: c}
+	if update {
+		if err = os.WriteFile(c.ExpectedFile, actual, 0o644); err != nil {
+			return nil, err
+		}
+		result.Updated = true
+		return result, nil
+	}
+
+	expected, err := os.ReadFile(c.ExpectedFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("expected output %s does not exist (run with update to generate it)", c.ExpectedFile)
+		}
+		return nil, err
+	}
+
+	equal, err := jsonEqual(expected, actual)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode expected output %s: %w", c.ExpectedFile, err)
+	}
+	if !equal {
+		// Show the diff in the format of the actual output.
+		var outputs []Output
+		if err = json.Unmarshal(expected, &outputs); err == nil {
+			if formatted, err := marshalOutputs(outputs); err == nil {
+				expected = formatted
+			}
+		}
+
+		result.Diff, err = difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(string(expected)),
+			B:        difflib.SplitLines(string(actual)),
+			FromFile: c.ExpectedFile,
+			ToFile:   "actual",
+			Context:  3,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// jsonEqual returns true if a and b contain equivalent JSON. Whitespace and
+// the order of object keys are ignored.
+func jsonEqual(a, b []byte) (bool, error) {
+	var av, bv interface{}
+	if err := unmarshalNumbers(a, &av); err != nil {
+		return false, err
+	}
+	if err := unmarshalNumbers(b, &bv); err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(av, bv), nil
+}
+
+func unmarshalNumbers(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// Run runs each test case found in dir as a subtest of t.
+func Run(t *testing.T, dir string, update bool) {
+	t.Helper()
+
+	cases, err := FindCases(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) == 0 {
+		t.Fatalf("no pipeline test cases found in %s", dir)
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			result, err := c.Run(update)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Failed() {
+				t.Fatalf("Output does not match the expected output:\n%s", result.Diff)
+			}
+		})
+	}
+}
+
+// Process processes each event through the pipeline and returns the outputs.
+func Process(pipe *pipeline.Pipeline, events []*event.Event) []Output {
+	outputs := make([]Output, 0, len(events))
+	for i, evt := range events {
+		out := Output{Index: i}
+
+		var err error
+		out.Event, err = pipe.Process(evt)
+		switch {
+		case err != nil:
+			out.Error = err.Error()
+		case out.Event == nil:
+			out.Dropped = true
+		}
+		outputs = append(outputs, out)
+	}
+	return outputs
+}
+
+func marshalOutputs(outputs []Output) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(outputs); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// LoadPipeline reads a YAML or JSON pipeline definition. Variables are
+// substituted with pipeline.LoadConfigFile.
+func LoadPipeline(path string) (*pipeline.Config, error) {
+	config, err := pipeline.LoadConfigFile(path, pipeline.LoadOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, errors.New("pipeline file is empty")
+	}
+	return config, nil
+}
+
+// LoadEvents reads the input events from a file. The format is determined
+// by the file name (see the package documentation).
+func LoadEvents(path string) ([]*event.Event, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strings.HasSuffix(path, ".log"):
+		return linesToEvents(data), nil
+	case strings.HasSuffix(path, ".yml"):
+		// Convert the YAML to JSON because events only implement JSON
+		// unmarshaling.
+		var v []interface{}
+		if err = yaml.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		if data, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+
+	var events []*event.Event
+	if err = json.Unmarshal(data, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// linesToEvents creates an event from each non-empty line in the same way
+// as the sawmill command.
+func linesToEvents(data []byte) []*event.Event {
+	var events []*event.Event
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		evt := event.New()
+		evt.Put("@metadata.line_number", event.UnsignedInteger(uint64(i+1)))
+		evt.Put("event.original", event.String(line))
+		events = append(events, evt)
+	}
+	return events
+}
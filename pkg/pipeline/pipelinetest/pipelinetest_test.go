@@ -0,0 +1,125 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipelinetest
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	// Register processors for testing purposes.
+	_ "github.com/andrewkroh/go-sawmill/pkg/processor/lowercase"
+	_ "github.com/andrewkroh/go-sawmill/pkg/processor/set"
+)
+
+var update = flag.Bool("update", false, "update expected output files")
+
+func TestRun(t *testing.T) {
+	Run(t, "testdata", *update)
+}
+
+func TestFindCases(t *testing.T) {
+	cases, err := FindCases("testdata")
+	require.NoError(t, err)
+
+	assert.Equal(t, []Case{
+		{
+			Name:         "greeting.events.yml",
+			PipelineFile: filepath.Join("testdata", "greeting.pipeline.yml"),
+			InputFile:    filepath.Join("testdata", "greeting.events.yml"),
+			ExpectedFile: filepath.Join("testdata", "greeting.events-expected.json"),
+		},
+		{
+			Name:         "greeting.log",
+			PipelineFile: filepath.Join("testdata", "greeting.pipeline.yml"),
+			InputFile:    filepath.Join("testdata", "greeting.log"),
+			ExpectedFile: filepath.Join("testdata", "greeting-expected.json"),
+		},
+	}, cases)
+}
+
+func TestFindCasesConflictingInputs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.pipeline.yml", "a.events.json", "a.events.yml"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+
+	_, err := FindCases(dir)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "would share the expected output a.events-expected.json")
+}
+
+func TestCaseRun(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"greeting.pipeline.yml", "greeting.log"} {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o644))
+	}
+
+	cases, err := FindCases(dir)
+	require.NoError(t, err)
+	require.Len(t, cases, 1)
+	c := cases[0]
+
+	_, err = c.Run(false)
+	require.Error(t, err, "expected file is missing")
+	assert.Contains(t, err.Error(), "does not exist")
+
+	result, err := c.Run(true)
+	require.NoError(t, err)
+	assert.True(t, result.Updated)
+	assert.False(t, result.Failed())
+
+	result, err = c.Run(false)
+	require.NoError(t, err)
+	assert.False(t, result.Failed())
+
+	// Formatting and key order of the expected file do not matter.
+	var expected []map[string]interface{}
+	data, err := os.ReadFile(c.ExpectedFile)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &expected))
+	data, err = json.Marshal(expected)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(c.ExpectedFile, data, 0o644))
+
+	result, err = c.Run(false)
+	require.NoError(t, err)
+	assert.False(t, result.Failed(), result.Diff)
+
+	// Change the pipeline so that the output no longer matches.
+	require.NoError(t, os.WriteFile(c.PipelineFile, []byte(`
+id: greeting
+processors:
+  - lowercase:
+      field: event.original
+      target_field: msg
+`), 0o644))
+
+	result, err = c.Run(false)
+	require.NoError(t, err)
+	assert.True(t, result.Failed())
+	assert.Contains(t, result.Diff, `-      "message": "hello world"`)
+	assert.Contains(t, result.Diff, `+      "msg": "hello world"`)
+}
@@ -18,20 +18,28 @@
 package pipeline
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"strconv"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 
+	"github.com/andrewkroh/go-sawmill/pkg/condition"
 	"github.com/andrewkroh/go-sawmill/pkg/processor"
-	"github.com/andrewkroh/go-sawmill/pkg/processor/registry"
 )
 
 type pipelineProcessor struct {
 	ID            string
-	Condition     string // TODO: Not implemented.
+	PipelineID    string
+	Type          string
+	Tag           string
+	Description   string
+	Condition     *condition.Condition // Nil if the processor is unconditional.
+	Timeout       time.Duration
 	IgnoreFailure bool
 	IgnoreMissing bool
 	OnFailure     []*pipelineProcessor
@@ -43,20 +51,37 @@ type pipelineProcessor struct {
 	metricErrorsTotal          prometheus.Counter // Total errors (not including ignored or recovered errors).
 	metricEventsInTotal        prometheus.Counter // Received events.
 	metricEventsOutTotal       prometheus.Counter // Successfully output events.
+	metricTimeoutsTotal        prometheus.Counter // Timeouts (processor timeout or pipeline deadline).
 }
 
 func (p *pipelineProcessor) Process(event *pipelineEvent) error {
-	// TODO: Check Condition before executing.
+	if p.Condition != nil && !p.Condition.Eval(event) {
+		event.trace.skipped(p)
+		return nil
+	}
+
 	p.metricEventsInTotal.Inc()
 
-	if err := p.proc.Process(event); err != nil {
-		if event.dropped {
-			p.metricDiscardedEventsTotal.Inc()
-			return nil
-		}
+	span := event.trace.begin(p, event.data)
+	err := p.run(event)
+	span.end(event, err)
+
+	// Processing was cancelled or the pipeline deadline was exceeded so
+	// the error cannot be recovered.
+	if err != nil && event.Context().Err() != nil {
+		p.metricErrorsTotal.Inc()
+		return p.newError(err)
+	}
+
+	if event.dropped {
+		p.metricDiscardedEventsTotal.Inc()
+		return nil
+	}
 
+	if err != nil {
 		// Ignore Missing
-		if p.IgnoreMissing && errors.Is(err, processor.ErrorKeyMissing{}) {
+		if p.IgnoreMissing && isOwnKeyMissingError(err) {
+			span.ignored()
 			p.metricEventsOutTotal.Inc()
 			return nil
 		}
@@ -64,28 +89,113 @@ func (p *pipelineProcessor) Process(event *pipelineEvent) error {
 		// On Failure
 		if len(p.OnFailure) > 0 {
 			for _, proc := range p.OnFailure {
-				if err = proc.Process(event); err != nil {
+				if err = proc.Process(event); err != nil || event.dropped {
 					break
 				}
 			}
+
+			// Recovered by the on_failure handler. The failure is still
+			// counted as an error.
+			if err == nil {
+				p.metricErrorsTotal.Inc()
+				return nil
+			}
 		}
 
 		// Ignore Failure
 		if p.IgnoreFailure && err != nil {
+			span.ignored()
 			p.metricEventsOutTotal.Inc()
 			return nil
 		}
 
 		// Could not recover from the error or ignore it.
 		p.metricErrorsTotal.Inc()
-		return err
+		return p.newError(err)
 	}
 
 	p.metricEventsOutTotal.Inc()
 	return nil
 }
 
-func newPipelineProcessors(baseID string, procConfigs []ProcessorConfig) ([]*pipelineProcessor, error) {
+// run executes the processor while enforcing its timeout.
+func (p *pipelineProcessor) run(event *pipelineEvent) error {
+	parent := event.Context()
+
+	ctx := parent
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(parent, p.Timeout)
+		defer cancel()
+	}
+
+	event.ctx = ctx
+	err := p.proc.Process(event)
+	event.ctx = parent
+
+	// Cancellation or the pipeline deadline takes precedence over the
+	// processor's own timeout and error.
+	if ctxErr := contextError(parent, event.timeout); ctxErr != nil {
+		if errors.Is(ctxErr, context.DeadlineExceeded) {
+			p.metricTimeoutsTotal.Inc()
+		}
+		return ctxErr
+	}
+	if ctx.Err() != nil {
+		p.metricTimeoutsTotal.Inc()
+		return &TimeoutError{Timeout: p.Timeout}
+	}
+	return err
+}
+
+// close closes the processor if it implements io.Closer. Nested processors
+// are not closed.
+func (p *pipelineProcessor) close() error {
+	closer, ok := p.proc.(io.Closer)
+	if !ok {
+		return nil
+	}
+	if err := closer.Close(); err != nil {
+		return fmt.Errorf("failed to close processor with ID %s: %w", p.ID, err)
+	}
+	return nil
+}
+
+// closeProcessors closes the processors and their nested processors. It is
+// used to release resources when construction fails.
+func closeProcessors(procs ...*pipelineProcessor) {
+	for _, proc := range procs {
+		visitProcessor(func(p *pipelineProcessor) { p.close() }, proc)
+	}
+}
+
+// newError wraps err in a ProcessorError that identifies this processor. If err
+// already contains a ProcessorError (e.g. from a failed on_failure handler)
+// then it is returned unchanged so that the innermost processor that failed
+// is reported. The failure that triggered the on_failure handler is not
+// included.
+func (p *pipelineProcessor) newError(err error) error {
+	var procErr *ProcessorError
+	if errors.As(err, &procErr) {
+		return err
+	}
+	return &ProcessorError{
+		PipelineID:    p.PipelineID,
+		ProcessorID:   p.ID,
+		ProcessorType: p.Type,
+		ProcessorTag:  p.Tag,
+		Err:           err,
+	}
+}
+
+// isOwnKeyMissingError returns true if err is an ErrorKeyMissing that was
+// not returned by a nested processor (e.g. from within a foreach).
+func isOwnKeyMissingError(err error) bool {
+	var procErr *ProcessorError
+	return errors.Is(err, processor.ErrorKeyMissing{}) && !errors.As(err, &procErr)
+}
+
+func newPipelineProcessors(pipelineID, baseID string, procConfigs []ProcessorConfig) ([]*pipelineProcessor, error) {
 	if len(procConfigs) == 0 {
 		return nil, nil
 	}
@@ -97,8 +207,9 @@ func newPipelineProcessors(baseID string, procConfigs []ProcessorConfig) ([]*pip
 			return nil, err
 		}
 
-		pipeProc, err := newPipelineProcessor(baseID, i, procType, options)
+		pipeProc, err := newPipelineProcessor(pipelineID, baseID, i, procType, options)
 		if err != nil {
+			closeProcessors(processors...)
 			return nil, err
 		}
 
@@ -108,36 +219,61 @@ func newPipelineProcessors(baseID string, procConfigs []ProcessorConfig) ([]*pip
 	return processors, nil
 }
 
-func newPipelineProcessor(baseID string, processorIndex int, processorType string, config *ProcessorOptionConfig) (*pipelineProcessor, error) {
-	// Pseudo JSON XPath expression.
-	id := baseID + "[" + strconv.Itoa(processorIndex) + "]." + processorType
+func newPipelineProcessor(pipelineID, baseID string, processorIndex int, processorType string, config *ProcessorOptionConfig) (*pipelineProcessor, error) {
+	// Pseudo JSON XPath expression unless an ID was explicitly given.
+	positionalID := baseID + "[" + strconv.Itoa(processorIndex) + "]." + processorType
+	id := positionalID
+	if config.ID != "" {
+		id = config.ID
+	}
 
+	// Metrics are always labeled with the positional ID so that labels are
+	// stable and unique across pipelines.
 	labels := map[string]string{
 		"component_kind": "processor",
 		"component_type": processorType,
-		"component_id":   id,
+		"component_id":   positionalID,
 	}
 
-	proc, err := registry.NewProcessor(processorType, config.Config)
+	timeout, err := parseTimeout(config.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timeout for processor with ID %s: %w", id, err)
+	}
+
+	var cond *condition.Condition
+	if config.If != "" {
+		if cond, err = condition.Parse(string(config.If)); err != nil {
+			return nil, fmt.Errorf("invalid if condition for processor with ID %s: %w", id, err)
+		}
+	}
+
+	proc, err := newProcessor(pipelineID, id, processorType, config.Config)
 	if err != nil {
 		return nil, fmt.Errorf("failed constructing processor with ID %s: %w", id, err)
 	}
 
 	ignoreMissingPtr, ignoreFailurePtr, err := ignores(proc)
 	if err != nil {
+		closeProcessors(&pipelineProcessor{ID: id, proc: proc})
 		return nil, err
 	}
 
-	onFailureProcessors, err := newPipelineProcessors(id+".on_failure", config.OnFailure)
+	onFailureProcessors, err := newPipelineProcessors(pipelineID, id+".on_failure", config.OnFailure)
 	if err != nil {
+		closeProcessors(&pipelineProcessor{ID: id, proc: proc})
 		return nil, err
 	}
 
 	p := &pipelineProcessor{
-		ID:        id,
-		Condition: string(config.If),
-		OnFailure: onFailureProcessors,
-		proc:      proc,
+		ID:          id,
+		PipelineID:  pipelineID,
+		Type:        processorType,
+		Tag:         config.Tag,
+		Description: config.Description,
+		Condition:   cond,
+		Timeout:     timeout,
+		OnFailure:   onFailureProcessors,
+		proc:        proc,
 		metricDiscardedEventsTotal: prometheus.NewCounter(prometheus.CounterOpts{
 			Namespace:   "es",
 			Name:        "component_discarded_events_total",
@@ -162,6 +298,12 @@ func newPipelineProcessor(baseID string, processorIndex int, processorType strin
 			Help:        "Total number of events sent by component.",
 			ConstLabels: labels,
 		}),
+		metricTimeoutsTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   "es",
+			Name:        "component_timeouts_total",
+			Help:        "Total number of timeouts by component.",
+			ConstLabels: labels,
+		}),
 	}
 	if ignoreMissingPtr != nil {
 		p.IgnoreMissing = *ignoreMissingPtr
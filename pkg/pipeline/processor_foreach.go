@@ -0,0 +1,219 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+	"github.com/andrewkroh/go-sawmill/pkg/processor"
+)
+
+const foreachProcessorName = "foreach"
+
+const (
+	// foreachValueKey holds the current element while the nested processor
+	// executes.
+	foreachValueKey = "_ingest._value"
+
+	// foreachKeyKey holds the current key while iterating over an object.
+	foreachKeyKey = "_ingest._key"
+)
+
+type foreachConfig struct {
+	// Array or object field to iterate over.
+	Field string `config:"field" validate:"required"`
+
+	// If true and field does not exist or is null, the processor quietly
+	// returns without modifying the document.
+	IgnoreMissing bool `config:"ignore_missing"`
+
+	// Processor to execute against each element. It is not unpacked by
+	// ucfg because nested processors may have no options.
+	Processor map[string]interface{} `config:"-"`
+}
+
+// foreachProcessor executes a nested processor against each element of an
+// array or each key/value pair of an object.
+type foreachProcessor struct {
+	config    foreachConfig
+	processor *pipelineProcessor
+}
+
+func newForeachProcessor(pipelineID, id string, config map[string]interface{}) (processor.Processor, error) {
+	foreachOptions := make(map[string]interface{}, len(config))
+	for k, v := range config {
+		foreachOptions[k] = v
+	}
+	rawProcessor, found := foreachOptions["processor"]
+	if !found || rawProcessor == nil {
+		return nil, errors.New("missing required field accessing 'processor'")
+	}
+	delete(foreachOptions, "processor")
+
+	p := &foreachProcessor{}
+	if err := unpackConfig(foreachOptions, &p.config); err != nil {
+		return nil, err
+	}
+
+	// Convert the raw options into a ProcessorConfig.
+	data, err := json.Marshal(rawProcessor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid foreach processor: %w", err)
+	}
+	var procConfig ProcessorConfig
+	if err = json.Unmarshal(data, &procConfig); err != nil {
+		return nil, fmt.Errorf("invalid foreach processor: %w", err)
+	}
+	if err = json.Unmarshal(data, &p.config.Processor); err != nil {
+		return nil, fmt.Errorf("invalid foreach processor: %w", err)
+	}
+
+	procType, options, err := procConfig.getProcessor()
+	if err != nil {
+		return nil, fmt.Errorf("invalid foreach processor: %w", err)
+	}
+
+	p.processor, err = newPipelineProcessor(pipelineID, id+".processor", 0, procType, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *foreachProcessor) Config() foreachConfig {
+	return p.config
+}
+
+func (p *foreachProcessor) String() string {
+	return processor.ConfigString(foreachProcessorName, p.config)
+}
+
+func (p *foreachProcessor) Process(evt processor.Event) error {
+	pipeEvt, ok := evt.(*pipelineEvent)
+	if !ok {
+		return errors.New("foreach processor can only be used within a pipeline")
+	}
+
+	v := evt.Get(p.config.Field)
+	if v == nil || v.Type == event.NullType {
+		return processor.ErrorKeyMissing{Key: p.config.Field}
+	}
+
+	if v.Type != event.ArrayType && v.Type != event.ObjectType {
+		return fmt.Errorf("field <%s> of type %v cannot be iterated", p.config.Field, v.Type)
+	}
+
+	// Preserve any values from an outer foreach. They must be restored before
+	// writing the result because the field may be the outer _ingest._value.
+	prevValue, prevKey := evt.Get(foreachValueKey), evt.Get(foreachKeyKey)
+
+	var result *event.Value
+	var err error
+	if v.Type == event.ArrayType {
+		result, err = p.processArray(pipeEvt, v.Array)
+	} else {
+		result, err = p.processObject(pipeEvt, v.Object)
+	}
+
+	restoreIngestKey(evt, foreachValueKey, prevValue)
+	restoreIngestKey(evt, foreachKeyKey, prevKey)
+	if err != nil {
+		return err
+	}
+
+	_, err = evt.Put(p.config.Field, result)
+	return err
+}
+
+func (p *foreachProcessor) processArray(evt *pipelineEvent, items []*event.Value) (*event.Value, error) {
+	out := make([]*event.Value, 0, len(items))
+	for _, item := range items {
+		if item == nil {
+			item = event.NullValue
+		}
+		if _, err := evt.Put(foreachValueKey, item); err != nil {
+			return nil, err
+		}
+
+		if err := p.processor.Process(evt); err != nil {
+			return nil, err
+		}
+
+		out = append(out, valueOrNull(evt.Get(foreachValueKey)))
+	}
+	return event.Array(out...), nil
+}
+
+func (p *foreachProcessor) processObject(evt *pipelineEvent, fields map[string]*event.Value) (*event.Value, error) {
+	// Iterate in a deterministic order.
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make(map[string]*event.Value, len(fields))
+	for _, k := range keys {
+		if _, err := evt.Put(foreachKeyKey, event.String(k)); err != nil {
+			return nil, err
+		}
+		if _, err := evt.Put(foreachValueKey, valueOrNull(fields[k])); err != nil {
+			return nil, err
+		}
+
+		if err := p.processor.Process(evt); err != nil {
+			return nil, err
+		}
+
+		// The nested processor may rename the key.
+		key := evt.Get(foreachKeyKey)
+		if key == nil || key.Type != event.StringType {
+			return nil, fmt.Errorf("%s must be a string after processing key <%s>", foreachKeyKey, k)
+		}
+		out[key.String] = valueOrNull(evt.Get(foreachValueKey))
+	}
+	return event.Object(out), nil
+}
+
+// restoreIngestKey restores the key to its previous value. If the key had no
+// previous value then it is deleted, and the _ingest object is removed once it
+// is empty.
+func restoreIngestKey(evt processor.Event, key string, prev *event.Value) {
+	if prev != nil {
+		evt.Put(key, prev)
+		return
+	}
+
+	evt.Delete(key)
+	if ingest := evt.Get("_ingest"); ingest != nil && ingest.Type == event.ObjectType && len(ingest.Object) == 0 {
+		evt.Delete("_ingest")
+	}
+}
+
+func valueOrNull(v *event.Value) *event.Value {
+	if v == nil {
+		// Allocate a new value because the processors may modify it.
+		return &event.Value{Type: event.NullType}
+	}
+	return v
+}
@@ -0,0 +1,97 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+)
+
+func TestForeachNested(t *testing.T) {
+	pipe, err := New(&Config{
+		ID: "nested-foreach",
+		Processors: []ProcessorConfig{
+			{
+				"foreach": &ProcessorOptionConfig{
+					Config: map[string]interface{}{
+						"field": "matrix",
+						"processor": map[string]interface{}{
+							"foreach": map[string]interface{}{
+								"field": "_ingest._value",
+								"processor": map[string]interface{}{
+									"uppercase": map[string]interface{}{
+										"field": "_ingest._value",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	// Outer foreach, inner foreach, and uppercase.
+	assert.Len(t, pipe.Metrics(), 3*5)
+
+	evt := event.New()
+	evt.Put("matrix", event.Array(
+		event.Array(event.String("a"), event.String("b")),
+		event.Array(event.String("c")),
+	))
+
+	evt, err = pipe.Process(evt)
+	require.NoError(t, err)
+
+	assert.Equal(t, event.Array(
+		event.Array(event.String("A"), event.String("B")),
+		event.Array(event.String("C")),
+	), evt.Get("matrix"))
+	assert.Nil(t, evt.Get("_ingest"))
+}
+
+func TestForeachProcessorConfig(t *testing.T) {
+	newForeach := func(config map[string]interface{}) error {
+		_, err := New(&Config{
+			ID: "foreach",
+			Processors: []ProcessorConfig{
+				{"foreach": &ProcessorOptionConfig{Config: config}},
+			},
+		})
+		return err
+	}
+
+	// A nested processor without options is passed to its constructor
+	// rather than rejected as an empty processor option.
+	err := newForeach(map[string]interface{}{
+		"field":     "list",
+		"processor": map[string]interface{}{"uppercase": nil},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "foreach.processors[0].foreach.processor[0].uppercase")
+	assert.Contains(t, err.Error(), "accessing 'field'")
+
+	err = newForeach(map[string]interface{}{"field": "list"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "missing required field accessing 'processor'")
+}
@@ -0,0 +1,88 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/andrewkroh/go-sawmill/pkg/processor"
+)
+
+const pipelineProcessorName = "pipeline"
+
+// maxPipelineDepth is the maximum number of nested pipeline invocations
+// allowed while processing an event.
+const maxPipelineDepth = 32
+
+type pipelineRefConfig struct {
+	// The ID of the pipeline to execute.
+	Name string `config:"name" validate:"required"`
+
+	// If true and the pipeline does not exist, the processor quietly returns
+	// without modifying the document.
+	IgnoreMissingPipeline bool `config:"ignore_missing_pipeline"`
+}
+
+// pipelineRefProcessor executes another pipeline from the same Set.
+type pipelineRefProcessor struct {
+	config pipelineRefConfig
+
+	// Pipeline referenced by name. It is resolved by linkPipelines and is nil
+	// if the pipeline does not exist.
+	target *Pipeline
+}
+
+func newPipelineRefProcessor(_, _ string, config map[string]interface{}) (processor.Processor, error) {
+	p := &pipelineRefProcessor{}
+	if err := unpackConfig(config, &p.config); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *pipelineRefProcessor) Config() pipelineRefConfig {
+	return p.config
+}
+
+func (p *pipelineRefProcessor) String() string {
+	return processor.ConfigString(pipelineProcessorName, p.config)
+}
+
+func (p *pipelineRefProcessor) Process(evt processor.Event) error {
+	if p.target == nil {
+		if p.config.IgnoreMissingPipeline {
+			return nil
+		}
+		return fmt.Errorf("pipeline <%s> does not exist", p.config.Name)
+	}
+
+	pipeEvt, ok := evt.(*pipelineEvent)
+	if !ok {
+		return errors.New("pipeline processor can only be used within a pipeline")
+	}
+
+	if pipeEvt.depth >= maxPipelineDepth {
+		return fmt.Errorf("failed to execute pipeline <%s>: maximum pipeline nesting depth of %d exceeded",
+			p.config.Name, maxPipelineDepth)
+	}
+	pipeEvt.depth++
+	defer func() { pipeEvt.depth-- }()
+
+	return p.target.process(pipeEvt)
+}
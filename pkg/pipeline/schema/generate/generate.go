@@ -0,0 +1,275 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/andrewkroh/go-sawmill/internal/proctemplate"
+)
+
+const (
+	schemaDraft = "http://json-schema.org/draft-07/schema#"
+	schemaID    = "https://github.com/andrewkroh/go-sawmill/pkg/pipeline/schema/pipeline.schema.json"
+
+	// durationPattern matches the durations accepted by time.ParseDuration
+	// (without a sign).
+	durationPattern = `^(0|([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+)$`
+)
+
+// Flags
+var (
+	processorsYmlFile string
+	outputFile        string
+)
+
+func init() {
+	flag.StringVar(&processorsYmlFile, "p", "processors.yml", "processors.yml file to use as the source")
+	flag.StringVar(&outputFile, "o", "pipeline.schema.json", "output file")
+}
+
+func main() {
+	flag.Parse()
+
+	p, err := proctemplate.ReadProcessorsYAMLFile(processorsYmlFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	data, err := generate(p)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err = ioutil.WriteFile(outputFile, data, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// schema is a JSON Schema object. Keys are sorted when it is marshaled so the
+// output is stable.
+type schema map[string]interface{}
+
+// generate returns the JSON Schema for a pipeline definition that uses the
+// processors from processors.yml.
+func generate(p *proctemplate.Processors) ([]byte, error) {
+	definitions := schema{
+		"processors": schema{
+			"description": "List of processors that are executed sequentially.",
+			"type":        "array",
+			"items": schema{
+				"anyOf": []interface{}{ref("processor"), ref("include")},
+			},
+		},
+		"include": schema{
+			"description":          "Splices the processors from another file into the list. The path is relative to the including file.",
+			"type":                 "object",
+			"properties":           schema{"include": schema{"type": "string", "minLength": 1}},
+			"required":             []interface{}{"include"},
+			"additionalProperties": false,
+		},
+		"duration": schema{
+			"description": "Duration such as 100ms, 5s, or 1m30s.",
+			"type":        "string",
+			"pattern":     durationPattern,
+		},
+	}
+
+	names := make([]string, 0, len(p.Processors))
+	processorProperties := schema{}
+	for _, v := range p.Processors {
+		for name, proc := range v {
+			def, err := processorSchema(proc)
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate schema for processor %s: %w", name, err)
+			}
+			definitions[name+"_processor"] = def
+			processorProperties[name] = ref(name + "_processor")
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	definitions["processor"] = schema{
+		"description":          "A processor. It must contain exactly one key that is the processor type: " + strings.Join(names, ", ") + ".",
+		"type":                 "object",
+		"properties":           processorProperties,
+		"additionalProperties": false,
+		"minProperties":        1,
+		"maxProperties":        1,
+	}
+
+	root := schema{
+		"$schema":     schemaDraft,
+		"$id":         schemaID,
+		"title":       "sawmill pipeline",
+		"description": "Definition of a sawmill pipeline.",
+		"type":        "object",
+		"properties": schema{
+			"id": schema{
+				"description": "Identifier of the pipeline. It is used to reference the pipeline from the pipeline processor and in metrics and errors.",
+				"type":        "string",
+				"minLength":   1,
+			},
+			"description": schema{
+				"description": "Description of the purpose of the pipeline.",
+				"type":        "string",
+			},
+			"timeout": withDescription(ref("duration"),
+				"Maximum duration of the pipeline for each event. Exceeding it is a pipeline failure."),
+			"processors": ref("processors"),
+			"on_failure": withDescription(ref("processors"),
+				"Processors to execute when the pipeline fails."),
+		},
+		"required":             []string{"id"},
+		"additionalProperties": false,
+		"definitions":          definitions,
+	}
+
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(root); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// commonOptions returns the schemas of the options that are accepted by all
+// processors.
+func commonOptions() schema {
+	return schema{
+		"id": schema{
+			"description": "Identifier for the processor. It is used in errors and traces and must be unique within the pipeline. Defaults to the processor's position in the pipeline.",
+			"type":        "string",
+		},
+		"tag": schema{
+			"description": "Identifier for the processor that is reported in errors.",
+			"type":        "string",
+		},
+		"description": schema{
+			"description": "Description of the purpose of the processor.",
+			"type":        "string",
+		},
+		"if": schema{
+			"description": "Condition that must be true for the processor to run.",
+			"type":        "string",
+			"minLength":   1,
+		},
+		"timeout": withDescription(ref("duration"),
+			"Maximum duration of the processor for each event. Exceeding it is a processor failure."),
+		"on_failure": withDescription(ref("processors"),
+			"Processors to execute when the processor fails."),
+	}
+}
+
+func processorSchema(proc proctemplate.Processor) (schema, error) {
+	properties := commonOptions()
+	var required []string
+	for _, opt := range proc.Configuration {
+		s, err := optionSchema(opt)
+		if err != nil {
+			return nil, err
+		}
+		properties[opt.Name] = s
+		if opt.Required {
+			required = append(required, opt.Name)
+		}
+	}
+	sort.Strings(required)
+
+	s := schema{
+		"description":          normalizeDescription(proc.Description),
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		s["type"] = "object"
+		s["required"] = required
+	} else {
+		// Processors without required options can be written with no value
+		// (e.g. "- drop:").
+		s["type"] = []string{"object", "null"}
+	}
+	return s, nil
+}
+
+func optionSchema(opt proctemplate.ConfigurationOption) (schema, error) {
+	s, err := typeSchema(opt.Type)
+	if err != nil {
+		return nil, fmt.Errorf("option %s: %w", opt.Name, err)
+	}
+	if desc := normalizeDescription(opt.Description); desc != "" {
+		s["description"] = desc
+	}
+	if opt.Default != nil {
+		s["default"] = opt.Default
+	}
+	return s, nil
+}
+
+// typeSchema returns the schema for a type used in processors.yml.
+func typeSchema(typ string) (schema, error) {
+	switch typ {
+	case "string":
+		return schema{"type": "string"}, nil
+	case "bool":
+		return schema{"type": "boolean"}, nil
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+		return schema{"type": "integer"}, nil
+	case "float32", "float64":
+		return schema{"type": "number"}, nil
+	case "[]string":
+		return schema{"type": "array", "items": schema{"type": "string"}}, nil
+	case "map[string]interface{}":
+		return schema{"type": "object"}, nil
+	case "processor":
+		return ref("processor"), nil
+	case "github.com/andrewkroh/go-sawmill/pkg/config.EventValue":
+		// Any JSON value.
+		return schema{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %q", typ)
+	}
+}
+
+func ref(definition string) schema {
+	return schema{"$ref": "#/definitions/" + definition}
+}
+
+// withDescription adds a description to s. Draft-07 ignores keywords that are
+// siblings of $ref so the reference is wrapped with allOf.
+func withDescription(s schema, desc string) schema {
+	return schema{
+		"description": desc,
+		"allOf":       []schema{s},
+	}
+}
+
+// normalizeDescription joins the lines of a description into a single line.
+func normalizeDescription(desc string) string {
+	return strings.Join(strings.Fields(desc), " ")
+}
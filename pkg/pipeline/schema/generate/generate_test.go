@@ -0,0 +1,46 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrewkroh/go-sawmill/internal/proctemplate"
+)
+
+func TestGenerateUpToDate(t *testing.T) {
+	p, err := proctemplate.ReadProcessorsYAMLFile("../../../processor/processors.yml")
+	require.NoError(t, err)
+
+	generated, err := generate(p)
+	require.NoError(t, err)
+
+	existing, err := os.ReadFile("../pipeline.schema.json")
+	require.NoError(t, err)
+
+	assert.Equal(t, string(existing), string(generated), "pipeline.schema.json is out of date, run 'make generate'")
+}
+
+func TestTypeSchemaUnsupported(t *testing.T) {
+	_, err := typeSchema("chan int")
+	assert.Error(t, err)
+}
@@ -0,0 +1,34 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package schema contains the JSON Schema for pipeline definitions. Editors
+// can use it to provide completion and validation for pipeline YAML files.
+package schema
+
+import _ "embed"
+
+//go:generate go run ./generate/generate.go -p ../../processor/processors.yml -o pipeline.schema.json
+
+//go:embed pipeline.schema.json
+var pipelineSchema []byte
+
+// JSON returns the JSON Schema (draft-07) for pipeline definitions.
+func JSON() []byte {
+	b := make([]byte, len(pipelineSchema))
+	copy(b, pipelineSchema)
+	return b
+}
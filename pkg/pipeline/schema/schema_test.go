@@ -0,0 +1,200 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/andrewkroh/go-sawmill/pkg/processor/registry"
+
+	// Register processors:
+	_ "github.com/andrewkroh/go-sawmill/pkg/processor/append"
+	_ "github.com/andrewkroh/go-sawmill/pkg/processor/community_id"
+	_ "github.com/andrewkroh/go-sawmill/pkg/processor/drop"
+	_ "github.com/andrewkroh/go-sawmill/pkg/processor/lowercase"
+	_ "github.com/andrewkroh/go-sawmill/pkg/processor/remove"
+	_ "github.com/andrewkroh/go-sawmill/pkg/processor/set"
+	_ "github.com/andrewkroh/go-sawmill/pkg/processor/uppercase"
+)
+
+func compileSchema(t *testing.T) *jsonschema.Schema {
+	t.Helper()
+
+	c := jsonschema.NewCompiler()
+	c.Draft = jsonschema.Draft7
+	require.NoError(t, c.AddResource("pipeline.schema.json", bytes.NewReader(JSON())))
+	s, err := c.Compile("pipeline.schema.json")
+	require.NoError(t, err)
+	return s
+}
+
+func loadYAML(t *testing.T, data string) interface{} {
+	t.Helper()
+
+	var v interface{}
+	require.NoError(t, yaml.Unmarshal([]byte(data), &v))
+	return v
+}
+
+func TestSchemaProcessors(t *testing.T) {
+	var s struct {
+		Definitions struct {
+			Processor struct {
+				Properties map[string]interface{} `json:"properties"`
+			} `json:"processor"`
+		} `json:"definitions"`
+	}
+	require.NoError(t, json.Unmarshal(JSON(), &s))
+
+	var inSchema []string
+	for name := range s.Definitions.Processor.Properties {
+		inSchema = append(inSchema, name)
+	}
+	sort.Strings(inSchema)
+
+	expected := append(registry.Names(), "foreach", "pipeline")
+	sort.Strings(expected)
+
+	assert.Equal(t, expected, inSchema)
+}
+
+func TestSchemaTestdata(t *testing.T) {
+	s := compileSchema(t)
+
+	files, err := filepath.Glob("../testdata/*.pipeline.yml")
+	require.NoError(t, err)
+	more, err := filepath.Glob("../pipelinetest/testdata/*.pipeline.yml")
+	require.NoError(t, err)
+	files = append(files, more...)
+	require.NotEmpty(t, files)
+
+	for _, f := range files {
+		f := f
+		t.Run(filepath.Base(f), func(t *testing.T) {
+			if filepath.Base(f) == "global-on-failure.pipeline.yml" {
+				t.Skip("uses the fail processor that is only registered by tests")
+			}
+
+			data, err := os.ReadFile(f)
+			require.NoError(t, err)
+			assert.NoError(t, s.Validate(loadYAML(t, string(data))))
+		})
+	}
+}
+
+func TestSchemaInvalid(t *testing.T) {
+	s := compileSchema(t)
+
+	testCases := map[string]string{
+		"missing id": `
+processors:
+  - drop:
+`,
+		"unknown pipeline option": `
+id: test
+processor: []
+`,
+		"unknown processor": `
+id: test
+processors:
+  - lowercse:
+      field: message
+`,
+		"multiple processor types": `
+id: test
+processors:
+  - lowercase:
+      field: message
+    uppercase:
+      field: message
+`,
+		"unknown option": `
+id: test
+processors:
+  - lowercase:
+      fields: message
+`,
+		"missing required option": `
+id: test
+processors:
+  - lowercase:
+      target_field: message
+`,
+		"wrong option type": `
+id: test
+processors:
+  - lowercase:
+      field: message
+      ignore_missing: "yes"
+`,
+		"invalid timeout": `
+id: test
+processors:
+  - drop:
+      timeout: 5 seconds
+`,
+		"invalid foreach processor": `
+id: test
+processors:
+  - foreach:
+      field: tags
+      processor:
+        uppercase:
+          fields: _ingest._value
+`,
+		"invalid on_failure processor": `
+id: test
+processors:
+  - drop:
+on_failure:
+  - lowercase:
+      target_field: message
+`,
+		"include with options": `
+id: test
+processors:
+  - include: common.yml
+    if: event.kind == "alert"
+`,
+		"include in foreach": `
+id: test
+processors:
+  - foreach:
+      field: tags
+      processor:
+        include: common.yml
+`,
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, s.Validate(loadYAML(t, tc)))
+		})
+	}
+}
@@ -0,0 +1,177 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Set is a collection of pipelines keyed by their ID. Pipelines within a Set
+// can execute each other by using the pipeline processor. A Set is immutable
+// once constructed.
+type Set struct {
+	pipelines map[string]*Pipeline
+}
+
+// NewSet constructs a pipeline for each config and returns them as a Set.
+// References between pipelines made by pipeline processors are resolved
+// and an error is returned if a referenced pipeline does not exist (unless
+// ignore_missing_pipeline is set) or if the references form a cycle.
+func NewSet(configs ...*Config) (*Set, error) {
+	set := &Set{pipelines: make(map[string]*Pipeline, len(configs))}
+	for _, config := range configs {
+		pipe, err := newPipeline(config)
+		if err != nil {
+			set.Close()
+			return nil, err
+		}
+
+		if _, found := set.pipelines[pipe.ID()]; found {
+			pipe.Close()
+			set.Close()
+			return nil, fmt.Errorf("duplicate pipeline ID <%s>", pipe.ID())
+		}
+		set.pipelines[pipe.ID()] = pipe
+	}
+
+	if err := linkPipelines(set.pipelines); err != nil {
+		set.Close()
+		return nil, err
+	}
+
+	return set, nil
+}
+
+// Get returns the pipeline with the given ID. It returns nil if the pipeline
+// does not exist.
+func (s *Set) Get(id string) *Pipeline {
+	return s.pipelines[id]
+}
+
+// IDs returns the sorted IDs of all pipelines in the Set.
+func (s *Set) IDs() []string {
+	ids := make([]string, 0, len(s.pipelines))
+	for id := range s.pipelines {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Metrics returns the metrics of all pipelines in the Set.
+func (s *Set) Metrics() []prometheus.Collector {
+	var metrics []prometheus.Collector
+	for _, id := range s.IDs() {
+		metrics = append(metrics, s.pipelines[id].Metrics()...)
+	}
+	return metrics
+}
+
+// Close closes all pipelines in the Set. It returns the first error that
+// occurred.
+func (s *Set) Close() error {
+	var firstErr error
+	for _, id := range s.IDs() {
+		if err := s.pipelines[id].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// linkPipelines resolves the targets of all pipeline processors and checks
+// that the references between pipelines do not contain cycles.
+func linkPipelines(pipelines map[string]*Pipeline) error {
+	// Adjacency list of pipeline ID to referenced pipeline IDs.
+	refs := make(map[string][]string, len(pipelines))
+
+	for _, pipe := range pipelines {
+		var err error
+		pipe.visitProcessors(func(proc *pipelineProcessor) {
+			ref, ok := proc.proc.(*pipelineRefProcessor)
+			if !ok || err != nil {
+				return
+			}
+
+			ref.target = pipelines[ref.config.Name]
+			if ref.target == nil {
+				if !ref.config.IgnoreMissingPipeline {
+					err = fmt.Errorf("processor with ID %s references pipeline <%s> that does not exist",
+						proc.ID, ref.config.Name)
+				}
+				return
+			}
+			refs[pipe.ID()] = append(refs[pipe.ID()], ref.config.Name)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return detectCycles(refs)
+}
+
+// detectCycles returns an error describing the first cycle found in the
+// graph of pipeline references.
+func detectCycles(refs map[string][]string) error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(refs))
+
+	var path []string
+	var visit func(id string) error
+	visit = func(id string) error {
+		switch state[id] {
+		case visiting:
+			return fmt.Errorf("pipeline reference cycle detected: %s -> %s", strings.Join(path, " -> "), id)
+		case visited:
+			return nil
+		}
+
+		state[id] = visiting
+		path = append(path, id)
+		for _, ref := range refs[id] {
+			if err := visit(ref); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[id] = visited
+		return nil
+	}
+
+	// Visit in sorted order so that errors are deterministic.
+	ids := make([]string, 0, len(refs))
+	for id := range refs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err := visit(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func callPipelineConfig(id string, calls ...string) *Config {
+	c := &Config{
+		ID: id,
+		Processors: []ProcessorConfig{
+			{
+				"append": &ProcessorOptionConfig{
+					Config: map[string]interface{}{
+						"field": "path",
+						"value": id,
+					},
+				},
+			},
+		},
+	}
+	for _, name := range calls {
+		c.Processors = append(c.Processors, ProcessorConfig{
+			"pipeline": &ProcessorOptionConfig{
+				Config: map[string]interface{}{
+					"name": name,
+				},
+			},
+		})
+	}
+	return c
+}
+
+func TestSet(t *testing.T) {
+	t.Run("nested pipelines", func(t *testing.T) {
+		set, err := NewSet(
+			callPipelineConfig("a", "b", "c"),
+			callPipelineConfig("b", "c"),
+			callPipelineConfig("c"),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b", "c"}, set.IDs())
+
+		evt, err := set.Get("a").Process(newTestEvent())
+		require.NoError(t, err)
+
+		path := evt.Get("path")
+		require.NotNil(t, path)
+		var names []string
+		for _, v := range path.Array {
+			names = append(names, v.String)
+		}
+		assert.Equal(t, []string{"a", "b", "c", "c"}, names)
+	})
+
+	t.Run("missing pipeline", func(t *testing.T) {
+		_, err := NewSet(callPipelineConfig("a", "missing"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "missing")
+	})
+
+	t.Run("ignore missing pipeline", func(t *testing.T) {
+		c := callPipelineConfig("a", "missing")
+		c.Processors[1]["pipeline"].Config["ignore_missing_pipeline"] = true
+
+		set, err := NewSet(c)
+		require.NoError(t, err)
+
+		_, err = set.Get("a").Process(newTestEvent())
+		require.NoError(t, err)
+	})
+
+	t.Run("duplicate ID", func(t *testing.T) {
+		_, err := NewSet(callPipelineConfig("a"), callPipelineConfig("a"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "duplicate")
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		_, err := NewSet(
+			callPipelineConfig("a", "b"),
+			callPipelineConfig("b", "c"),
+			callPipelineConfig("c", "a"),
+		)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "a -> b -> c -> a")
+	})
+
+	t.Run("self reference", func(t *testing.T) {
+		_, err := New(callPipelineConfig("a", "a"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "cycle")
+	})
+
+	t.Run("max depth", func(t *testing.T) {
+		var configs []*Config
+		for i := 0; i <= maxPipelineDepth; i++ {
+			configs = append(configs, callPipelineConfig(strconv.Itoa(i), strconv.Itoa(i+1)))
+		}
+		configs = append(configs, callPipelineConfig(strconv.Itoa(maxPipelineDepth+1)))
+
+		set, err := NewSet(configs...)
+		require.NoError(t, err)
+
+		_, err = set.Get("0").Process(newTestEvent())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "maximum pipeline nesting depth")
+
+		var procErr *ProcessorError
+		require.ErrorAs(t, err, &procErr)
+		assert.Equal(t, strconv.Itoa(maxPipelineDepth), procErr.PipelineID)
+	})
+}
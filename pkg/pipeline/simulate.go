@@ -0,0 +1,198 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+)
+
+// ProcessorStatus is the outcome of a processor's execution in a simulation.
+type ProcessorStatus string
+
+const (
+	StatusSuccess      ProcessorStatus = "success"       // Processor succeeded.
+	StatusError        ProcessorStatus = "error"         // Processor failed. Any on_failure processors follow it in the results.
+	StatusErrorIgnored ProcessorStatus = "error_ignored" // Processor failed but the error was ignored (ignore_failure or ignore_missing).
+	StatusDropped      ProcessorStatus = "dropped"       // Processor dropped the event.
+	StatusSkipped      ProcessorStatus = "skipped"       // Processor did not run because its condition was false.
+)
+
+// ProcessorResult describes the execution of a single processor during a
+// simulation.
+type ProcessorResult struct {
+	PipelineID    string          `json:"pipeline_id"`
+	ProcessorID   string          `json:"processor_id"`
+	ProcessorType string          `json:"processor_type"`
+	Tag           string          `json:"tag,omitempty"`
+	Status        ProcessorStatus `json:"status"`
+	Err           error           `json:"-"`
+	Elapsed       time.Duration   `json:"elapsed_ns"`
+	Changes       []event.Change  `json:"changes,omitempty"` // Changes made to the event by the processor.
+}
+
+func (r ProcessorResult) MarshalJSON() ([]byte, error) {
+	type processorResult ProcessorResult
+	return marshalJSON(struct {
+		processorResult
+		Error string `json:"error,omitempty"`
+	}{processorResult(r), errorString(r.Err)})
+}
+
+// SimulateResult is the result of simulating the processing of an event.
+type SimulateResult struct {
+	Event            *event.Event      `json:"event,omitempty"` // Output event. Nil if it was dropped or processing failed.
+	Dropped          bool              `json:"dropped,omitempty"`
+	Err              error             `json:"-"`
+	ProcessorResults []ProcessorResult `json:"processor_results"` // Executed processors in order of execution.
+}
+
+func (r SimulateResult) MarshalJSON() ([]byte, error) {
+	type simulateResult SimulateResult
+	return marshalJSON(struct {
+		simulateResult
+		Error string `json:"error,omitempty"`
+	}{simulateResult(r), errorString(r.Err)})
+}
+
+// marshalJSON is like json.Marshal, but it does not escape HTML characters.
+func marshalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// Simulate processes the event like Process while recording the execution of
+// each processor, including on_failure processors and the processors of any
+// pipelines that are called. Recording the changes made by each processor is
+// expensive so this is intended for debugging pipelines.
+func (pipe *Pipeline) Simulate(evt *event.Event) *SimulateResult {
+	return pipe.SimulateContext(context.Background(), evt)
+}
+
+// SimulateContext is like Simulate, but processing stops when the context is
+// done. See ProcessContext.
+func (pipe *Pipeline) SimulateContext(ctx context.Context, evt *event.Event) *SimulateResult {
+	pipeEvt := &pipelineEvent{data: evt, ctx: ctx, trace: &trace{}}
+
+	result := &SimulateResult{}
+	if err := pipe.process(pipeEvt); err != nil {
+		result.Err = err
+	} else if pipeEvt.dropped {
+		result.Dropped = true
+	} else {
+		result.Event = pipeEvt.data
+	}
+	result.ProcessorResults = pipeEvt.trace.results
+
+	return result
+}
+
+// trace records the execution of processors during a simulation.
+type trace struct {
+	results []ProcessorResult
+}
+
+// begin records the start of a processor's execution. It returns nil if t is
+// nil (i.e. not simulating).
+func (t *trace) begin(p *pipelineProcessor, evt *event.Event) *traceSpan {
+	if t == nil {
+		return nil
+	}
+
+	t.results = append(t.results, ProcessorResult{
+		PipelineID:    p.PipelineID,
+		ProcessorID:   p.ID,
+		ProcessorType: p.Type,
+		Tag:           p.Tag,
+	})
+	return &traceSpan{
+		trace:  t,
+		index:  len(t.results) - 1,
+		before: evt.Clone(),
+		start:  time.Now(),
+	}
+}
+
+// skipped records that processor p was not executed because its condition
+// was false.
+func (t *trace) skipped(p *pipelineProcessor) {
+	if t == nil {
+		return
+	}
+
+	t.results = append(t.results, ProcessorResult{
+		PipelineID:    p.PipelineID,
+		ProcessorID:   p.ID,
+		ProcessorType: p.Type,
+		Tag:           p.Tag,
+		Status:        StatusSkipped,
+	})
+}
+
+// traceSpan records the outcome of a single processor execution. Results are
+// referenced by index because nested processors append to the results.
+type traceSpan struct {
+	trace  *trace
+	index  int
+	before *event.Event
+	start  time.Time
+}
+
+// end records the outcome of running the processor.
+func (s *traceSpan) end(evt *pipelineEvent, err error) {
+	if s == nil {
+		return
+	}
+
+	r := &s.trace.results[s.index]
+	r.Elapsed = time.Since(s.start)
+	r.Changes = event.Diff(s.before, evt.data)
+	switch {
+	case evt.dropped:
+		r.Status = StatusDropped
+	case err != nil:
+		r.Status = StatusError
+		r.Err = err
+	default:
+		r.Status = StatusSuccess
+	}
+}
+
+// ignored records that the processor's error was ignored.
+func (s *traceSpan) ignored() {
+	if s == nil {
+		return
+	}
+	s.trace.results[s.index].Status = StatusErrorIgnored
+}
@@ -0,0 +1,219 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+)
+
+const simulatePipelineYAML = `
+id: a
+processors:
+  - set:
+      id: set-kind
+      tag: kind
+      target_field: event.kind
+      value: event
+  - fail:
+      on_failure:
+        - append:
+            field: path
+            value: recovered
+  - lowercase:
+      field: missing
+      ignore_missing: true
+  - pipeline:
+      name: b
+`
+
+func simulateSet(t *testing.T) *Set {
+	t.Helper()
+
+	var a *Config
+	require.NoError(t, yaml.Unmarshal([]byte(simulatePipelineYAML), &a))
+
+	set, err := NewSet(a, callPipelineConfig("b"))
+	require.NoError(t, err)
+	t.Cleanup(func() { set.Close() })
+	return set
+}
+
+func TestSimulate(t *testing.T) {
+	set := simulateSet(t)
+
+	result := set.Get("a").Simulate(newTestEvent())
+	require.NoError(t, result.Err)
+	require.NotNil(t, result.Event)
+	assert.False(t, result.Dropped)
+	assert.Equal(t, "event", result.Event.Get("event.kind").String)
+
+	type step struct {
+		PipelineID, ProcessorID string
+		Status                  ProcessorStatus
+	}
+	var steps []step
+	for _, r := range result.ProcessorResults {
+		steps = append(steps, step{r.PipelineID, r.ProcessorID, r.Status})
+	}
+	assert.Equal(t, []step{
+		{"a", "set-kind", StatusSuccess},
+		{"a", "a.processors[1].fail", StatusError},
+		{"a", "a.processors[1].fail.on_failure[0].append", StatusSuccess},
+		{"a", "a.processors[2].lowercase", StatusErrorIgnored},
+		{"a", "a.processors[3].pipeline", StatusSuccess},
+		{"b", "b.processors[0].append", StatusSuccess},
+	}, steps)
+
+	setKind := result.ProcessorResults[0]
+	assert.Equal(t, "kind", setKind.Tag)
+	assert.Equal(t, "set", setKind.ProcessorType)
+	assert.Equal(t, []event.Change{{
+		Op:  event.ChangeAdd,
+		Key: "event",
+		New: event.Object(map[string]*event.Value{"kind": event.String("event")}),
+	}}, setKind.Changes)
+
+	fail := result.ProcessorResults[1]
+	assert.EqualError(t, fail.Err, "fail processor failed")
+	assert.Empty(t, fail.Changes)
+
+	// The pipeline processor's changes include those of the called pipeline.
+	assert.Equal(t, []event.Change{{
+		Op:  event.ChangeReplace,
+		Key: "path",
+		Old: event.Array(event.String("recovered")),
+		New: event.Array(event.String("recovered"), event.String("b")),
+	}}, result.ProcessorResults[4].Changes)
+}
+
+func TestSimulateError(t *testing.T) {
+	c := callPipelineConfig("a")
+	c.Processors = append(c.Processors, ProcessorConfig{"fail": &ProcessorOptionConfig{ID: "boom"}})
+
+	pipe, err := New(c)
+	require.NoError(t, err)
+	defer pipe.Close()
+
+	result := pipe.Simulate(newTestEvent())
+	require.Error(t, result.Err)
+	assert.Nil(t, result.Event)
+	require.Len(t, result.ProcessorResults, 2)
+	assert.Equal(t, StatusError, result.ProcessorResults[1].Status)
+
+	data, err := json.Marshal(result)
+	require.NoError(t, err)
+
+	var out map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &out))
+	assert.Equal(t, result.Err.Error(), out["error"])
+	assert.NotContains(t, out, "event")
+
+	procResults := out["processor_results"].([]interface{})
+	require.Len(t, procResults, 2)
+	assert.Equal(t, map[string]interface{}{
+		"pipeline_id":    "a",
+		"processor_id":   "boom",
+		"processor_type": "fail",
+		"status":         "error",
+		"error":          "fail processor failed",
+		"elapsed_ns":     procResults[1].(map[string]interface{})["elapsed_ns"],
+	}, procResults[1])
+}
+
+func TestSimulateMatchesProcess(t *testing.T) {
+	set := simulateSet(t)
+
+	processed, err := set.Get("a").Process(newTestEvent())
+	require.NoError(t, err)
+
+	result := set.Get("a").Simulate(newTestEvent())
+	require.NoError(t, result.Err)
+	assert.Empty(t, event.Diff(processed, result.Event))
+}
+
+func TestSimulateConditions(t *testing.T) {
+	var c *Config
+	require.NoError(t, yaml.Unmarshal([]byte(`
+id: conditions
+processors:
+  - set:
+      if: vehicle.vin == "0000"
+      target_field: skipped
+      value: true
+  - drop:
+      if: vehicle.vin == "1234"
+  - set:
+      target_field: not_executed
+      value: true
+`), &c))
+
+	pipe, err := New(c)
+	require.NoError(t, err)
+	defer pipe.Close()
+
+	result := pipe.Simulate(newTestEvent())
+	require.NoError(t, result.Err)
+	assert.True(t, result.Dropped)
+	assert.Nil(t, result.Event)
+
+	require.Len(t, result.ProcessorResults, 2)
+	assert.Equal(t, StatusSkipped, result.ProcessorResults[0].Status)
+	assert.Equal(t, StatusDropped, result.ProcessorResults[1].Status)
+}
+
+func TestSimulateChangesAreNotModified(t *testing.T) {
+	var c *Config
+	require.NoError(t, yaml.Unmarshal([]byte(`
+id: appends
+processors:
+  - append:
+      field: tags
+      value: a
+  - append:
+      field: tags
+      value: b
+`), &c))
+
+	pipe, err := New(c)
+	require.NoError(t, err)
+	defer pipe.Close()
+
+	result := pipe.Simulate(newTestEvent())
+	require.NoError(t, result.Err)
+	require.Len(t, result.ProcessorResults, 2)
+
+	// The second append must not modify the changes of the first.
+	assert.Equal(t, []event.Change{{
+		Op:  event.ChangeAdd,
+		Key: "tags",
+		New: event.Array(event.String("a")),
+	}}, result.ProcessorResults[0].Changes)
+	assert.Equal(t, []event.Change{{
+		Op:  event.ChangeReplace,
+		Key: "tags",
+		Old: event.Array(event.String("a")),
+		New: event.Array(event.String("a"), event.String("b")),
+	}}, result.ProcessorResults[1].Changes)
+}
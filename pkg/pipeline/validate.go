@@ -0,0 +1,474 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/andrewkroh/go-sawmill/pkg/condition"
+	"github.com/andrewkroh/go-sawmill/pkg/processor/registry"
+)
+
+// commonProcessorOptions are accepted by every processor.
+var commonProcessorOptions = []string{"description", "id", "if", "on_failure", "tag", "timeout"}
+
+// pipelineOptions are the keys accepted at the top-level of a pipeline.
+var pipelineOptions = []string{"description", "id", "on_failure", "processors", "timeout"}
+
+// ValidationError describes a single problem found in a pipeline
+// configuration.
+type ValidationError struct {
+	Path    string // Location of the problem (e.g. processors[1].lowercase.field).
+	File    string // Included file that contains the problem. Empty if it is in the validated source.
+	Line    int    // Line in the YAML source (1-based). Zero if unknown.
+	Column  int    // Column in the YAML source (1-based). Zero if unknown.
+	Message string // Description of the problem.
+}
+
+func (e *ValidationError) Error() string {
+	var sb strings.Builder
+	if e.File != "" {
+		sb.WriteString(e.File)
+		sb.WriteString(": ")
+	}
+	if e.Line > 0 {
+		fmt.Fprintf(&sb, "line %d, column %d: ", e.Line, e.Column)
+	}
+	if e.Path != "" {
+		sb.WriteString(e.Path)
+		sb.WriteString(": ")
+	}
+	sb.WriteString(e.Message)
+	return sb.String()
+}
+
+// ValidationErrors contains all problems found in a pipeline configuration.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Validate checks the config for problems without constructing the
+// pipeline. It reports all problems that are found including unknown
+// processors, unknown or missing options, invalid option values, invalid if
+// conditions and timeouts, duplicate processor IDs, and processors that are
+// unreachable because they follow an unconditional drop processor. References
+// to other pipelines are not checked. It returns nil if no problems are found.
+func Validate(config *Config) ValidationErrors {
+	v := &validator{ids: map[string]string{}}
+	v.validatePipeline(config)
+	return v.result()
+}
+
+// ValidateYAML parses a YAML (or JSON) pipeline definition and validates it
+// like Validate. Variables and includes are resolved like LoadConfig with the
+// default options. The returned problems include their line and column in the
+// source and are ordered by position. Problems in included files also include
+// the file. Unknown top-level keys are also reported. An error is returned if
+// the data cannot be parsed or an include cannot be resolved.
+func ValidateYAML(data []byte) (ValidationErrors, error) {
+	return validateYAML(data, &includer{}, "")
+}
+
+// ValidateFile reads a YAML (or JSON) pipeline definition from a file and
+// validates it like ValidateYAML. Includes are resolved relative to the file.
+func ValidateFile(path string) (ValidationErrors, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	return validateYAML(data, &includer{stack: []string{abs}}, filepath.Dir(path))
+}
+
+func validateYAML(data []byte, inc *includer, dir string) (ValidationErrors, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	if len(root.Content) == 0 {
+		return nil, errors.New("pipeline definition is empty")
+	}
+	if err := inc.substituteNode(&root); err != nil {
+		return nil, err
+	}
+	if err := inc.expandPipeline(root.Content[0], dir); err != nil {
+		return nil, err
+	}
+
+	var config *Config
+	if err := root.Decode(&config); err != nil {
+		return nil, err
+	}
+
+	v := &validator{ids: map[string]string{}}
+	if doc := root.Content[0]; doc.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(doc.Content); i += 2 {
+			if key := doc.Content[i].Value; !containsString(pipelineOptions, key) {
+				v.addf(configPath{key}, "unknown pipeline option %q%s", key, suggest(key, pipelineOptions))
+			}
+		}
+	}
+	v.validatePipeline(config)
+
+	for _, err := range v.errs {
+		if n := nodeAt(&root, err.path); n != nil {
+			err.Line, err.Column = n.Line, n.Column
+		}
+		err.File = includedFrom(&root, err.path, inc.origins)
+	}
+	sort.SliceStable(v.errs, func(i, j int) bool {
+		a, b := v.errs[i], v.errs[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	return v.result(), nil
+}
+
+// configPath identifies a location within a pipeline config. Each element is
+// a mapping key (string) or a sequence index (int).
+type configPath []interface{}
+
+func (p configPath) key(k string) configPath {
+	return append(p[:len(p):len(p)], k)
+}
+
+func (p configPath) index(i int) configPath {
+	return append(p[:len(p):len(p)], i)
+}
+
+func (p configPath) String() string {
+	var sb strings.Builder
+	for _, elem := range p {
+		switch v := elem.(type) {
+		case string:
+			if sb.Len() > 0 {
+				sb.WriteByte('.')
+			}
+			sb.WriteString(v)
+		case int:
+			sb.WriteByte('[')
+			sb.WriteString(strconv.Itoa(v))
+			sb.WriteByte(']')
+		}
+	}
+	return sb.String()
+}
+
+// nodeAt returns the YAML node identified by the path. When the path ends
+// with a mapping key then the key node is returned. If the path does not
+// exist then the deepest node found is returned.
+func nodeAt(root *yaml.Node, p configPath) *yaml.Node {
+	n := root
+	if n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+
+	for i, elem := range p {
+		if n.Kind == yaml.AliasNode && n.Alias != nil {
+			n = n.Alias
+		}
+
+		switch v := elem.(type) {
+		case string:
+			if n.Kind != yaml.MappingNode {
+				return n
+			}
+			var next *yaml.Node
+			for j := 0; j+1 < len(n.Content); j += 2 {
+				if n.Content[j].Value == v {
+					if i == len(p)-1 {
+						return n.Content[j]
+					}
+					next = n.Content[j+1]
+					break
+				}
+			}
+			if next == nil {
+				return n
+			}
+			n = next
+		case int:
+			if n.Kind != yaml.SequenceNode || v >= len(n.Content) {
+				return n
+			}
+			n = n.Content[v]
+		}
+	}
+	return n
+}
+
+// includedFrom returns the file that the innermost included processor
+// containing the path came from. It returns an empty string if the path is
+// not within an included processor.
+func includedFrom(root *yaml.Node, p configPath, origins map[*yaml.Node]string) string {
+	for i := len(p); i > 0; i-- {
+		if _, isIndex := p[i-1].(int); !isIndex {
+			continue
+		}
+		if file, found := origins[nodeAt(root, p[:i])]; found {
+			return file
+		}
+	}
+	return ""
+}
+
+type pathError struct {
+	ValidationError
+	path configPath
+}
+
+type validator struct {
+	errs []*pathError
+	ids  map[string]string // Processor ID to the path where it was first used.
+}
+
+func (v *validator) addf(p configPath, format string, args ...interface{}) {
+	v.errs = append(v.errs, &pathError{
+		ValidationError: ValidationError{Path: p.String(), Message: fmt.Sprintf(format, args...)},
+		path:            p,
+	})
+}
+
+// result returns the problems that were found or nil if there are none.
+func (v *validator) result() ValidationErrors {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	errs := make(ValidationErrors, len(v.errs))
+	for i, err := range v.errs {
+		errs[i] = &err.ValidationError
+	}
+	return errs
+}
+
+func (v *validator) validatePipeline(config *Config) {
+	if config == nil {
+		v.addf(nil, "pipeline definition is empty")
+		return
+	}
+
+	if config.ID == "" {
+		v.addf(configPath{"id"}, "pipeline must have a non-empty id")
+	}
+	if _, err := parseTimeout(config.Timeout); err != nil {
+		v.addf(configPath{"timeout"}, "invalid timeout: %v", err)
+	}
+
+	v.validateProcessors(configPath{"processors"}, config.Processors)
+	v.validateProcessors(configPath{"on_failure"}, config.OnFailure)
+}
+
+func (v *validator) validateProcessors(p configPath, procConfigs []ProcessorConfig) {
+	var dropPath configPath
+	for i, procConfig := range procConfigs {
+		procPath := p.index(i)
+		if dropPath != nil {
+			v.addf(procPath, "processor is unreachable because the event is always dropped by %s", dropPath)
+		}
+
+		procType, options := v.validateProcessorConfig(procPath, procConfig)
+		if dropPath == nil && procType == "drop" && options.If == "" {
+			dropPath = procPath.key(procType)
+		}
+	}
+}
+
+// validateProcessorConfig validates a single processor. It returns the
+// processor's type and options if they could be determined.
+func (v *validator) validateProcessorConfig(p configPath, procConfig ProcessorConfig) (string, *ProcessorOptionConfig) {
+	procType, options, err := procConfig.getProcessor()
+	if err != nil {
+		v.addf(p, "%v", err)
+		return "", &ProcessorOptionConfig{}
+	}
+	p = p.key(procType)
+
+	if options.ID != "" {
+		if first, found := v.ids[options.ID]; found {
+			v.addf(p.key("id"), "duplicate processor id %q (first used by %s)", options.ID, first)
+		} else {
+			v.ids[options.ID] = p.String()
+		}
+	}
+	if options.If != "" {
+		if _, err := condition.Parse(string(options.If)); err != nil {
+			var syntaxErr *condition.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				v.addf(p.key("if"), "invalid if condition: %s at offset %d", syntaxErr.Msg, syntaxErr.Offset)
+			} else {
+				v.addf(p.key("if"), "invalid if condition: %v", err)
+			}
+		}
+	}
+	if _, err := parseTimeout(options.Timeout); err != nil {
+		v.addf(p.key("timeout"), "invalid timeout: %v", err)
+	}
+
+	v.validateOptions(p, procType, options.Config)
+
+	if procType == foreachProcessorName {
+		if raw := options.Config["processor"]; raw != nil {
+			nested, err := rawProcessorConfig(raw)
+			if err != nil {
+				v.addf(p.key("processor"), "invalid processor: %v", err)
+			} else {
+				v.validateProcessorConfig(p.key("processor"), nested)
+			}
+		}
+	}
+
+	v.validateProcessors(p.key("on_failure"), options.OnFailure)
+	return procType, options
+}
+
+// validateOptions checks the processor type and its options.
+func (v *validator) validateOptions(p configPath, procType string, config map[string]interface{}) {
+	options, found := processorOptions(procType)
+	if !found {
+		v.addf(p, "unknown processor type %q%s", procType, suggest(procType, processorTypes()))
+		return
+	}
+
+	names := append([]string(nil), commonProcessorOptions...)
+	for _, opt := range options {
+		names = append(names, opt.Name)
+	}
+
+	keys := make([]string, 0, len(config))
+	for k := range config {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	valid := true
+	for _, k := range keys {
+		if !containsString(names, k) {
+			valid = false
+			v.addf(p.key(k), "unknown option %q for processor type %s%s", k, procType, suggest(k, names))
+		}
+	}
+	for _, opt := range options {
+		if opt.Required && config[opt.Name] == nil {
+			valid = false
+			v.addf(p, "missing required option %q for processor type %s", opt.Name, procType)
+		}
+	}
+
+	// Check the option values only when the options are otherwise valid
+	// because the errors from unpacking are less specific.
+	if _, builtin := builtinProcessors[procType]; valid && !builtin {
+		if err := registry.CheckConfig(procType, config); err != nil {
+			v.addf(p, "invalid options for processor type %s: %v", procType, err)
+		}
+	}
+}
+
+// rawProcessorConfig converts an untyped processor definition (e.g. the
+// foreach processor option) into a ProcessorConfig.
+func rawProcessorConfig(raw interface{}) (ProcessorConfig, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var procConfig ProcessorConfig
+	if err = json.Unmarshal(data, &procConfig); err != nil {
+		return nil, err
+	}
+	return procConfig, nil
+}
+
+// suggest returns a " (did you mean ...?)" suffix containing the candidate
+// most similar to name. It returns an empty string if no candidate is
+// similar enough.
+func suggest(name string, candidates []string) string {
+	best, bestDistance := "", -1
+	for _, c := range candidates {
+		d := levenshtein(name, c)
+		if bestDistance < 0 || d < bestDistance {
+			best, bestDistance = c, d
+		}
+	}
+	// Require that at most two edits, and no more than half of the name,
+	// differ so that short unrelated names are not matched.
+	if bestDistance < 0 || bestDistance > 2 || bestDistance > len(name)/2 {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean %q?)", best)
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, minInt(curr[j-1]+1, prev[j-1]+cost))
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const invalidPipelineYAML = `id: test
+timout: 5s
+processors:
+  - lowercse:
+      field: a
+  - lowercase:
+      feild: message
+      id: lower
+  - set:
+      id: lower
+      target_field: x
+      value: 1
+      if: a ==
+  - uppercase:
+      field: [a, b]
+  - set:
+      target_field: y
+      value: 1
+      timeout: -1s
+  - foreach:
+      field: list
+      processor:
+        uppercase:
+          target_field: y
+  - drop: {}
+  - set:
+      target_field: z
+      value: 1
+on_failure:
+  - drop:
+      if: a == 1
+  - set: {}
+    append: {}
+`
+
+func TestValidateYAML(t *testing.T) {
+	errs, err := ValidateYAML([]byte(invalidPipelineYAML))
+	require.NoError(t, err)
+
+	type problem struct {
+		Line, Column int
+		Path         string
+		Message      string
+	}
+	var problems []problem
+	for _, e := range errs {
+		problems = append(problems, problem{e.Line, e.Column, e.Path, e.Message})
+	}
+
+	assert.Equal(t, []problem{
+		{2, 1, "timout", `unknown pipeline option "timout" (did you mean "timeout"?)`},
+		{4, 5, "processors[0].lowercse", `unknown processor type "lowercse" (did you mean "lowercase"?)`},
+		{6, 5, "processors[1].lowercase", `missing required option "field" for processor type lowercase`},
+		{7, 7, "processors[1].lowercase.feild", `unknown option "feild" for processor type lowercase (did you mean "field"?)`},
+		{10, 7, "processors[2].set.id", `duplicate processor id "lower" (first used by processors[1].lowercase)`},
+		{13, 7, "processors[2].set.if", `invalid if condition: expected a field, literal, or "(" but found end of expression at offset 4`},
+		{14, 5, "processors[3].uppercase", `invalid options for processor type uppercase: can not convert 'object' into 'string' accessing 'field'`},
+		{19, 7, "processors[4].set.timeout", `invalid timeout: timeout must not be negative`},
+		{23, 9, "processors[5].foreach.processor.uppercase", `missing required option "field" for processor type uppercase`},
+		{26, 5, "processors[7]", `processor is unreachable because the event is always dropped by processors[6].drop`},
+		{32, 5, "on_failure[1]", `only one processor must be specified`},
+	}, problems)
+
+	assert.Contains(t, errs.Error(), `line 2, column 1: timout: unknown pipeline option "timout"`)
+}
+
+func TestValidateYAMLErrors(t *testing.T) {
+	_, err := ValidateYAML([]byte(""))
+	assert.Error(t, err)
+
+	_, err = ValidateYAML([]byte("id: [unclosed"))
+	assert.Error(t, err)
+
+	_, err = ValidateYAML([]byte("processors: 1"))
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	assert.Nil(t, Validate(samplePipeline()))
+
+	c := samplePipeline()
+	c.ID = ""
+	c.Processors[0]["set"].Config["ignore_missng"] = true
+
+	errs := Validate(c)
+	require.Len(t, errs, 2)
+	assert.Equal(t, "id: pipeline must have a non-empty id", errs[0].Error())
+	assert.Equal(t, `processors[0].set.ignore_missng: unknown option "ignore_missng" for processor type set (did you mean "ignore_missing"?)`, errs[1].Error())
+	assert.Zero(t, errs[1].Line)
+}
+
+func TestValidateTestdata(t *testing.T) {
+	pipelineFiles, err := filepath.Glob("testdata/*.pipeline.yml")
+	require.NoError(t, err)
+
+	for _, name := range pipelineFiles {
+		errs, err := ValidateFile(name)
+		require.NoError(t, err, name)
+		assert.Empty(t, errs, name)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"field", "target_field", "ignore_missing", "id", "if", "tag"}
+	assert.Equal(t, ` (did you mean "field"?)`, suggest("feild", candidates))
+	assert.Equal(t, ` (did you mean "target_field"?)`, suggest("targetfield", candidates))
+	assert.Equal(t, ` (did you mean "ignore_missing"?)`, suggest("ignore_mising", candidates))
+	assert.Equal(t, "", suggest("value", candidates))
+	assert.Equal(t, "", suggest("on", candidates))
+	assert.Equal(t, "", suggest("source_fields", candidates))
+	assert.Equal(t, "", suggest("field", nil))
+}
@@ -18,8 +18,10 @@
 package processor
 
 import (
+	"context"
 	"encoding/json"
 	"strings"
+	"sync"
 
 	"github.com/andrewkroh/go-sawmill/pkg/event"
 )
@@ -30,6 +32,12 @@ type Event interface {
 	Get(key string) *event.Value
 	Delete(key string) *event.Value
 
+	// Context returns the context for processing the event. It is done when
+	// processing is cancelled or when the processor or pipeline timeout is
+	// exceeded. Processors that may run for a long time should return when
+	// the context is done.
+	Context() context.Context
+
 	// Cancel any further processing by the pipeline for this event.
 	Cancel()
 
@@ -37,17 +45,135 @@ type Event interface {
 	Drop()
 }
 
+// Processor transforms events.
+//
+// A single Processor instance is shared by all goroutines using the pipeline
+// that contains it, so Process may be invoked concurrently and must be safe
+// for concurrent use. Each event is only processed by one goroutine at a
+// time. Processors that keep mutable state (e.g. caches) must synchronize
+// access to it.
 type Processor interface {
 	Process(event Event) error
 }
 
+// Starter is an optional interface implemented by processors that need to
+// acquire resources (e.g. open files or load lookup tables) before processing
+// events. Start is invoked by the registry after the processor is constructed.
+//
+// Processors that hold resources should also implement io.Closer. Close is
+// invoked when the pipeline containing the processor is closed.
+type Starter interface {
+	Start() error
+}
+
+// redactedValue replaces secret values in the output of ConfigString.
+const redactedValue = `"[redacted]"`
+
+var (
+	secretsMu sync.RWMutex
+	secrets   map[string]int // JSON encoded secrets to their number of registrations.
+)
+
+// RegisterSecret registers a value that is redacted from the output of
+// ConfigString. Any string or number in a config that is equal to the secret
+// is replaced by "[redacted]". Each registration must be paired with a call
+// to UnregisterSecret when the config is no longer used.
+func RegisterSecret(secret interface{}) {
+	key, ok := secretKey(secret)
+	if !ok {
+		return
+	}
+
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	if secrets == nil {
+		secrets = map[string]int{}
+	}
+	secrets[key]++
+}
+
+// UnregisterSecret removes a registration made by RegisterSecret. The value
+// is no longer redacted once all of its registrations are removed.
+func UnregisterSecret(secret interface{}) {
+	key, ok := secretKey(secret)
+	if !ok {
+		return
+	}
+
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	if secrets[key] <= 1 {
+		delete(secrets, key)
+		return
+	}
+	secrets[key]--
+}
+
+// secretKey returns the JSON encoding of a secret. Empty strings and values
+// other than strings and numbers are not secrets.
+func secretKey(secret interface{}) (string, bool) {
+	switch secret.(type) {
+	case string:
+		if secret == "" {
+			return "", false
+		}
+	case int, int64, uint64, float64:
+	default:
+		return "", false
+	}
+	return jsonString(secret), true
+}
+
+// ConfigString returns a string representation of the named processor's
+// config as JSON. Registered secrets are redacted.
 func ConfigString(name string, v interface{}) string {
 	var buf strings.Builder
-	buf.WriteString(name)
-	buf.WriteByte('=')
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(v)
+
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	if len(secrets) == 0 {
+		return name + "=" + buf.String()
+	}
+	return name + "=" + redact(buf.String())
+}
 
+// redact replaces the string and number values in the JSON encoded config
+// that are equal to a registered secret. The values are compared token by
+// token so that numbers are not matched within other values.
+func redact(config string) string {
+	var out strings.Builder
+	dec := json.NewDecoder(strings.NewReader(config))
+	var last int64
+	for {
+		start := dec.InputOffset()
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		if _, isDelim := tok.(json.Delim); isDelim {
+			continue
+		}
+		end := dec.InputOffset()
+		// The token is preceded by the separator that the decoder skipped.
+		raw := strings.TrimLeft(config[start:end], ",:")
+		if _, found := secrets[raw]; found {
+			out.WriteString(config[last : end-int64(len(raw))])
+			out.WriteString(redactedValue)
+			last = end
+		}
+	}
+	out.WriteString(config[last:])
+	return out.String()
+}
+
+// jsonString returns v encoded like ConfigString encodes values.
+func jsonString(v interface{}) string {
+	var buf strings.Builder
 	enc := json.NewEncoder(&buf)
 	enc.SetEscapeHTML(false)
 	_ = enc.Encode(v)
-	return buf.String()
+	return strings.TrimSuffix(buf.String(), "\n")
 }
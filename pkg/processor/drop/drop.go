@@ -0,0 +1,59 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Code generated by processor/generate.go - DO NOT EDIT.
+package drop
+
+import (
+	"github.com/andrewkroh/go-sawmill/pkg/processor"
+	"github.com/andrewkroh/go-sawmill/pkg/processor/registry"
+)
+
+func init() {
+	registry.MustRegister(processorName, New)
+}
+
+const (
+	processorName = "drop"
+)
+
+// Config contains the configuration options for the drop processor.
+type Config struct{}
+
+// InitDefaults initializes the configuration options to their default values.
+func (c *Config) InitDefaults() {
+}
+
+// Drops the event. No further processors are executed and the event is not
+// output. Use the `if` option to drop events conditionally.
+type Drop struct {
+	config Config
+}
+
+// New returns a new Drop processor.
+func New(config Config) (*Drop, error) {
+	return &Drop{config: config}, nil
+}
+
+// Config returns the Drop processor config.
+func (p *Drop) Config() Config {
+	return p.config
+}
+
+func (p *Drop) String() string {
+	return processor.ConfigString(processorName, p.config)
+}
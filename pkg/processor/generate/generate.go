@@ -77,6 +77,10 @@ func main() {
 
 	for _, p := range p.Processors {
 		for name, data := range p {
+			if data.Builtin {
+				continue
+			}
+
 			// Sort config options by name.
 			sort.Slice(data.Configuration, func(i, j int) bool {
 				return data.Configuration[i].Name < data.Configuration[j].Name
@@ -19,7 +19,10 @@ package registry
 
 import (
 	"fmt"
+	"io"
 	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/elastic/go-ucfg"
 
@@ -43,10 +46,102 @@ func NewProcessor(name string, config map[string]interface{}) (processor.Process
 	return constructors.NewProcessor(name, config)
 }
 
+// Names returns the sorted names of the registered processors.
+func Names() []string {
+	return constructors.Names()
+}
+
+// Options returns the configuration options accepted by the named processor.
+// It returns false if the processor is not registered.
+func Options(name string) ([]Option, bool) {
+	return constructors.Options(name)
+}
+
+// CheckConfig unpacks the config into the config struct of the named
+// processor without constructing the processor. It reports invalid option
+// values.
+func CheckConfig(name string, config map[string]interface{}) error {
+	return constructors.CheckConfig(name, config)
+}
+
+// Option describes a configuration option accepted by a processor.
+type Option struct {
+	Name     string // Name of the option.
+	Required bool   // True if the option must be specified.
+}
+
+// ConfigOptions returns the options declared by the fields of a config
+// struct. Field names are taken from the `config` struct tag and fields with a
+// `validate:"required"` tag are required. Fields tagged with `config:"-"` are
+// omitted and inline fields are expanded.
+func ConfigOptions(config interface{}) []Option {
+	t := reflect.TypeOf(config)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	options := structOptions(t)
+	sort.Slice(options, func(i, j int) bool {
+		return options[i].Name < options[j].Name
+	})
+	return options
+}
+
+func structOptions(t reflect.Type) []Option {
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var options []Option
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			// Unexported
+			continue
+		}
+
+		tagOpts := strings.Split(field.Tag.Get("config"), ",")
+		name := tagOpts[0]
+		if name == "-" {
+			continue
+		}
+		if contains(tagOpts[1:], "inline") || (name == "" && field.Anonymous) {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			options = append(options, structOptions(ft)...)
+			continue
+		}
+		if name == "" {
+			// Same as the ucfg default.
+			name = strings.ToLower(field.Name)
+		}
+
+		options = append(options, Option{
+			Name:     name,
+			Required: contains(strings.Split(field.Tag.Get("validate"), ","), "required"),
+		})
+	}
+	return options
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if strings.TrimSpace(item) == s {
+			return true
+		}
+	}
+	return false
+}
+
 type processorConstructor struct {
 	// newConfig returns a pointer to a zero value config.
 	newConfig func() reflect.Value
 
+	// options accepted by the processor's config.
+	options []Option
+
 	newProc func(config reflect.Value) (processor.Processor, error)
 }
 
@@ -76,18 +171,72 @@ func (r *Registry) NewProcessor(name string, config map[string]interface{}) (pro
 		return nil, fmt.Errorf("processor type %q not found", name)
 	}
 
+	procConfigValue, err := pc.unpack(config)
+	if err != nil {
+		return nil, err
+	}
+
+	proc, err := pc.newProc(procConfigValue)
+	if err != nil {
+		return nil, err
+	}
+
+	if starter, ok := proc.(processor.Starter); ok {
+		if err = starter.Start(); err != nil {
+			if closer, ok := proc.(io.Closer); ok {
+				closer.Close()
+			}
+			return nil, fmt.Errorf("failed to start %q processor: %w", name, err)
+		}
+	}
+
+	return proc, nil
+}
+
+// Names returns the sorted names of the registered processors.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.procs))
+	for name := range r.procs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Options returns the configuration options accepted by the named processor.
+// It returns false if the processor is not registered.
+func (r *Registry) Options(name string) ([]Option, bool) {
+	pc, found := r.procs[name]
+	if !found {
+		return nil, false
+	}
+	return append([]Option(nil), pc.options...), true
+}
+
+// CheckConfig unpacks the config into the config struct of the named
+// processor without constructing the processor.
+func (r *Registry) CheckConfig(name string, config map[string]interface{}) error {
+	pc, found := r.procs[name]
+	if !found {
+		return fmt.Errorf("processor type %q not found", name)
+	}
+	_, err := pc.unpack(config)
+	return err
+}
+
+// unpack unpacks the config into a new config struct.
+func (pc processorConstructor) unpack(config map[string]interface{}) (reflect.Value, error) {
 	procConfigValue := pc.newConfig()
 
 	uConf, err := ucfg.NewFrom(config)
 	if err != nil {
-		return nil, err
+		return reflect.Value{}, err
 	}
 
 	if err := uConf.Unpack(procConfigValue.Interface()); err != nil {
-		return nil, err
+		return reflect.Value{}, err
 	}
-
-	return pc.newProc(procConfigValue)
+	return procConfigValue, nil
 }
 
 func (r *Registry) clear() {
@@ -131,6 +280,7 @@ func validateConfig(i interface{}) (*processorConstructor, error) {
 		newConfig: func() reflect.Value {
 			return reflect.New(configType)
 		},
+		options: ConfigOptions(reflect.New(configType).Interface()),
 		newProc: func(config reflect.Value) (processor.Processor, error) {
 			if config.Type().Kind() == reflect.Ptr {
 				config = config.Elem()
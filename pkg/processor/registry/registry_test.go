@@ -18,6 +18,7 @@
 package registry
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -59,3 +60,90 @@ func TestRegister(t *testing.T) {
 	require.True(t, ok)
 	assert.True(t, d.config.IgnoreFailure)
 }
+
+type lifecycleConfig struct {
+	FailStart bool `config:"fail_start"`
+}
+
+type lifecycleProc struct {
+	config  lifecycleConfig
+	started bool
+	closed  bool
+}
+
+func (p *lifecycleProc) Process(event processor.Event) error {
+	return nil
+}
+
+func (p *lifecycleProc) Start() error {
+	if p.config.FailStart {
+		return errors.New("start failed")
+	}
+	p.started = true
+	return nil
+}
+
+func (p *lifecycleProc) Close() error {
+	p.closed = true
+	return nil
+}
+
+func TestLifecycle(t *testing.T) {
+	var last *lifecycleProc
+	r := NewRegistry()
+	require.NoError(t, r.Register("lifecycle", func(conf lifecycleConfig) (*lifecycleProc, error) {
+		last = &lifecycleProc{config: conf}
+		return last, nil
+	}))
+
+	p, err := r.NewProcessor("lifecycle", nil)
+	require.NoError(t, err)
+	assert.True(t, p.(*lifecycleProc).started)
+
+	_, err = r.NewProcessor("lifecycle", map[string]interface{}{"fail_start": true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "start failed")
+	assert.True(t, last.closed, "processor must be closed when Start fails")
+}
+
+type optionsConfig struct {
+	Field      string `config:"field" validate:"required"`
+	Target     string `config:"target_field,omitempty"`
+	Threshold  int    `config:"threshold" validate:"min=1, required"`
+	Skipped    string `config:"-"`
+	Default    bool
+	Common     commonConfig `config:",inline"`
+	unexported string
+}
+
+type commonConfig struct {
+	IgnoreMissing bool `config:"ignore_missing"`
+}
+
+func TestOptions(t *testing.T) {
+	r := NewRegistry()
+	require.NoError(t, r.Register("options", func(c optionsConfig) (*DummyProc, error) {
+		return &DummyProc{}, nil
+	}))
+	require.NoError(t, r.Register("dummy", newDummyProc))
+
+	assert.Equal(t, []string{"dummy", "options"}, r.Names())
+
+	options, found := r.Options("options")
+	require.True(t, found)
+	assert.Equal(t, []Option{
+		{Name: "default"},
+		{Name: "field", Required: true},
+		{Name: "ignore_missing"},
+		{Name: "target_field"},
+		{Name: "threshold", Required: true},
+	}, options)
+
+	_, found = r.Options("missing")
+	assert.False(t, found)
+
+	assert.NoError(t, r.CheckConfig("options", map[string]interface{}{"field": "a", "threshold": 2}))
+	assert.Error(t, r.CheckConfig("options", map[string]interface{}{"field": "a", "threshold": "x"}))
+	assert.Error(t, r.CheckConfig("options", map[string]interface{}{"threshold": 2}))
+	assert.Error(t, r.CheckConfig("missing", nil))
+}
@@ -0,0 +1,76 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package remove
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+	"github.com/andrewkroh/go-sawmill/pkg/processor"
+)
+
+type testEvent struct {
+	*event.Event
+}
+
+func (e testEvent) Context() context.Context { return context.Background() }
+func (e testEvent) Cancel()                  {}
+func (e testEvent) Drop()                    {}
+
+func newTestEvent() testEvent {
+	evt := event.New()
+	evt.Put("user.name", event.String("alice"))
+	evt.Put("user.id", event.String("1234"))
+	evt.Put("message", event.String("hello"))
+	return testEvent{evt}
+}
+
+func TestRemove(t *testing.T) {
+	t.Run("nested field keeps siblings", func(t *testing.T) {
+		p, err := New(Config{Fields: []string{"user.name", "message"}})
+		require.NoError(t, err)
+
+		evt := newTestEvent()
+		require.NoError(t, p.Process(evt))
+
+		assert.Nil(t, evt.Get("user.name"))
+		assert.Nil(t, evt.Get("message"))
+		assert.Equal(t, event.String("1234"), evt.Get("user.id"))
+	})
+
+	t.Run("missing field", func(t *testing.T) {
+		p, err := New(Config{Fields: []string{"message", "user.email"}})
+		require.NoError(t, err)
+
+		err = p.Process(newTestEvent())
+		assert.ErrorIs(t, err, processor.ErrorKeyMissing{})
+	})
+
+	t.Run("ignore missing", func(t *testing.T) {
+		p, err := New(Config{Fields: []string{"user.email", "message"}, IgnoreMissing: true})
+		require.NoError(t, err)
+
+		evt := newTestEvent()
+		require.NoError(t, p.Process(evt))
+		assert.Nil(t, evt.Get("message"))
+	})
+}
@@ -0,0 +1,149 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package encoder writes events to an output in one of several formats.
+package encoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"gopkg.in/yaml.v3"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+	"github.com/andrewkroh/go-sawmill/pkg/serialization/mapinterface"
+	"github.com/andrewkroh/go-sawmill/pkg/serialization/protobuf"
+)
+
+// Output formats.
+const (
+	FormatNDJSON   = "ndjson"   // One JSON object per line.
+	FormatPretty   = "pretty"   // Indented JSON objects.
+	FormatProtobuf = "protobuf" // Length-delimited protobuf.MessageWrapper records.
+	FormatLogfmt   = "logfmt"   // One line of key=value pairs per event.
+	FormatCSV      = "csv"      // CSV with a column per field in Options.Fields.
+	FormatYAML     = "yaml"     // A YAML document per event.
+)
+
+// Formats returns the supported output formats.
+func Formats() []string {
+	return []string{FormatNDJSON, FormatPretty, FormatProtobuf, FormatLogfmt, FormatCSV, FormatYAML}
+}
+
+// Encoder writes events to an output. Each event is written to the
+// underlying writer before Encode returns.
+type Encoder interface {
+	Encode(evt *event.Event) error
+}
+
+// Options configures an Encoder.
+type Options struct {
+	Fields []string // Fields written as columns by the csv format. Required for csv.
+}
+
+// New returns an Encoder that writes events to w in the given format.
+func New(format string, w io.Writer, opts Options) (Encoder, error) {
+	if len(opts.Fields) > 0 && format != FormatCSV {
+		return nil, fmt.Errorf("fields can only be used with the %s format", FormatCSV)
+	}
+
+	switch format {
+	case FormatNDJSON:
+		return newJSONEncoder(w, false), nil
+	case FormatPretty:
+		return newJSONEncoder(w, true), nil
+	case FormatProtobuf:
+		return &protobufEncoder{w: w}, nil
+	case FormatLogfmt:
+		return &logfmtEncoder{w: w}, nil
+	case FormatCSV:
+		if len(opts.Fields) == 0 {
+			return nil, fmt.Errorf("the %s format requires a list of fields", FormatCSV)
+		}
+		return newCSVEncoder(w, opts.Fields), nil
+	case FormatYAML:
+		return &yamlEncoder{w: w}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q (must be one of %s)", format, strings.Join(Formats(), ", "))
+	}
+}
+
+type jsonEncoder struct {
+	enc *json.Encoder
+}
+
+func newJSONEncoder(w io.Writer, pretty bool) *jsonEncoder {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if pretty {
+		enc.SetIndent("", "  ")
+	}
+	return &jsonEncoder{enc: enc}
+}
+
+func (e *jsonEncoder) Encode(evt *event.Event) error {
+	return e.enc.Encode(evt)
+}
+
+// protobufEncoder writes each event as a protobuf.MessageWrapper preceded by
+// its size as a varint. This is the same framing as writeDelimitedTo in the
+// Java protobuf library.
+type protobufEncoder struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (e *protobufEncoder) Encode(evt *event.Event) error {
+	data, err := proto.Marshal(protobuf.FromEvent(evt))
+	if err != nil {
+		return err
+	}
+
+	var size [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(size[:], uint64(len(data)))
+	e.buf = append(append(e.buf[:0], size[:n]...), data...)
+	_, err = e.w.Write(e.buf)
+	return err
+}
+
+// yamlEncoder writes each event as a YAML document that starts with ---.
+type yamlEncoder struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+func (e *yamlEncoder) Encode(evt *event.Event) error {
+	e.buf.Reset()
+	e.buf.WriteString("---\n")
+
+	enc := yaml.NewEncoder(&e.buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(mapinterface.FromEvent(evt)); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+
+	_, err := e.w.Write(e.buf.Bytes())
+	return err
+}
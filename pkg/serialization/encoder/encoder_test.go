@@ -0,0 +1,150 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package encoder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+	"github.com/andrewkroh/go-sawmill/pkg/serialization/protobuf"
+)
+
+var testTime = time.Date(2022, 11, 5, 10, 30, 0, 0, time.UTC)
+
+func testEvents() []*event.Event {
+	evt := event.New()
+	evt.Put("message", event.String(`GET /index.html "ok"`))
+	evt.Put("@timestamp", event.Timestamp(testTime.UnixNano()))
+	evt.Put("source.ip", event.String("10.0.0.1"))
+	evt.Put("source.port", event.Integer(53))
+	evt.Put("http.response.bytes", event.UnsignedInteger(1024))
+	evt.Put("event.duration", event.Float(1.5))
+	evt.Put("event.success", event.Bool(true))
+	evt.Put("tags", event.Array(event.String("a"), event.String("b")))
+	evt.Put("error", event.NullValue)
+
+	evt2 := event.New()
+	evt2.Put("message", event.String("hello"))
+	evt2.Put("empty", event.String(""))
+
+	return []*event.Event{evt, evt2}
+}
+
+func encode(t *testing.T, format string, opts Options) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	enc, err := New(format, &buf, opts)
+	require.NoError(t, err)
+	for _, evt := range testEvents() {
+		require.NoError(t, enc.Encode(evt))
+	}
+	return buf.String()
+}
+
+func TestNDJSON(t *testing.T) {
+	assert.Equal(t, `{"@timestamp":"2022-11-05T10:30:00Z","error":null,"event":{"duration":1.5,"success":true},"http":{"response":{"bytes":1024}},"message":"GET /index.html \"ok\"","source":{"ip":"10.0.0.1","port":53},"tags":["a","b"]}
+{"empty":"","message":"hello"}
+`, encode(t, FormatNDJSON, Options{}))
+}
+
+func TestPretty(t *testing.T) {
+	out := encode(t, FormatPretty, Options{})
+	assert.True(t, strings.HasPrefix(out, "{\n  \"@timestamp\": \"2022-11-05T10:30:00Z\",\n"), out)
+	assert.True(t, strings.HasSuffix(out, "}\n{\n  \"empty\": \"\",\n  \"message\": \"hello\"\n}\n"), out)
+}
+
+func TestLogfmt(t *testing.T) {
+	assert.Equal(t, `@timestamp=2022-11-05T10:30:00Z error="" event.duration=1.5 event.success=true http.response.bytes=1024 message="GET /index.html \"ok\"" source.ip=10.0.0.1 source.port=53 tags="[\"a\",\"b\"]"
+empty="" message=hello
+`, encode(t, FormatLogfmt, Options{}))
+}
+
+func TestCSV(t *testing.T) {
+	assert.Equal(t, `source.ip,source.port,message,tags,missing
+10.0.0.1,53,"GET /index.html ""ok""","[""a"",""b""]",
+,,hello,,
+`, encode(t, FormatCSV, Options{Fields: []string{"source.ip", "source.port", "message", "tags", "missing"}}))
+}
+
+func TestYAML(t *testing.T) {
+	assert.Equal(t, `---
+'@timestamp': 2022-11-05T10:30:00Z
+error: null
+event:
+  duration: 1.5
+  success: true
+http:
+  response:
+    bytes: 1024
+message: GET /index.html "ok"
+source:
+  ip: 10.0.0.1
+  port: 53
+tags:
+  - a
+  - b
+---
+empty: ""
+message: hello
+`, encode(t, FormatYAML, Options{}))
+}
+
+func TestProtobuf(t *testing.T) {
+	r := bufio.NewReader(bytes.NewBufferString(encode(t, FormatProtobuf, Options{})))
+
+	var events []*event.Event
+	for {
+		size, err := binary.ReadUvarint(r)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+
+		data := make([]byte, size)
+		_, err = io.ReadFull(r, data)
+		require.NoError(t, err)
+
+		var msg protobuf.MessageWrapper
+		require.NoError(t, proto.Unmarshal(data, &msg))
+		events = append(events, protobuf.ToLogEvent(msg.GetLog()))
+	}
+
+	assert.Equal(t, testEvents(), events)
+}
+
+func TestNewErrors(t *testing.T) {
+	_, err := New("xml", io.Discard, Options{})
+	assert.EqualError(t, err, `unknown output format "xml" (must be one of ndjson, pretty, protobuf, logfmt, csv, yaml)`)
+
+	_, err = New(FormatCSV, io.Discard, Options{})
+	assert.EqualError(t, err, "the csv format requires a list of fields")
+
+	_, err = New(FormatNDJSON, io.Discard, Options{Fields: []string{"message"}})
+	assert.EqualError(t, err, "fields can only be used with the csv format")
+}
@@ -0,0 +1,162 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package encoder
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/andrewkroh/go-sawmill/pkg/event"
+)
+
+// logfmtEncoder writes each event as a line of key=value pairs. Nested
+// objects are flattened into dotted keys and the keys are sorted.
+type logfmtEncoder struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+func (e *logfmtEncoder) Encode(evt *event.Event) error {
+	e.buf.Reset()
+
+	var pairs []string
+	flatten("", evt.Get("."), func(key string, v *event.Value) {
+		pairs = append(pairs, logfmtKey(key)+"="+logfmtValue(valueText(v)))
+	})
+	sort.Strings(pairs)
+
+	e.buf.WriteString(strings.Join(pairs, " "))
+	e.buf.WriteByte('\n')
+	_, err := e.w.Write(e.buf.Bytes())
+	return err
+}
+
+// flatten calls fn for each non-object value in v with its dotted key.
+func flatten(prefix string, v *event.Value, fn func(key string, v *event.Value)) {
+	if v == nil {
+		return
+	}
+	if v.Type != event.ObjectType {
+		fn(prefix, v)
+		return
+	}
+	for k, inner := range v.Object {
+		if prefix != "" {
+			k = prefix + "." + k
+		}
+		flatten(k, inner, fn)
+	}
+}
+
+// logfmtKey replaces the characters that are not allowed in a logfmt key.
+func logfmtKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' || !unicode.IsPrint(r) {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+// logfmtValue quotes the value if it is empty or contains characters that
+// are not allowed in an unquoted logfmt value.
+func logfmtValue(s string) string {
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || !unicode.IsPrint(r) {
+			return strconv.Quote(s)
+		}
+	}
+	if s == "" {
+		return `""`
+	}
+	return s
+}
+
+// csvEncoder writes a column for each field. The header row containing the
+// field names is written before the first event.
+type csvEncoder struct {
+	w             *csv.Writer
+	fields        []string
+	record        []string
+	headerWritten bool
+}
+
+func newCSVEncoder(w io.Writer, fields []string) *csvEncoder {
+	return &csvEncoder{
+		w:      csv.NewWriter(w),
+		fields: fields,
+		record: make([]string, len(fields)),
+	}
+}
+
+func (e *csvEncoder) Encode(evt *event.Event) error {
+	if !e.headerWritten {
+		if err := e.w.Write(e.fields); err != nil {
+			return err
+		}
+		e.headerWritten = true
+	}
+
+	for i, field := range e.fields {
+		e.record[i] = valueText(evt.Get(field))
+	}
+	if err := e.w.Write(e.record); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// valueText returns the text representation of a value. Strings are
+// unquoted, timestamps are RFC3339, null and missing values are empty, and
+// arrays and objects are JSON.
+func valueText(v *event.Value) string {
+	if v == nil {
+		return ""
+	}
+
+	switch v.Type {
+	case event.StringType:
+		return v.String
+	case event.BoolType:
+		return strconv.FormatBool(v.Bool)
+	case event.IntegerType:
+		return strconv.FormatInt(v.Integer, 10)
+	case event.UnsignedIntegerType:
+		return strconv.FormatUint(v.UnsignedInteger, 10)
+	case event.FloatType:
+		return strconv.FormatFloat(v.Float, 'g', -1, 64)
+	case event.TimestampType:
+		return v.Timestamp.GoTime().Format(time.RFC3339Nano)
+	case event.NullType:
+		return ""
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(data)
+	}
+}
@@ -19,3 +19,5 @@ package protobuf
 
 //go:generate go install github.com/gogo/protobuf/protoc-gen-gofast
 //go:generate protoc --gofast_out=. event.proto
+//go:generate go install google.golang.org/grpc/cmd/protoc-gen-go-grpc@v1.3.0
+//go:generate protoc --go-grpc_out=. --go-grpc_opt=paths=source_relative,Mevent.proto=github.com/andrewkroh/go-sawmill/pkg/serialization/protobuf pipeline_service.proto
@@ -0,0 +1,290 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package syslog parses syslog messages in the RFC 5424 and RFC 3164 (BSD)
+// formats.
+package syslog
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPriority is the largest valid PRI value (facility 23, severity 7).
+const maxPriority = 191
+
+// bom is the UTF-8 byte order mark that may begin an RFC 5424 message.
+const bom = "\xef\xbb\xbf"
+
+// Message is a parsed syslog message. Header fields that are absent from the
+// message are empty.
+type Message struct {
+	Priority       int       // PRI value, facility*8 + severity.
+	Version        int       // 1 for RFC 5424. 0 for RFC 3164.
+	Timestamp      time.Time // Zero if the message has no timestamp.
+	Hostname       string
+	AppName        string                       // APP-NAME, or the TAG of an RFC 3164 message.
+	ProcID         string                       // PROCID, or the PID following the TAG of an RFC 3164 message.
+	MsgID          string                       // RFC 5424 only.
+	StructuredData map[string]map[string]string // Parameters keyed by SD-ID. RFC 5424 only.
+	Message        string                       // Free-form message that follows the header.
+}
+
+// Facility returns the facility code from the priority.
+func (m *Message) Facility() int {
+	return m.Priority / 8
+}
+
+// Severity returns the severity code from the priority.
+func (m *Message) Severity() int {
+	return m.Priority % 8
+}
+
+// Parse parses an RFC 5424 or RFC 3164 message. The format is detected from
+// the version that follows the priority in RFC 5424 messages.
+//
+// RFC 3164 is parsed leniently because implementations vary. The hostname
+// is optional, and the timestamp may be in RFC 3339 format. An RFC 3164
+// timestamp has no year or time zone, so it is interpreted in the location of
+// now and in the latest year that does not put it more than a day after now.
+// If the message has no recognizable timestamp then everything after the
+// priority is the message.
+func Parse(data string, now time.Time) (*Message, error) {
+	pri, rest, err := parsePriority(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if version, r, ok := parseVersion(rest); ok {
+		m, err := parseRFC5424(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RFC 5424 message: %w", err)
+		}
+		m.Priority, m.Version = pri, version
+		return m, nil
+	}
+
+	m := parseRFC3164(rest, now)
+	m.Priority = pri
+	return m, nil
+}
+
+// parsePriority parses the "<PRI>" that begins every message.
+func parsePriority(s string) (int, string, error) {
+	if !strings.HasPrefix(s, "<") {
+		return 0, "", errors.New("message does not begin with a priority")
+	}
+	end := strings.IndexByte(s, '>')
+	if end < 2 || end > 4 {
+		return 0, "", errors.New("invalid priority")
+	}
+	pri, err := strconv.Atoi(s[1:end])
+	if err != nil || pri < 0 || pri > maxPriority || (s[1] == '0' && end > 2) {
+		return 0, "", fmt.Errorf("invalid priority %q", s[1:end])
+	}
+	return pri, s[end+1:], nil
+}
+
+// parseVersion parses the version and space that follow the priority in an
+// RFC 5424 message.
+func parseVersion(s string) (int, string, bool) {
+	end := strings.IndexByte(s, ' ')
+	if end < 1 || end > 2 || s[0] == '0' {
+		return 0, "", false
+	}
+	version, err := strconv.Atoi(s[:end])
+	if err != nil {
+		return 0, "", false
+	}
+	return version, s[end+1:], true
+}
+
+// parseRFC5424 parses the header fields following the version.
+func parseRFC5424(s string) (*Message, error) {
+	var m Message
+
+	field, s := nextField(s)
+	if field != "" {
+		ts, err := time.Parse(time.RFC3339Nano, field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q", field)
+		}
+		m.Timestamp = ts
+	}
+	m.Hostname, s = nextField(s)
+	m.AppName, s = nextField(s)
+	m.ProcID, s = nextField(s)
+	m.MsgID, s = nextField(s)
+
+	if strings.HasPrefix(s, "-") {
+		s = s[1:]
+	} else if s != "" {
+		sd, rest, err := parseStructuredData(s)
+		if err != nil {
+			return nil, err
+		}
+		m.StructuredData, s = sd, rest
+	}
+
+	if s != "" && s[0] != ' ' {
+		return nil, errors.New("missing space after structured data")
+	}
+	m.Message = strings.TrimPrefix(strings.TrimPrefix(s, " "), bom)
+	return &m, nil
+}
+
+// nextField returns the header field before the next space and the rest of
+// the input after it. The nil value "-" is returned as an empty string.
+func nextField(s string) (field, rest string) {
+	end := strings.IndexByte(s, ' ')
+	if end < 0 {
+		field, rest = s, ""
+	} else {
+		field, rest = s[:end], s[end+1:]
+	}
+	if field == "-" {
+		field = ""
+	}
+	return field, rest
+}
+
+// parseStructuredData parses one or more SD-ELEMENTs of the form
+// [id name="value" ...]. Within values the characters '"', '\', and ']' are
+// escaped with a backslash.
+func parseStructuredData(s string) (map[string]map[string]string, string, error) {
+	sd := map[string]map[string]string{}
+	for strings.HasPrefix(s, "[") {
+		end := strings.IndexAny(s, " ]")
+		if end < 0 {
+			return nil, "", errors.New("unterminated structured data")
+		}
+		id := s[1:end]
+		if id == "" {
+			return nil, "", errors.New("structured data element has no ID")
+		}
+		params := map[string]string{}
+		sd[id] = params
+		s = s[end:]
+
+		for strings.HasPrefix(s, " ") {
+			eq := strings.Index(s, `="`)
+			if eq < 0 {
+				return nil, "", fmt.Errorf("invalid parameter in structured data element %q", id)
+			}
+			name := s[1:eq]
+
+			var value strings.Builder
+			i := eq + 2
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`"\]`, s[i+1]) >= 0 {
+					i++
+				}
+				value.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return nil, "", fmt.Errorf("unterminated value of parameter %q in structured data element %q", name, id)
+			}
+			params[name] = value.String()
+			s = s[i+1:]
+		}
+
+		if !strings.HasPrefix(s, "]") {
+			return nil, "", fmt.Errorf("unterminated structured data element %q", id)
+		}
+		s = s[1:]
+	}
+	if len(sd) == 0 {
+		return nil, "", errors.New("invalid structured data")
+	}
+	return sd, s, nil
+}
+
+// parseRFC3164 parses the header fields following the priority.
+func parseRFC3164(s string, now time.Time) *Message {
+	var m Message
+
+	ts, rest, ok := parseRFC3164Timestamp(s, now)
+	if !ok {
+		m.Message = s
+		return &m
+	}
+	m.Timestamp = ts
+
+	// The hostname is optional. The first word is the tag if it is followed
+	// by a colon or contains a PID.
+	word, afterWord := nextField(rest)
+	if !strings.HasSuffix(word, ":") && !strings.Contains(word, "[") {
+		m.Hostname, rest = word, afterWord
+	}
+
+	m.AppName, m.ProcID, m.Message = parseTag(rest)
+	return &m
+}
+
+// parseRFC3164Timestamp parses a timestamp in the "Jan _2 15:04:05" format
+// or in RFC 3339 format, followed by a space.
+func parseRFC3164Timestamp(s string, now time.Time) (time.Time, string, bool) {
+	if len(s) > len(time.Stamp) && s[len(time.Stamp)] == ' ' {
+		if t, err := time.ParseInLocation(time.Stamp, s[:len(time.Stamp)], now.Location()); err == nil {
+			return closestYear(t, now), s[len(time.Stamp)+1:], true
+		}
+	}
+
+	field, rest := nextField(s)
+	if t, err := time.Parse(time.RFC3339Nano, field); err == nil {
+		return t, rest, true
+	}
+	return time.Time{}, "", false
+}
+
+// closestYear returns t in the year of now, or in the previous year if that
+// would put t more than a day after now. Messages are rarely from the future,
+// and a day allows for clock skew between the sender and receiver.
+func closestYear(t, now time.Time) time.Time {
+	t = time.Date(now.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), now.Location())
+	if t.Sub(now) > 24*time.Hour {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t
+}
+
+// parseTag parses the tag and optional PID that begin the content of an
+// RFC 3164 message (e.g. "sshd[123]: message"). If the content does not
+// begin with a tag then it is all message.
+func parseTag(s string) (tag, pid, msg string) {
+	end := strings.IndexAny(s, "[: ")
+	if end <= 0 {
+		return "", "", s
+	}
+	tag, rest := s[:end], s[end:]
+
+	if strings.HasPrefix(rest, "[") {
+		pidEnd := strings.IndexByte(rest, ']')
+		if pidEnd < 0 {
+			return "", "", s
+		}
+		pid, rest = rest[1:pidEnd], rest[pidEnd+1:]
+	} else if !strings.HasPrefix(rest, ":") {
+		return "", "", s
+	}
+
+	rest = strings.TrimPrefix(rest, ":")
+	return tag, pid, strings.TrimPrefix(rest, " ")
+}
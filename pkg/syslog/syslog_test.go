@@ -0,0 +1,174 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package syslog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	now := time.Date(2023, time.March, 15, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name    string
+		message string
+		parsed  Message
+	}{
+		{
+			name:    "rfc5424",
+			message: `<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - ` + bom + `'su root' failed for lonvick on /dev/pts/8`,
+			parsed: Message{
+				Priority:  34,
+				Version:   1,
+				Timestamp: time.Date(2003, time.October, 11, 22, 14, 15, 3000000, time.UTC),
+				Hostname:  "mymachine.example.com",
+				AppName:   "su",
+				MsgID:     "ID47",
+				Message:   "'su root' failed for lonvick on /dev/pts/8",
+			},
+		},
+		{
+			name:    "rfc5424 structured data",
+			message: `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog 1234 ID47 [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"][examplePriority@32473 class="high \"x\" [y\]"] An application event`,
+			parsed: Message{
+				Priority:  165,
+				Version:   1,
+				Timestamp: time.Date(2003, time.October, 11, 22, 14, 15, 3000000, time.UTC),
+				Hostname:  "mymachine.example.com",
+				AppName:   "evntslog",
+				ProcID:    "1234",
+				MsgID:     "ID47",
+				StructuredData: map[string]map[string]string{
+					"exampleSDID@32473":     {"iut": "3", "eventSource": "Application", "eventID": "1011"},
+					"examplePriority@32473": {"class": `high "x" [y]`},
+				},
+				Message: "An application event",
+			},
+		},
+		{
+			name:    "rfc5424 nil values",
+			message: `<13>1 - - - - - -`,
+			parsed:  Message{Priority: 13, Version: 1},
+		},
+		{
+			name:    "rfc3164",
+			message: `<34>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick on /dev/pts/8`,
+			parsed: Message{
+				Priority:  34,
+				Timestamp: time.Date(2022, time.October, 11, 22, 14, 15, 0, time.UTC),
+				Hostname:  "mymachine",
+				AppName:   "su",
+				Message:   "'su root' failed for lonvick on /dev/pts/8",
+			},
+		},
+		{
+			name:    "rfc3164 pid",
+			message: `<38>Mar  5 09:10:11 host sshd[4321]: Accepted publickey for user`,
+			parsed: Message{
+				Priority:  38,
+				Timestamp: time.Date(2023, time.March, 5, 9, 10, 11, 0, time.UTC),
+				Hostname:  "host",
+				AppName:   "sshd",
+				ProcID:    "4321",
+				Message:   "Accepted publickey for user",
+			},
+		},
+		{
+			name:    "rfc3164 no hostname",
+			message: `<38>Mar 15 09:10:11 sshd[4321]: Accepted`,
+			parsed: Message{
+				Priority:  38,
+				Timestamp: time.Date(2023, time.March, 15, 9, 10, 11, 0, time.UTC),
+				AppName:   "sshd",
+				ProcID:    "4321",
+				Message:   "Accepted",
+			},
+		},
+		{
+			name:    "rfc3164 no tag",
+			message: `<13>Feb  5 17:32:18 10.0.0.99 Use the BFG!`,
+			parsed: Message{
+				Priority:  13,
+				Timestamp: time.Date(2023, time.February, 5, 17, 32, 18, 0, time.UTC),
+				Hostname:  "10.0.0.99",
+				Message:   "Use the BFG!",
+			},
+		},
+		{
+			name:    "rfc3164 rfc3339 timestamp",
+			message: `<30>2023-03-14T08:00:00.5+01:00 web nginx: started`,
+			parsed: Message{
+				Priority:  30,
+				Timestamp: time.Date(2023, time.March, 14, 7, 0, 0, 500000000, time.UTC),
+				Hostname:  "web",
+				AppName:   "nginx",
+				Message:   "started",
+			},
+		},
+		{
+			name:    "rfc3164 no timestamp",
+			message: `<13>hello world`,
+			parsed:  Message{Priority: 13, Message: "hello world"},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := Parse(tc.message, now)
+			require.NoError(t, err)
+			assert.True(t, tc.parsed.Timestamp.Equal(m.Timestamp), "expected %v, got %v", tc.parsed.Timestamp, m.Timestamp)
+			m.Timestamp = tc.parsed.Timestamp
+			assert.Equal(t, tc.parsed, *m)
+		})
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	m, err := Parse("<165>1 - - - - - -", time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 20, m.Facility())
+	assert.Equal(t, 5, m.Severity())
+}
+
+func TestParseErrors(t *testing.T) {
+	testCases := []struct {
+		message string
+		err     string
+	}{
+		{"hello", "message does not begin with a priority"},
+		{"<>hello", "invalid priority"},
+		{"<1234>hello", "invalid priority"},
+		{"<192>hello", `invalid priority "192"`},
+		{"<01>hello", `invalid priority "01"`},
+		{"<1>1 yesterday - - - - -", `invalid RFC 5424 message: invalid timestamp "yesterday"`},
+		{`<1>1 - - - - - [id x="1"hello`, `invalid RFC 5424 message: unterminated structured data element "id"`},
+		{`<1>1 - - - - - [id x="1`, `invalid RFC 5424 message: unterminated value of parameter "x" in structured data element "id"`},
+		{`<1>1 - - - - - [id x]`, `invalid RFC 5424 message: invalid parameter in structured data element "id"`},
+		{`<1>1 - - - - - [id]x`, `invalid RFC 5424 message: missing space after structured data`},
+	}
+
+	for _, tc := range testCases {
+		_, err := Parse(tc.message, time.Now())
+		assert.EqualError(t, err, tc.err, tc.message)
+	}
+}